@@ -0,0 +1,111 @@
+package auth
+
+import (
+	"crypto/subtle"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/lj-team/go-generic/log"
+	"github.com/lj-team/lcluster/pb"
+	"github.com/lj-team/lcluster/server"
+)
+
+// Config of accepted tokens. Secret is a token without name, Tokens
+// maps token name to secret. Internal lists names of tokens of replicas,
+// peers and management tools, only they may send restricted commands
+// and are not limited
+type Config struct {
+	Secret   string            `json:"secret"`
+	Tokens   map[string]string `json:"tokens"`
+	Internal []string          `json:"internal"`
+}
+
+// Credentials sent by client in AUTH request
+type Credentials struct {
+	Name   string `json:"name"`
+	Secret string `json:"secret"`
+}
+
+func (c *Config) Enabled() bool {
+	return c != nil && (c.Secret != "" || len(c.Tokens) > 0)
+}
+
+func (c *Config) Check(name, secret []byte) bool {
+
+	var wait string
+
+	if len(name) == 0 {
+		wait = c.Secret
+	} else {
+		var ok bool
+		if wait, ok = c.Tokens[string(name)]; !ok {
+			return false
+		}
+	}
+
+	if wait == "" {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(wait), secret) == 1
+}
+
+// Access returns access of the valid token
+func (c *Config) Access(name, secret []byte) server.Access {
+
+	if !c.Check(name, secret) {
+		return server.NoAccess
+	}
+
+	for _, n := range c.Internal {
+		if n != "" && n == string(name) {
+			return server.InternalAccess
+		}
+	}
+
+	return server.ClientAccess
+}
+
+// Handler returns callback for server.Server. It accepts only AUTH
+// request with valid token, anything else closes the connection
+func (c *Config) Handler() server.AUTHCALLBACK {
+
+	return func(req []byte) ([]byte, server.Access) {
+
+		var msg pb.LCPROTO
+
+		if err := proto.Unmarshal(req, &msg); err != nil {
+			return nil, server.NoAccess
+		}
+
+		if msg.Code != pb.LCPROTO_AUTH {
+			log.Warn("request " + msg.Code.String() + " before auth")
+			return nil, server.NoAccess
+		}
+
+		res := &pb.LCPROTO{Code: pb.LCPROTO_RESP, Id: msg.Id}
+
+		access := c.Access(msg.Key, msg.Value)
+		if access != server.NoAccess {
+			res.Ivalue = 1
+		} else {
+			log.Warn("auth failed for token '" + string(msg.Key) + "'")
+		}
+
+		rbuf, _ := proto.Marshal(res)
+
+		return rbuf, access
+	}
+}
+
+func (c *Credentials) Enabled() bool {
+	return c != nil && c.Secret != ""
+}
+
+// Request returns AUTH message for credentials
+func (c *Credentials) Request() *pb.LCPROTO {
+	return &pb.LCPROTO{
+		Code:  pb.LCPROTO_AUTH,
+		Key:   []byte(c.Name),
+		Value: []byte(c.Secret),
+	}
+}
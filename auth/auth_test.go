@@ -0,0 +1,66 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/lj-team/lcluster/pb"
+	"github.com/lj-team/lcluster/server"
+)
+
+func TestAuth(t *testing.T) {
+
+	cfg := &Config{
+		Secret:   "common",
+		Tokens:   map[string]string{"billing": "b-secret", "replica": "r-secret"},
+		Internal: []string{"replica"},
+	}
+
+	if !cfg.Enabled() || (&Config{}).Enabled() {
+		t.Fatal("Enabled failed")
+	}
+
+	tCheck := func(name, secret string, wait bool) {
+		if cfg.Check([]byte(name), []byte(secret)) != wait {
+			t.Fatalf("Check failed for %s %s", name, secret)
+		}
+	}
+
+	tCheck("", "common", true)
+	tCheck("", "b-secret", false)
+	tCheck("billing", "b-secret", true)
+	tCheck("billing", "common", false)
+	tCheck("unknown", "", false)
+
+	if cfg.Access([]byte("replica"), []byte("r-secret")) != server.InternalAccess ||
+		cfg.Access([]byte("billing"), []byte("b-secret")) != server.ClientAccess ||
+		cfg.Access([]byte("replica"), []byte("b-secret")) != server.NoAccess {
+		t.Fatal("Access failed")
+	}
+
+	handler := cfg.Handler()
+
+	tHandler := func(msg *pb.LCPROTO, wait bool) {
+		req, _ := proto.Marshal(msg)
+		res, access := handler(req)
+		if (access != server.NoAccess) != wait {
+			t.Fatalf("Handler failed for %v", msg)
+		}
+
+		if res != nil {
+			var r pb.LCPROTO
+			proto.Unmarshal(res, &r)
+			if r.Id != msg.Id || (r.Ivalue == 1) != wait {
+				t.Fatalf("invalid response for %v", msg)
+			}
+		}
+	}
+
+	cred := &Credentials{Name: "billing", Secret: "b-secret"}
+	req := cred.Request()
+	req.Id = 7
+
+	tHandler(req, true)
+	tHandler(&pb.LCPROTO{Code: pb.LCPROTO_AUTH, Value: []byte("wrong")}, false)
+	tHandler(&pb.LCPROTO{Code: pb.LCPROTO_C_HKILL, Key: []byte{1}}, false)
+}
@@ -1,50 +1,84 @@
 package codecs
 
 import (
-	"bytes"
-
-	"github.com/lj-team/go-generic/encode/pack"
+	"encoding/binary"
+	"fmt"
 )
 
+// DefaultMaxSize is used when Decode.MaxSize is not set, it fits SCAN
+// and SYNC parts of 4MB
+const DefaultMaxSize = 16 * 1024 * 1024
+
+// FrameError is returned for frame with invalid length prefix
+type FrameError struct {
+	Size int64
+	Max  int
+}
+
+func (e *FrameError) Error() string {
+	if e.Size < 0 {
+		return fmt.Sprintf("negative frame length %d", e.Size)
+	}
+	return fmt.Sprintf("frame length %d exceeds limit %d", e.Size, e.Max)
+}
+
 type Decode struct {
-	data []byte
+	MaxSize int
+	data    []byte
+	err     error
 }
 
-func (d *Decode) Write(data []byte) [][]byte {
+// Write appends data and returns all complete frames. After an error
+// the decoder is broken and the connection must be closed
+func (d *Decode) Write(data []byte) ([][]byte, error) {
 
-	var list []byte
+	if d.err != nil {
+		return nil, d.err
+	}
 
-	if d.data == nil {
-		list = bytes.Join([][]byte{[]byte{}, data}, nil)
-	} else {
-		list = bytes.Join([][]byte{d.data, data}, nil)
+	max := d.MaxSize
+	if max <= 0 {
+		max = DefaultMaxSize
 	}
 
-	res := [][]byte{}
+	d.data = append(d.data, data...)
 
-	size := int32(0)
+	var res [][]byte
 
-	for len(list) > 4 {
-		if pack.Decode(list, &size) != nil {
-			break
+	pos := 0
+
+	for len(d.data)-pos >= 4 {
+		size := int64(int32(binary.BigEndian.Uint32(d.data[pos:])))
+
+		if size < 0 || size > int64(max) {
+			d.err = &FrameError{Size: size, Max: max}
+			d.data = nil
+			return res, d.err
 		}
-		size = size + 4
-		if len(list) > int(size) {
-			res = append(res, list[4:size])
-			list = list[size:]
-		} else if len(list) == int(size) {
-			res = append(res, list[4:])
-			list = []byte{}
-		} else {
+
+		end := pos + 4 + int(size)
+		if end > len(d.data) {
 			break
 		}
+
+		res = append(res, d.data[pos+4:end:end])
+		pos = end
 	}
 
-	if len(list) > 0 {
-		d.data = list
-	} else {
-		d.data = []byte{}
+	// returned frames point into d.data, so the tail is moved to the
+	// new buffer instead of the copying in place. The buffer grows as
+	// data arrives, not by the declared frame length
+	if pos > 0 {
+		rest := len(d.data) - pos
+
+		if rest == 0 {
+			d.data = nil
+		} else {
+			tail := make([]byte, rest)
+			copy(tail, d.data[pos:])
+			d.data = tail
+		}
 	}
 
-	return res
+	return res, nil
 }
@@ -0,0 +1,32 @@
+package codecs
+
+import (
+	"testing"
+)
+
+func TestDecodeGrowth(t *testing.T) {
+
+	en := Encode{}
+	dec := Decode{}
+
+	// a complete frame and the header of the next one declaring 15MB
+	data := append(en.Write(make([]byte, 1000)), 0, 0xf0, 0, 0, 1)
+
+	list, err := dec.Write(data)
+	if err != nil || len(list) != 1 {
+		t.Fatal("decode failed")
+	}
+
+	if cap(dec.data) > 1024 {
+		t.Fatal("buffer must not be allocated by the declared length", cap(dec.data))
+	}
+
+	next := en.Write([]byte("next"))
+
+	dec = Decode{}
+	dec.Write(next[:2])
+
+	if list, err = dec.Write(next[2:]); err != nil || len(list) != 1 || string(list[0]) != "next" {
+		t.Fatal("frame split between writes expected")
+	}
+}
@@ -13,9 +13,9 @@ func TestEncodeDecode(t *testing.T) {
 
 		res := en.Write([]byte(msg))
 
-		list := dec.Write(res)
+		list, err := dec.Write(res)
 
-		if len(list) != 1 {
+		if err != nil || len(list) != 1 {
 			t.Fatal("Encode/Decode failed")
 		}
 
@@ -27,3 +27,71 @@ func TestEncodeDecode(t *testing.T) {
 	tF("hello")
 	tF("Привет")
 }
+
+func TestDecodeStream(t *testing.T) {
+
+	en := Encode{}
+	dec := Decode{}
+
+	var stream []byte
+
+	msgs := []string{"first", "", "second", "third message"}
+
+	for _, m := range msgs {
+		stream = append(stream, en.Write([]byte(m))...)
+	}
+
+	var list [][]byte
+
+	for i := 0; i < len(stream); i += 3 {
+		end := i + 3
+		if end > len(stream) {
+			end = len(stream)
+		}
+
+		res, err := dec.Write(stream[i:end])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		list = append(list, res...)
+	}
+
+	if len(list) != len(msgs) {
+		t.Fatal("invalid frames number")
+	}
+
+	for i, m := range msgs {
+		if string(list[i]) != m {
+			t.Fatal("invalid decoded value")
+		}
+	}
+}
+
+func TestDecodeLimits(t *testing.T) {
+
+	tF := func(data []byte, max int) {
+		dec := Decode{MaxSize: max}
+
+		if _, err := dec.Write(data); err == nil {
+			t.Fatal("error expected")
+		} else if _, ok := err.(*FrameError); !ok {
+			t.Fatal("FrameError expected")
+		}
+
+		if _, err := dec.Write([]byte{0, 0, 0, 0}); err == nil {
+			t.Fatal("broken decoder must return error")
+		}
+	}
+
+	tF([]byte{0xff, 0xff, 0xff, 0xf0}, 0)
+	tF([]byte{0, 0, 1, 0}, 255)
+	tF([]byte{0x10, 0, 0, 0}, 0)
+
+	en := Encode{}
+	dec := Decode{MaxSize: 5}
+
+	if list, err := dec.Write(en.Write([]byte("12345"))); err != nil || len(list) != 1 {
+		t.Fatal("frame of max size must be accepted")
+	}
+}
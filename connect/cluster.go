@@ -1,5 +1,9 @@
 package connect
 
+import (
+	"context"
+)
+
 type Cluster interface {
 	Set(key, subkey []byte, value interface{}, sync bool)
 	SetIfMore(key, subkey []byte, value int64, sync bool) int64
@@ -30,3 +34,46 @@ type Cluster interface {
 	ZRangeSize(key []byte, min, max int64) int64
 	Status() bool
 }
+
+// ClusterV2 reports failures: every method waits for the response and
+// returns an error if the node is not available, the server rejected the
+// request or ctx is done. Write methods are always synchronous.
+//
+// Conn, Proxy and Stub implement both interfaces, so Cluster returned by
+// NewProxy or NewStub may be converted by type assertion.
+type ClusterV2 interface {
+	SetContext(ctx context.Context, key, subkey []byte, value interface{}) error
+	SetIfMoreContext(ctx context.Context, key, subkey []byte, value int64) (int64, error)
+	BitAndContext(ctx context.Context, key, subkey []byte, value int64) (int64, error)
+	BitAndNotContext(ctx context.Context, key, subkey []byte, value int64) (int64, error)
+	BitOrContext(ctx context.Context, key, subkey []byte, value int64) (int64, error)
+	BitXorContext(ctx context.Context, key, subkey []byte, value int64) (int64, error)
+	SetNXContext(ctx context.Context, key, subkey []byte, value interface{}) (bool, error)
+	GetContext(ctx context.Context, key, subkey []byte) ([]byte, bool, error)
+	GetIntContext(ctx context.Context, key, subkey []byte) (int64, error)
+	HasContext(ctx context.Context, key, subkey []byte) (bool, error)
+	DelContext(ctx context.Context, key, subkey []byte) (bool, error)
+	IncContext(ctx context.Context, key, subkey []byte, val int64) (int64, error)
+	DecContext(ctx context.Context, key, subkey []byte, val int64) (int64, error)
+	SeqAddContext(ctx context.Context, seq []byte, value interface{}) error
+	HKillContext(ctx context.Context, key []byte) error
+	SeqKillContext(ctx context.Context, seq []byte) error
+	HKeysAllContext(ctx context.Context, key []byte) ([][]byte, error)
+	HAllContext(ctx context.Context, key []byte) ([]Pair, error)
+	HKeysContext(ctx context.Context, key []byte, limit, offset int64) ([][]byte, error)
+	HKeysRandContext(ctx context.Context, key []byte, limit int64) ([][]byte, error)
+	SeqRangeContext(ctx context.Context, seq []byte, limit, offset int64) ([][]byte, error)
+	HSizeContext(ctx context.Context, key []byte) (int64, error)
+	KeyTotalContext(ctx context.Context, n int) (int64, error)
+	SeqSizeContext(ctx context.Context, seq []byte) (int64, error)
+	ZKillContext(ctx context.Context, key []byte) error
+	ZRangeContext(ctx context.Context, key []byte, limit, offset, min, max int64) ([]ZRec, error)
+	ZRangeSizeContext(ctx context.Context, key []byte, min, max int64) (int64, error)
+	StatusContext(ctx context.Context) error
+}
+
+var (
+	_ ClusterV2 = (*Conn)(nil)
+	_ ClusterV2 = (*Proxy)(nil)
+	_ ClusterV2 = (*Stub)(nil)
+)
@@ -0,0 +1,249 @@
+package connect
+
+import (
+	"context"
+	"time"
+
+	"github.com/lj-team/go-generic/encode/pack"
+	"github.com/lj-team/lcluster/pb"
+)
+
+// ClusterV2 methods of Conn
+
+func (n *Conn) ivalue(ctx context.Context, code pb.LCPROTO_Code, key []byte, value int64) (int64, error) {
+
+	msg := &pb.LCPROTO{
+		Code:   code,
+		Key:    key,
+		Ivalue: value,
+		Sync:   true,
+	}
+
+	// the result of not replicated write is returned too
+	r, err := n.callContext(ctx, msg)
+	if err != nil && err != ErrNotReplicated {
+		return 0, err
+	}
+
+	return r.Ivalue, err
+}
+
+func (n *Conn) list(ctx context.Context, code pb.LCPROTO_Code, key, value []byte) ([][]byte, error) {
+
+	msg := &pb.LCPROTO{
+		Code:  code,
+		Key:   key,
+		Value: value,
+	}
+
+	r, err := n.callContext(ctx, msg)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.List, nil
+}
+
+func (n *Conn) SetContext(ctx context.Context, key, subkey []byte, value interface{}) error {
+
+	msg := &pb.LCPROTO{
+		Code:  pb.LCPROTO_C_SET,
+		Key:   n.makeKey(key, subkey),
+		Value: pack.Encode(value),
+		Sync:  true,
+	}
+
+	_, err := n.callContext(ctx, msg)
+
+	return err
+}
+
+func (n *Conn) SetIfMoreContext(ctx context.Context, key, subkey []byte, value int64) (int64, error) {
+	return n.ivalue(ctx, pb.LCPROTO_C_SETIFMORE, n.makeKey(key, subkey), value)
+}
+
+func (n *Conn) BitAndContext(ctx context.Context, key, subkey []byte, value int64) (int64, error) {
+	return n.ivalue(ctx, pb.LCPROTO_C_BITAND, n.makeKey(key, subkey), value)
+}
+
+func (n *Conn) BitAndNotContext(ctx context.Context, key, subkey []byte, value int64) (int64, error) {
+	return n.ivalue(ctx, pb.LCPROTO_C_BITANDNOT, n.makeKey(key, subkey), value)
+}
+
+func (n *Conn) BitOrContext(ctx context.Context, key, subkey []byte, value int64) (int64, error) {
+	return n.ivalue(ctx, pb.LCPROTO_C_BITOR, n.makeKey(key, subkey), value)
+}
+
+func (n *Conn) BitXorContext(ctx context.Context, key, subkey []byte, value int64) (int64, error) {
+	return n.ivalue(ctx, pb.LCPROTO_C_BITXOR, n.makeKey(key, subkey), value)
+}
+
+func (n *Conn) SetNXContext(ctx context.Context, key, subkey []byte, value interface{}) (bool, error) {
+
+	msg := &pb.LCPROTO{
+		Code:  pb.LCPROTO_C_SETNX,
+		Key:   n.makeKey(key, subkey),
+		Value: pack.Encode(value),
+		Sync:  true,
+	}
+
+	r, err := n.callContext(ctx, msg)
+	if err != nil && err != ErrNotReplicated {
+		return false, err
+	}
+
+	return len(r.Value) > 0 && r.Value[0] != 0, err
+}
+
+// GetContext returns false if the key is not found. Nodes without the
+// found flag report empty values as not found
+func (n *Conn) GetContext(ctx context.Context, key, subkey []byte) ([]byte, bool, error) {
+
+	msg := &pb.LCPROTO{
+		Code: pb.LCPROTO_C_GET,
+		Key:  n.makeKey(key, subkey),
+	}
+
+	r, err := n.callContext(ctx, msg)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if r.Ivalue != 1 && len(r.Value) == 0 {
+		return nil, false, nil
+	}
+
+	return r.Value, true, nil
+}
+
+func (n *Conn) GetIntContext(ctx context.Context, key, subkey []byte) (int64, error) {
+	return n.ivalue(ctx, pb.LCPROTO_C_GETINT, n.makeKey(key, subkey), 0)
+}
+
+func (n *Conn) HasContext(ctx context.Context, key, subkey []byte) (bool, error) {
+	r, err := n.ivalue(ctx, pb.LCPROTO_C_HAS, n.makeKey(key, subkey), 0)
+	return r != 0, err
+}
+
+func (n *Conn) DelContext(ctx context.Context, key, subkey []byte) (bool, error) {
+	r, err := n.ivalue(ctx, pb.LCPROTO_C_DEL, n.makeKey(key, subkey), 0)
+	return r != 0, err
+}
+
+func (n *Conn) IncContext(ctx context.Context, key, subkey []byte, val int64) (int64, error) {
+	return n.ivalue(ctx, pb.LCPROTO_C_INC, n.makeKey(key, subkey), val)
+}
+
+func (n *Conn) DecContext(ctx context.Context, key, subkey []byte, val int64) (int64, error) {
+	return n.ivalue(ctx, pb.LCPROTO_C_DEC, n.makeKey(key, subkey), val)
+}
+
+func (n *Conn) SeqAddContext(ctx context.Context, seq []byte, value interface{}) error {
+	return n.SetContext(ctx, seq, pack.Encode(time.Now().UnixNano(), value), oneByte)
+}
+
+func (n *Conn) HKillContext(ctx context.Context, key []byte) error {
+	_, err := n.ivalue(ctx, pb.LCPROTO_C_HKILL, n.makeKey(key, nil), 0)
+	return err
+}
+
+func (n *Conn) SeqKillContext(ctx context.Context, seq []byte) error {
+	return n.HKillContext(ctx, seq)
+}
+
+func (n *Conn) HKeysAllContext(ctx context.Context, key []byte) ([][]byte, error) {
+	limit := int64(100)
+	offset := int64(0)
+	result := make([][]byte, 0, 100)
+
+	for {
+		res, err := n.HKeysContext(ctx, key, limit, offset)
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, res...)
+
+		if len(res) < int(limit) {
+			break
+		}
+
+		offset += limit
+	}
+
+	return result, nil
+}
+
+func (n *Conn) HAllContext(ctx context.Context, key []byte) ([]Pair, error) {
+	list, err := n.list(ctx, pb.LCPROTO_C_HALL, n.makeKey(key, nil), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return makePairs(list), nil
+}
+
+func (n *Conn) HKeysContext(ctx context.Context, key []byte, limit, offset int64) ([][]byte, error) {
+	return n.list(ctx, pb.LCPROTO_C_HKEYS, n.makeKey(key, nil), pack.Encode(limit, offset))
+}
+
+func (n *Conn) HKeysRandContext(ctx context.Context, key []byte, limit int64) ([][]byte, error) {
+	return n.list(ctx, pb.LCPROTO_C_HKEYSRAND, n.makeKey(key, nil), pack.Encode(limit))
+}
+
+func (n *Conn) SeqRangeContext(ctx context.Context, seq []byte, limit, offset int64) ([][]byte, error) {
+	list, err := n.HKeysContext(ctx, seq, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	return seqValues(list), nil
+}
+
+func (n *Conn) HSizeContext(ctx context.Context, key []byte) (int64, error) {
+	return n.ivalue(ctx, pb.LCPROTO_C_HSIZE, n.makeKey(key, nil), 0)
+}
+
+// KeyTotalContext ignores n, the connection is a single node
+func (n *Conn) KeyTotalContext(ctx context.Context, _ int) (int64, error) {
+	return n.ivalue(ctx, pb.LCPROTO_C_KEYTOTAL, nil, 0)
+}
+
+func (n *Conn) SeqSizeContext(ctx context.Context, seq []byte) (int64, error) {
+	return n.HSizeContext(ctx, seq)
+}
+
+func (n *Conn) ZKillContext(ctx context.Context, key []byte) error {
+	_, err := n.ivalue(ctx, pb.LCPROTO_C_ZKILL, n.makeKey(key, nil), 0)
+	return err
+}
+
+func (n *Conn) ZRangeContext(ctx context.Context, key []byte, limit, offset, min, max int64) ([]ZRec, error) {
+	list, err := n.list(ctx, pb.LCPROTO_C_ZRANGE, n.makeKey(key, nil), pack.Encode(limit, offset, min, max))
+	if err != nil {
+		return nil, err
+	}
+
+	return makeZRecs(list), nil
+}
+
+func (n *Conn) ZRangeSizeContext(ctx context.Context, key []byte, min, max int64) (int64, error) {
+
+	msg := &pb.LCPROTO{
+		Code:  pb.LCPROTO_C_ZRANGESIZE,
+		Key:   n.makeKey(key, nil),
+		Value: pack.Encode(min, max),
+	}
+
+	r, err := n.callContext(ctx, msg)
+	if err != nil {
+		return 0, err
+	}
+
+	return r.Ivalue, nil
+}
+
+func (n *Conn) StatusContext(ctx context.Context) error {
+	_, err := n.callContext(ctx, &pb.LCPROTO{Code: pb.LCPROTO_C_NOP})
+	return err
+}
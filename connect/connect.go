@@ -1,6 +1,9 @@
 package connect
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
 	"net"
 
 	"github.com/golang/protobuf/proto"
@@ -14,30 +17,54 @@ import (
 	"time"
 )
 
+var ErrNotConnected = errors.New("not connected")
+var ErrBroken = errors.New("connection broken")
+var ErrAuth = errors.New("authentication failed")
+var ErrBusy = errors.New("server busy")
+var ErrTimeout = errors.New("response timeout")
+var ErrInvalidResponse = errors.New("invalid response")
+
+// ErrPooled is returned by Read of the pool connection: it is shared by
+// requests, so responses to Send can not be told apart
+var ErrPooled = errors.New("pool connection is shared")
+
+// ErrNotReplicated is returned with the response if the write is applied
+// by the node but is not confirmed by enough replicas in time
+var ErrNotReplicated = errors.New("write is not confirmed by replicas")
+
+// Conn is safe for concurrent use: every request gets an id and the
+// response is matched by the id, so several requests may be in flight
 type Conn struct {
 	addr      string
 	last_time int64
 	last_try  int64
-	conn      net.Conn
+	link      *link
 	encoder   codecs.Encode
-	decoder   codecs.Decode
-	buffer    []byte
-	keybuf    []byte
 	pool      *Pool
 	unret     int
+	nextId    uint64
+	orphans   chan *pb.LCPROTO
+	opts      Options
+	mt        sync.Mutex
 	sync.Mutex
 }
 
 func NewConn(addr string) *Conn {
+	return NewConnWithOptions(addr, nil)
+}
+
+func NewConnWithOptions(addr string, opts *Options) *Conn {
 	n := &Conn{
 		addr:      addr,
 		last_time: 0,
 		last_try:  0,
 		encoder:   codecs.Encode{},
-		decoder:   codecs.Decode{},
-		buffer:    make([]byte, 40960),
-		keybuf:    make([]byte, 2560),
 		unret:     0,
+		orphans:   make(chan *pb.LCPROTO, ORPHANS_SIZE),
+	}
+
+	if opts != nil {
+		n.opts = *opts
 	}
 
 	return n
@@ -46,51 +73,160 @@ func NewConn(addr string) *Conn {
 var oneByte = []byte{1}
 
 func (n *Conn) KeepAlive() bool {
+	n.mt.Lock()
+	defer n.mt.Unlock()
+
+	return n.keepAlive()
+}
 
-	if time.Now().Unix()-n.last_time > 60 && n.conn != nil {
+func (n *Conn) keepAlive() bool {
+
+	if time.Now().Unix()-n.last_time > 60 && n.link != nil {
 		log.Trace("close connect to " + n.addr + " by timeout")
-		n.conn.Close()
-		n.conn = nil
+		n.link.close()
+		n.link = nil
 		n.unret = 0
 	}
 
-	var err error
+	if n.link != nil && n.link.broken() {
+		n.link = nil
+		n.unret = 0
+	}
 
-	if n.conn == nil && time.Now().Unix()-n.last_try > 5 {
+	if n.link == nil && time.Now().Unix()-n.last_try > 5 {
 		log.Trace("try connect " + n.addr)
 		n.unret = 0
 		n.last_try = time.Now().Unix()
 		n.last_time = n.last_try
-		n.decoder = codecs.Decode{}
-		n.conn, err = net.Dial("tcp", n.addr)
+		conn, err := n.dial()
 		if err != nil {
 			log.Trace("connect to " + n.addr + " failed")
-			n.conn = nil
+		} else {
+			n.link = newLink(conn, n.orphans)
+
+			if err = n.handshake(); err != nil {
+				log.Error("auth on " + n.addr + " failed: " + err.Error())
+				n.link.close()
+				n.link = nil
+			}
 		}
 	}
 
-	return n.conn != nil
+	return n.link != nil
 }
 
-func (n *Conn) send(pm *pb.LCPROTO) bool {
+// handshake authenticates new connection, n.mt must be locked
+func (n *Conn) handshake() error {
 
-	if n.unret >= NOP_AFTER {
-		n.Nop()
+	if !n.opts.Auth.Enabled() {
+		return nil
+	}
+
+	wait := make(chan *pb.LCPROTO, 1)
+
+	n.nextId++
+	pm := n.opts.Auth.Request()
+	pm.Id = n.nextId
+
+	if !n.link.expect(pm.Id, wait) {
+		return ErrBroken
 	}
 
 	data, _ := proto.Marshal(pm)
 
-	msg := n.encoder.Write(data)
+	if _, err := n.link.conn.Write(n.encoder.Write(data)); err != nil {
+		return err
+	}
+
+	select {
+	case r := <-wait:
+		if r == nil || r.Ivalue != 1 {
+			return ErrAuth
+		}
+	case <-time.After(AUTH_TIMEOUT):
+		return ErrAuth
+	}
+
+	return nil
+}
+
+func (n *Conn) dial() (net.Conn, error) {
+
+	dialer := &net.Dialer{Timeout: n.opts.dialTimeout()}
+
+	if n.opts.TLS != nil {
+		return tls.DialWithDialer(dialer, "tcp", n.addr, n.opts.TLS)
+	}
+
+	return dialer.Dial("tcp", n.addr)
+}
+
+// reset closes the link after timeout, the next request reconnects
+func (n *Conn) reset(l *link) {
+	n.mt.Lock()
+	if n.link == l {
+		n.link = nil
+		n.unret = 0
+	}
+	n.mt.Unlock()
+
+	l.close()
+}
+
+func (n *Conn) Close() {
+	n.mt.Lock()
+	defer n.mt.Unlock()
+
+	if n.link != nil {
+		n.link.close()
+		n.link = nil
+	}
+}
+
+// post writes request to connection. If expect is set the response
+// will be delivered into the returned channel, the link is returned to
+// forget the request. Every attempt gets its own channel, as closing the
+// failed link closes it. Writing is limited by WriteTimeout and ctx
+// deadline
+func (n *Conn) post(ctx context.Context, pm *pb.LCPROTO, expect bool) (*link, chan *pb.LCPROTO, error) {
+
+	n.mt.Lock()
+	defer n.mt.Unlock()
 
 	for i := 0; i < 2; i++ {
-		if !n.KeepAlive() {
+		if !n.keepAlive() {
 			continue
 		}
 
-		wt, err := n.conn.Write(msg)
+		n.nextId++
+		pm.Id = n.nextId
+
+		data, _ := proto.Marshal(pm)
+		msg := n.encoder.Write(data)
+
+		l := n.link
+
+		var wait chan *pb.LCPROTO
+
+		if expect {
+			wait = make(chan *pb.LCPROTO, 1)
+
+			if !l.expect(pm.Id, wait) {
+				n.link = nil
+				continue
+			}
+		}
+
+		deadline := time.Now().Add(n.opts.writeTimeout())
+		if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+			deadline = d
+		}
+		l.conn.SetWriteDeadline(deadline)
+
+		wt, err := l.conn.Write(msg)
 		if err == nil && wt == len(msg) {
 			n.last_time = time.Now().Unix()
-			return true
+			return l, wait, nil
 		}
 
 		if wt < len(msg) {
@@ -101,70 +237,235 @@ func (n *Conn) send(pm *pb.LCPROTO) bool {
 			}
 		}
 
-		n.conn.Close()
-		n.conn = nil
+		l.close()
+		n.link = nil
 	}
 
-	return false
+	return nil, nil, ErrNotConnected
 }
 
-func (n *Conn) Read() *pb.LCPROTO {
+func (n *Conn) send(pm *pb.LCPROTO) bool {
 
-	n.unret = 0
+	if _, _, err := n.post(context.Background(), pm, false); err != nil {
+		return false
+	}
+
+	n.mt.Lock()
+	n.unret++
+	nop := n.unret >= n.opts.nopAfter()
+	n.mt.Unlock()
+
+	if nop {
+		n.Nop()
+	}
+
+	return true
+}
+
+// call sends request and waits for the response
+func (n *Conn) call(pm *pb.LCPROTO) (*pb.LCPROTO, error) {
+	return n.callContext(context.Background(), pm)
+}
+
+// callContext sends request and waits for the response until ctx is done.
+// Redirects and writes rejected by replica are followed if the connection
+// belongs to the Proxy pool
+func (n *Conn) callContext(ctx context.Context, pm *pb.LCPROTO) (*pb.LCPROTO, error) {
+
+	r, err := n.roundTrip(ctx, pm)
+
+	if (r.Redirect() || r != nil && r.ErrCode == pb.ERR_READONLY) && n.pool != nil && n.pool.redirect != nil {
+		return n.pool.redirect(ctx, n.addr, pm, r)
+	}
+
+	return r, err
+}
+
+// roundTrip sends request and waits for the response until ctx is done.
+// If the node does not answer in Timeout the connection is reset
+func (n *Conn) roundTrip(ctx context.Context, pm *pb.LCPROTO) (*pb.LCPROTO, error) {
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if n.opts.Acks > 0 && pm.Sync && pm.Acks == 0 && pm.Code.Mutating() {
+		pm.Acks = int32(n.opts.Acks)
+	}
+
+	l, wait, err := n.post(ctx, pm, true)
+	if err != nil {
+		return nil, err
+	}
 
-	if n.conn == nil {
+	timeout, stop := n.timer()
+	defer stop()
+
+	var r *pb.LCPROTO
+
+	select {
+	case r = <-wait:
+	case <-ctx.Done():
+		l.forget(pm.Id)
+		return nil, ctx.Err()
+	case <-timeout:
+		log.Warn(n.addr + ": " + pm.Code.String() + ": no response, reset connection")
+		n.reset(l)
+		return nil, ErrTimeout
+	}
+
+	if r == nil {
+		return nil, ErrBroken
+	}
+
+	if r.Code == pb.LCPROTO_BUSY {
+		return nil, ErrBusy
+	}
+
+	// the response is returned too, proxy passes it to the client
+	if err := r.Err(); err != nil {
+		return r, err
+	}
+
+	// the write is applied by the node, but not by enough replicas
+	if r.Async {
+		return r, ErrNotReplicated
+	}
+
+	return r, nil
+}
+
+// exec sends request and waits for the response if wait is set
+func (n *Conn) exec(pm *pb.LCPROTO, wait bool) *pb.LCPROTO {
+
+	if !wait {
+		n.send(pm)
 		return nil
 	}
 
-	for i := 0; i < 5; i++ {
-		num, err := n.conn.Read(n.buffer)
-		if err != nil {
-			n.conn.Close()
-			n.conn = nil
-			return nil
-		}
+	r, err := n.call(pm)
+	if err == ErrNotReplicated {
+		log.Warn(n.addr + ": " + pm.Code.String() + ": " + err.Error())
+		return r
+	}
 
-		var list [][]byte
-		list = n.decoder.Write(n.buffer[:num])
-		if len(list) > 0 {
-			num = len(list) - 1
-			var msg pb.LCPROTO
-			if err = proto.Unmarshal(list[num], &msg); err != nil {
-				n.conn.Close()
-				n.conn = nil
-				return nil
-			}
-			return &msg
+	if err != nil {
+		if _, ok := err.(*pb.Error); ok {
+			log.Warn(n.addr + ": " + pm.Code.String() + ": " + err.Error())
+		} else {
+			log.Trace(n.addr + ": " + err.Error())
 		}
+		return nil
 	}
 
-	n.conn.Close()
-	n.conn = nil
-	return nil
+	return r
+}
+
+// Call sends request and waits for the response. Errors reported by
+// the server are returned as *pb.Error
+func (n *Conn) Call(pm *pb.LCPROTO) (*pb.LCPROTO, error) {
+	return n.call(pm)
+}
+
+// Post sends request without waiting for the response
+func (n *Conn) Post(pm *pb.LCPROTO) bool {
+	return n.send(pm)
+}
+
+// timer returns channel closed after Timeout, nil if timeout is disabled
+func (n *Conn) timer() (<-chan time.Time, func() bool) {
+	timeout := n.opts.timeout()
+
+	if timeout < 0 {
+		return nil, func() bool { return false }
+	}
+
+	t := time.NewTimer(timeout)
+
+	return t.C, t.Stop
+}
+
+// Read returns response to a request sent by Send, connections of Pool
+// do not support it
+func (n *Conn) Read() *pb.LCPROTO {
+	r, err := n.ReadContext(context.Background())
+	if err != nil {
+		log.Trace(n.addr + ": " + err.Error())
+	}
+	return r
+}
+
+// ReadContext returns response to a request sent by Send. If nothing is
+// received in Timeout the connection is reset
+func (n *Conn) ReadContext(ctx context.Context) (*pb.LCPROTO, error) {
+
+	if n.pool != nil {
+		return nil, ErrPooled
+	}
+
+	n.mt.Lock()
+	n.unret = 0
+	l := n.link
+	n.mt.Unlock()
+
+	if l == nil {
+		return nil, ErrNotConnected
+	}
+
+	timeout, stop := n.timer()
+	defer stop()
+
+	select {
+	case r := <-n.orphans:
+		return r, nil
+	case <-l.done:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-timeout:
+		n.reset(l)
+		return nil, ErrTimeout
+	}
+
+	select {
+	case r := <-n.orphans:
+		return r, nil
+	default:
+	}
+
+	return nil, ErrBroken
 }
 
 func (n *Conn) makeKey(key, subkey []byte) []byte {
 	size := 1 + len(key)
 
-	n.keybuf[0] = byte(size)
-	copy(n.keybuf[1:], key)
+	keybuf := make([]byte, size+len(subkey))
+
+	keybuf[0] = byte(size)
+	copy(keybuf[1:], key)
 
 	if subkey == nil {
-		return n.keybuf[:size]
+		return keybuf[:size]
 	}
 
-	copy(n.keybuf[size:], subkey)
+	copy(keybuf[size:], subkey)
 	size += len(subkey)
 
 	if size > 512 {
 		size = 512
 	}
 
-	return n.keybuf[:size]
+	return keybuf[:size]
 }
 
+// Send writes the request, its response is returned by Read. Connections
+// of Pool do not send it, use Do or Call
 func (n *Conn) Send(command pb.LCPROTO_Code, key, subkey, value []byte) {
 
+	if n.pool != nil {
+		log.Error(n.addr + ": " + command.String() + ": " + ErrPooled.Error())
+		return
+	}
+
 	msg := &pb.LCPROTO{
 		Code:    command,
 		Key:     n.makeKey(key, subkey),
@@ -172,7 +473,7 @@ func (n *Conn) Send(command pb.LCPROTO_Code, key, subkey, value []byte) {
 		Counter: 0,
 	}
 
-	n.send(msg)
+	n.post(context.Background(), msg, false)
 }
 
 func (n *Conn) Set(key, subkey []byte, value interface{}, sync bool) {
@@ -184,11 +485,7 @@ func (n *Conn) Set(key, subkey []byte, value interface{}, sync bool) {
 		Sync:  sync,
 	}
 
-	n.send(msg)
-
-	if sync {
-		n.Read()
-	}
+	n.exec(msg, sync)
 }
 
 func (n *Conn) BitAnd(key, subkey []byte, value int64, sync bool) int64 {
@@ -200,10 +497,9 @@ func (n *Conn) BitAnd(key, subkey []byte, value int64, sync bool) int64 {
 		Sync:   sync,
 	}
 
-	n.send(msg)
+	r := n.exec(msg, sync)
 
 	if sync {
-		r := n.Read()
 		return r.GetIvalue()
 	}
 
@@ -219,10 +515,9 @@ func (n *Conn) BitAndNot(key, subkey []byte, value int64, sync bool) int64 {
 		Sync:   sync,
 	}
 
-	n.send(msg)
+	r := n.exec(msg, sync)
 
 	if sync {
-		r := n.Read()
 		return r.GetIvalue()
 	}
 
@@ -238,10 +533,9 @@ func (n *Conn) BitOr(key, subkey []byte, value int64, sync bool) int64 {
 		Sync:   sync,
 	}
 
-	n.send(msg)
+	r := n.exec(msg, sync)
 
 	if sync {
-		r := n.Read()
 		return r.GetIvalue()
 	}
 
@@ -257,10 +551,9 @@ func (n *Conn) BitXor(key, subkey []byte, value int64, sync bool) int64 {
 		Sync:   sync,
 	}
 
-	n.send(msg)
+	r := n.exec(msg, sync)
 
 	if sync {
-		r := n.Read()
 		return r.GetIvalue()
 	}
 
@@ -275,10 +568,9 @@ func (n *Conn) SetNX(key, subkey []byte, val interface{}, sync bool) bool {
 		Sync:  sync,
 	}
 
-	n.send(msg)
+	r := n.exec(msg, sync)
 
 	if sync {
-		r := n.Read()
 
 		if r != nil && r.Value != nil && len(r.Value) > 0 {
 			return r.Value[0] != 0
@@ -299,10 +591,9 @@ func (n *Conn) SetIfMore(key, subkey []byte, val int64, sync bool) int64 {
 		Sync:   sync,
 	}
 
-	n.send(msg)
+	r := n.exec(msg, sync)
 
 	if sync {
-		r := n.Read()
 		return r.GetIvalue()
 	}
 
@@ -317,10 +608,9 @@ func (n *Conn) Del(key, subkey []byte, sync bool) bool {
 		Sync: sync,
 	}
 
-	n.send(msg)
+	r := n.exec(msg, sync)
 
 	if sync {
-		r := n.Read()
 		return r.GetIvalue() != 0
 	}
 
@@ -332,10 +622,11 @@ func (n *Conn) Nop() {
 		Code: pb.LCPROTO_C_NOP,
 	}
 
+	n.mt.Lock()
 	n.unret = 0
+	n.mt.Unlock()
 
-	n.send(msg)
-	n.Read()
+	n.exec(msg, true)
 }
 
 func (n *Conn) Get(key, subkey []byte) []byte {
@@ -345,8 +636,7 @@ func (n *Conn) Get(key, subkey []byte) []byte {
 		Key:  n.makeKey(key, subkey),
 	}
 
-	n.send(msg)
-	r := n.Read()
+	r := n.exec(msg, true)
 
 	if r != nil && r.Value != nil && len(r.Value) > 0 {
 		return r.Value
@@ -362,8 +652,7 @@ func (n *Conn) Has(key, subkey []byte) bool {
 		Key:  n.makeKey(key, subkey),
 	}
 
-	n.send(msg)
-	r := n.Read()
+	r := n.exec(msg, true)
 
 	return r.GetIvalue() != 0
 }
@@ -375,8 +664,7 @@ func (n *Conn) GetInt(key, subkey []byte) int64 {
 		Key:  n.makeKey(key, subkey),
 	}
 
-	n.send(msg)
-	r := n.Read()
+	r := n.exec(msg, true)
 
 	if r != nil {
 		return r.Ivalue
@@ -394,10 +682,9 @@ func (n *Conn) Inc(key, subkey []byte, val int64, sync bool) int64 {
 		Sync:   sync,
 	}
 
-	n.send(msg)
+	r := n.exec(msg, sync)
 
 	if sync {
-		r := n.Read()
 		return r.GetIvalue()
 	}
 
@@ -413,10 +700,9 @@ func (n *Conn) Dec(key, subkey []byte, val int64, sync bool) int64 {
 		Sync:   sync,
 	}
 
-	n.send(msg)
+	r := n.exec(msg, sync)
 
 	if sync {
-		r := n.Read()
 		return r.GetIvalue()
 	}
 
@@ -424,8 +710,14 @@ func (n *Conn) Dec(key, subkey []byte, val int64, sync bool) int64 {
 }
 
 func (n *Conn) Do(command pb.LCPROTO_Code, key, subkey, value []byte) *pb.LCPROTO {
-	n.Send(command, key, subkey, value)
-	return n.Read()
+
+	msg := &pb.LCPROTO{
+		Code:  command,
+		Key:   n.makeKey(key, subkey),
+		Value: value,
+	}
+
+	return n.exec(msg, true)
 }
 
 func (n *Conn) Release() {
@@ -434,10 +726,12 @@ func (n *Conn) Release() {
 	}
 }
 
-func (n *Conn) Log(key, value []byte, counter int) {
+// Log sends the change with LOG_* operation in counter, false is
+// returned if it is not sent
+func (n *Conn) Log(key, value []byte, counter int) bool {
 
 	if n == nil {
-		return
+		return false
 	}
 
 	msg := &pb.LCPROTO{
@@ -447,7 +741,7 @@ func (n *Conn) Log(key, value []byte, counter int) {
 		Counter: int32(counter),
 	}
 
-	n.send(msg)
+	return n.send(msg)
 }
 
 func (n *Conn) SeqAdd(seq []byte, value interface{}, sync bool) {
@@ -462,11 +756,7 @@ func (n *Conn) HKill(key []byte, sync bool) {
 		Sync: sync,
 	}
 
-	n.send(msg)
-
-	if sync {
-		n.Read()
-	}
+	n.exec(msg, sync)
 }
 
 func (n *Conn) SeqKill(seq []byte, sync bool) {
@@ -503,8 +793,7 @@ func (n *Conn) KeyTotal() int64 {
 		Code: pb.LCPROTO_C_KEYTOTAL,
 	}
 
-	n.send(msg)
-	r := n.Read()
+	r := n.exec(msg, true)
 
 	return r.GetIvalue()
 }
@@ -515,8 +804,7 @@ func (n *Conn) HSize(key []byte) int64 {
 		Key:  n.makeKey(key, nil),
 	}
 
-	n.send(msg)
-	r := n.Read()
+	r := n.exec(msg, true)
 
 	return r.GetIvalue()
 }
@@ -532,8 +820,7 @@ func (n *Conn) HKeys(key []byte, limit, offset int64) [][]byte {
 		Value: pack.Encode(limit, offset),
 	}
 
-	n.send(msg)
-	r := n.Read()
+	r := n.exec(msg, true)
 
 	if r != nil && r.List != nil && len(r.List) > 0 {
 		return r.List
@@ -548,17 +835,10 @@ func (n *Conn) HAll(hash []byte) []Pair {
 		Key:  n.makeKey(hash, nil),
 	}
 
-	n.send(msg)
-	r := n.Read()
+	r := n.exec(msg, true)
 
-	if r != nil && r.List != nil && len(r.List) > 0 {
-		size := len(r.List) / 2
-		result := make([]Pair, size)
-		for i := 0; i < size; i++ {
-			result[i].Key = r.List[i*2]
-			result[i].Value = r.List[i*2+1]
-		}
-		return result
+	if r != nil {
+		return makePairs(r.List)
 	}
 
 	return nil
@@ -571,8 +851,7 @@ func (n *Conn) HKeysRand(key []byte, limit int64) [][]byte {
 		Value: pack.Encode(limit),
 	}
 
-	n.send(msg)
-	r := n.Read()
+	r := n.exec(msg, true)
 
 	if r != nil && r.List != nil && len(r.List) > 0 {
 		return r.List
@@ -582,22 +861,23 @@ func (n *Conn) HKeysRand(key []byte, limit int64) [][]byte {
 }
 
 func (n *Conn) SeqRange(seq []byte, limit, offset int64) [][]byte {
-	list := n.HKeys(seq, limit, offset)
-
-	if list != nil && len(list) > 0 {
-		var res [][]byte
-		for _, v := range list {
-			if len(v) > 8 {
-				if res == nil {
-					res = make([][]byte, 0, len(list))
-				}
-				res = append(res, v[8:])
+	return seqValues(n.HKeys(seq, limit, offset))
+}
+
+// seqValues strips timestamps from sequence keys
+func seqValues(list [][]byte) [][]byte {
+	var res [][]byte
+
+	for _, v := range list {
+		if len(v) > 8 {
+			if res == nil {
+				res = make([][]byte, 0, len(list))
 			}
+			res = append(res, v[8:])
 		}
-		return res
 	}
 
-	return nil
+	return res
 }
 
 func (n *Conn) ZKill(key []byte, sync bool) {
@@ -608,11 +888,7 @@ func (n *Conn) ZKill(key []byte, sync bool) {
 		Sync: sync,
 	}
 
-	n.send(msg)
-
-	if sync {
-		n.Read()
-	}
+	n.exec(msg, sync)
 }
 
 func (n *Conn) ZRange(key []byte, limit, offset, min, max int64) []ZRec {
@@ -623,18 +899,10 @@ func (n *Conn) ZRange(key []byte, limit, offset, min, max int64) []ZRec {
 		Value: pack.Encode(limit, offset, min, max),
 	}
 
-	n.send(msg)
-	r := n.Read()
+	r := n.exec(msg, true)
 
 	if r != nil && r.List != nil && len(r.List)%2 == 0 {
-		res := make([]ZRec, len(r.List)/2)
-
-		for i := 0; i < len(r.List); i += 2 {
-			res[i/2].Key = r.List[i]
-			res[i/2].Value = pack.Bytes2Int(r.List[i+1])
-		}
-
-		return res
+		return makeZRecs(r.List)
 	}
 
 	return nil
@@ -648,8 +916,7 @@ func (n *Conn) ZRangeSize(key []byte, min, max int64) int64 {
 		Value: pack.Encode(min, max),
 	}
 
-	n.send(msg)
-	r := n.Read()
+	r := n.exec(msg, true)
 
 	return r.GetIvalue()
 }
@@ -0,0 +1,189 @@
+package connect
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/lj-team/lcluster/codecs"
+	"github.com/lj-team/lcluster/pb"
+)
+
+// fakeNode answers C_GETINT with key length, longer keys are answered first
+func fakeNode(t *testing.T) net.Listener {
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+
+			go func() {
+				defer conn.Close()
+
+				var mt sync.Mutex
+				encoder := codecs.Encode{}
+				decoder := codecs.Decode{}
+				buffer := make([]byte, 4096)
+
+				for {
+					n, err := conn.Read(buffer)
+					if err != nil {
+						return
+					}
+
+					list, _ := decoder.Write(buffer[:n])
+
+					for _, rec := range list {
+						var msg pb.LCPROTO
+						proto.Unmarshal(rec, &msg)
+
+						go func(msg *pb.LCPROTO) {
+							<-time.After(time.Duration(50-len(msg.Key)) * time.Millisecond)
+							res, _ := proto.Marshal(&pb.LCPROTO{Code: pb.LCPROTO_RESP, Id: msg.Id, Ivalue: int64(len(msg.Key))})
+							mt.Lock()
+							conn.Write(encoder.Write(res))
+							mt.Unlock()
+						}(&msg)
+					}
+				}
+			}()
+		}
+	}()
+
+	return ln
+}
+
+func TestConnMultiplex(t *testing.T) {
+
+	ln := fakeNode(t)
+	defer ln.Close()
+
+	con := NewConn(ln.Addr().String())
+	defer con.Close()
+
+	var wg sync.WaitGroup
+	failed := make(chan string, 20)
+
+	for i := 1; i <= 20; i++ {
+		wg.Add(1)
+
+		go func(key string) {
+			defer wg.Done()
+
+			if con.GetInt([]byte(key), nil) != int64(len(key)+1) {
+				failed <- key
+			}
+		}(strings.Repeat("k", i))
+	}
+
+	wg.Wait()
+	close(failed)
+
+	for key := range failed {
+		t.Fatalf("invalid response for %s", key)
+	}
+}
+
+func TestConnContext(t *testing.T) {
+
+	ln := fakeNode(t)
+	defer ln.Close()
+
+	con := NewConn(ln.Addr().String())
+	defer con.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+
+	if _, err := con.GetIntContext(ctx, []byte("key"), nil); err != context.DeadlineExceeded {
+		t.Fatal("deadline must be reported")
+	}
+
+	if val, err := con.GetIntContext(context.Background(), []byte("key"), nil); err != nil || val != 4 {
+		t.Fatal("invalid response")
+	}
+
+	down := NewConn("127.0.0.1:1")
+
+	if _, _, err := down.GetContext(context.Background(), []byte("key"), nil); err != ErrNotConnected {
+		t.Fatal("unavailable node must be reported")
+	}
+}
+
+func TestConnTimeout(t *testing.T) {
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	// stalled node reads requests and never answers
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go io.Copy(ioutil.Discard, conn)
+		}
+	}()
+
+	con := NewConnWithOptions(ln.Addr().String(), &Options{Timeout: 20 * time.Millisecond})
+	defer con.Close()
+
+	if _, err := con.GetIntContext(context.Background(), []byte("key"), nil); err != ErrTimeout {
+		t.Fatal("timeout must be reported")
+	}
+
+	con.mt.Lock()
+	reset := con.link == nil
+	con.mt.Unlock()
+
+	if !reset {
+		t.Fatal("connection must be reset")
+	}
+}
+
+// failedWrite is connection the request can not be written to
+type failedWrite struct {
+	net.Conn
+}
+
+func (c failedWrite) Write(b []byte) (int, error) {
+	return 0, io.ErrClosedPipe
+}
+
+func TestConnRetry(t *testing.T) {
+
+	ln := fakeNode(t)
+	defer ln.Close()
+
+	con := NewConn(ln.Addr().String())
+	defer con.Close()
+
+	conn, peer := net.Pipe()
+	defer peer.Close()
+
+	// the request is registered on the link, writing fails and it is
+	// sent again over new connection
+	con.link = newLink(failedWrite{conn}, con.orphans)
+	con.last_time = time.Now().Unix()
+
+	if val, err := con.GetIntContext(context.Background(), []byte("key"), nil); err != nil || val != 4 {
+		t.Fatal("request must be retried", val, err)
+	}
+}
@@ -0,0 +1,262 @@
+package connect
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/lj-team/go-generic/log"
+	"github.com/lj-team/lcluster/pb"
+)
+
+// PromoteContext makes replica primary, its changes are replicated to
+// the comma separated addresses, the old primary first. Empty address
+// disables replication
+func (n *Conn) PromoteContext(ctx context.Context, replica string) error {
+
+	msg := &pb.LCPROTO{
+		Code:  pb.LCPROTO_PROMOTE,
+		Value: []byte(replica),
+	}
+
+	_, err := n.roundTrip(ctx, msg)
+
+	return err
+}
+
+// alive returns connection to node n if the node is connected, the time
+// the node is down is tracked for failover
+func (p *Proxy) alive(ctx context.Context, n int, pool *Pool) (*Conn, error) {
+
+	con, err := pool.GetContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	up := con.KeepAlive()
+
+	p.mt.RLock()
+	changed := n < len(p.pools) && p.pools[n] == pool && up != p.down[n].IsZero()
+	p.mt.RUnlock()
+
+	if changed {
+		p.mt.Lock()
+		if n < len(p.pools) && p.pools[n] == pool {
+			if up {
+				p.down[n] = time.Time{}
+			} else if p.down[n].IsZero() {
+				p.down[n] = time.Now()
+			}
+		}
+		p.mt.Unlock()
+	}
+
+	if !up {
+		con.Release()
+		return nil, ErrNotConnected
+	}
+
+	return con, nil
+}
+
+// FailoverContext promotes replica of the silent primary. The replica
+// refuses if it hears the primary during after or if it has other
+// topology of the epoch of t. Nil t is not checked
+func (n *Conn) FailoverContext(ctx context.Context, primary string, after time.Duration, t *Topology) (int64, error) {
+
+	msg := &pb.LCPROTO{
+		Code:   pb.LCPROTO_PROMOTE,
+		Value:  []byte(primary),
+		Ivalue: int64(after / time.Millisecond),
+	}
+
+	if t != nil {
+		msg.Key, _ = json.Marshal(t)
+	}
+
+	r, err := n.roundTrip(ctx, msg)
+	if r == nil {
+		return 0, err
+	}
+
+	return r.Ivalue, err
+}
+
+// admin runs f with a connection to the node authenticated by
+// AdminAuth, the pool is used if it is not set
+func (p *Proxy) admin(ctx context.Context, pool *Pool, f func(*Conn) error) error {
+
+	if p.opts == nil || p.opts.AdminAuth == nil {
+		return p.withContext(ctx, pool, f)
+	}
+
+	opts := *p.opts
+	opts.Auth = opts.AdminAuth
+
+	con := NewConnWithOptions(pool.Addr, &opts)
+	defer con.Close()
+
+	return f(con)
+}
+
+// failover promotes replica of node n if the node is down longer than
+// FailoverAfter. The replica decides, so proxies with different views of
+// the node agree: it is promoted once per topology epoch and only if it
+// does not hear the node too. It returns true if the node is replaced
+func (p *Proxy) failover(ctx context.Context, n int, pool *Pool) bool {
+
+	p.mt.Lock()
+
+	// replaced by other request
+	if n >= len(p.pools) || p.pools[n] != pool {
+		p.mt.Unlock()
+		return true
+	}
+
+	replica := p.replicas[n]
+	after := p.opts.failoverAfter()
+
+	if replica == nil || after < 0 || p.down[n].IsZero() || time.Since(p.down[n]) < after {
+		p.mt.Unlock()
+		return false
+	}
+
+	list := *p.nodes
+	list.Nodes = append([]NodeInfo{}, list.Nodes...)
+	list.Nodes[n].Addr, list.Nodes[n].Replica = replica.Addr, pool.Addr
+
+	epoch := p.epoch
+
+	p.mt.Unlock()
+
+	var t *Topology
+	if epoch > 0 {
+		t = NewTopology(epoch+1, &list)
+	}
+
+	var known int64
+
+	err := p.admin(ctx, replica, func(con *Conn) (e error) {
+		known, e = con.FailoverContext(ctx, pool.Addr, after, t)
+		return
+	})
+
+	if err != nil {
+		if e, ok := err.(*pb.Error); ok && e.Code == pb.ERR_REJECTED {
+			log.Trace("promote " + replica.Addr + ": " + err.Error())
+		} else {
+			log.Error("promote " + replica.Addr + ": " + err.Error())
+		}
+
+		// other proxy made failover first
+		if epoch > 0 && known > epoch {
+			p.checkTopology()
+		}
+
+		p.mt.RLock()
+		replaced := n >= len(p.pools) || p.pools[n] != pool
+		p.mt.RUnlock()
+
+		return replaced
+	}
+
+	p.mt.Lock()
+
+	if n < len(p.pools) && p.pools[n] == pool {
+		p.swap(n)
+
+		if epoch > 0 && p.epoch == epoch {
+			p.epoch++
+		}
+	}
+
+	p.mt.Unlock()
+
+	log.Warn("node " + pool.Addr + " is down, replica " + replica.Addr + " is promoted")
+
+	// other proxies made by seeds follow the topology
+	if t != nil {
+		go p.publish(t)
+	}
+
+	return true
+}
+
+// swap makes the replica of node n primary. p.mt must be locked
+func (p *Proxy) swap(n int) {
+
+	list := *p.nodes
+	list.Nodes = append([]NodeInfo{}, list.Nodes...)
+	list.Nodes[n].Addr, list.Nodes[n].Replica = list.Nodes[n].Replica, list.Nodes[n].Addr
+
+	p.pools[n], p.replicas[n] = p.replicas[n], p.pools[n]
+	p.down[n] = time.Time{}
+	p.nodes = &list
+	p.list, _ = json.Marshal(&list)
+}
+
+// follow returns pool of the primary of replica addr, nil if it is not
+// known. Proxy made by seeds gets the topology, others swap the node and
+// its replica if the replica is the primary now, so failover made by
+// other proxy or by hand is followed
+func (p *Proxy) follow(addr, primary string) *Pool {
+
+	p.mt.RLock()
+	epoch := p.epoch
+	p.mt.RUnlock()
+
+	if epoch > 0 {
+		p.checkTopology()
+	}
+
+	p.mt.Lock()
+	defer p.mt.Unlock()
+
+	for n, pool := range p.pools {
+		replica := p.replicas[n]
+
+		if replica == nil {
+			continue
+		}
+
+		// replaced by topology or other request
+		if replica.Addr == addr {
+			return pool
+		}
+
+		if pool.Addr == addr && replica.Addr == primary {
+			log.Warn("node " + addr + " is replica of " + primary + ", the node is replaced")
+			p.swap(n)
+			return replica
+		}
+	}
+
+	return nil
+}
+
+// publish saves topology on all nodes and replicas
+func (p *Proxy) publish(t *Topology) {
+
+	p.mt.RLock()
+	list := append(append([]*Pool{}, p.pools...), p.replicas...)
+	p.mt.RUnlock()
+
+	for _, pool := range list {
+		if pool == nil {
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), DefaultTimeout)
+
+		err := p.admin(ctx, pool, func(con *Conn) error {
+			_, e := con.SetTopologyContext(ctx, t)
+			return e
+		})
+
+		cancel()
+
+		if err != nil {
+			log.Trace("topology of " + pool.Addr + ": " + err.Error())
+		}
+	}
+}
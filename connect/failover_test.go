@@ -0,0 +1,117 @@
+package connect
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/lj-team/lcluster/pb"
+)
+
+func TestProxyFailover(t *testing.T) {
+
+	var hits, promoted int32
+
+	ln := handlerNode(t, &hits, func(msg *pb.LCPROTO) *pb.LCPROTO {
+		if msg.Code == pb.LCPROTO_PROMOTE && string(msg.Value) == "127.0.0.1:1" {
+			atomic.AddInt32(&promoted, 1)
+		}
+		return &pb.LCPROTO{Ivalue: 2}
+	})
+	defer ln.Close()
+
+	list := &NodeList{Nodes: []NodeInfo{{Addr: "127.0.0.1:1", Replica: ln.Addr().String()}}}
+
+	cl, _ := NewProxyFromList(list, &Options{FailoverAfter: time.Millisecond * 50})
+	px := cl.(*Proxy)
+	defer px.Close()
+
+	ctx := context.Background()
+
+	if res, err := px.GetIntContext(ctx, []byte("key"), nil); err != nil || res != 2 {
+		t.Fatal("replica must be read", err)
+	}
+
+	if err := px.SetContext(ctx, []byte("key"), nil, 1); err != ErrNotConnected {
+		t.Fatal("write must fail before failover", err)
+	}
+
+	time.Sleep(time.Millisecond * 60)
+
+	if err := px.SetContext(ctx, []byte("key"), nil, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	if atomic.LoadInt32(&promoted) != 1 {
+		t.Fatal("replica is not promoted")
+	}
+
+	if px.node(0).Addr != ln.Addr().String() {
+		t.Fatal("replica must be primary")
+	}
+}
+
+func TestProxyFailoverRejected(t *testing.T) {
+
+	var hits int32
+
+	ln := handlerNode(t, &hits, func(msg *pb.LCPROTO) *pb.LCPROTO {
+		if msg.Code == pb.LCPROTO_PROMOTE {
+			return pb.ErrorResponse(pb.ERR_REJECTED, "primary is alive")
+		}
+		return &pb.LCPROTO{}
+	})
+	defer ln.Close()
+
+	list := &NodeList{Nodes: []NodeInfo{{Addr: "127.0.0.1:1", Replica: ln.Addr().String()}}}
+
+	cl, _ := NewProxyFromList(list, &Options{FailoverAfter: time.Millisecond * 50})
+	px := cl.(*Proxy)
+	defer px.Close()
+
+	ctx := context.Background()
+
+	px.GetIntContext(ctx, []byte("key"), nil)
+
+	time.Sleep(time.Millisecond * 60)
+
+	if err := px.SetContext(ctx, []byte("key"), nil, 1); err != ErrNotConnected {
+		t.Fatal("write must fail", err)
+	}
+
+	if px.node(0).Addr != "127.0.0.1:1" {
+		t.Fatal("node must not be replaced")
+	}
+}
+
+func TestProxyFollowPrimary(t *testing.T) {
+
+	var hits int32
+
+	primary := handlerNode(t, &hits, func(msg *pb.LCPROTO) *pb.LCPROTO {
+		return &pb.LCPROTO{}
+	})
+	defer primary.Close()
+
+	old := handlerNode(t, &hits, func(msg *pb.LCPROTO) *pb.LCPROTO {
+		res := pb.ErrorResponse(pb.ERR_READONLY, "node is replica")
+		res.Value = []byte(primary.Addr().String())
+		return res
+	})
+	defer old.Close()
+
+	list := &NodeList{Nodes: []NodeInfo{{Addr: old.Addr().String(), Replica: primary.Addr().String()}}}
+
+	cl, _ := NewProxyFromList(list, nil)
+	px := cl.(*Proxy)
+	defer px.Close()
+
+	if err := px.SetContext(context.Background(), []byte("key"), nil, 1); err != nil {
+		t.Fatal("write must be repeated on the primary", err)
+	}
+
+	if px.node(0).Addr != primary.Addr().String() {
+		t.Fatal("the node must be replaced by its primary")
+	}
+}
@@ -0,0 +1,52 @@
+package connect
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/lj-team/lcluster/pb"
+)
+
+// Info is the replication state of the node returned by INFO
+type Info struct {
+	Role     string        `json:"role"`
+	Log      string        `json:"log"`     // id of the log of the node
+	First    int64         `json:"first"`   // first kept seq of the log
+	Last     int64         `json:"last"`    // last seq of the log
+	Primary  string        `json:"primary"` // id of the log applied by the node as replica
+	Applied  int64         `json:"applied"` // last applied seq of the primary log, -1 if unknown
+	Syncing  bool          `json:"syncing"` // full copy of the primary is not consistent
+	Replicas []ReplicaInfo `json:"replicas"`
+	Origin   string        `json:"origin"` // datacenter of the node, empty if not set
+	Peers    []ReplicaInfo `json:"peers"`  // primaries of other datacenters
+}
+
+// ReplicaInfo is the state of replication to the replica or the peer. State is
+// connecting (also after errors), copying (full copy) or streaming
+type ReplicaInfo struct {
+	Addr         string `json:"addr"`
+	State        string `json:"state"`
+	Sent         int64  `json:"sent"`          // last sent seq
+	Acked        int64  `json:"acked"`         // last seq applied by the replica, -1 if unknown
+	Pending      int64  `json:"pending"`       // changes not applied by the replica, -1 if unknown
+	PendingBytes int64  `json:"pending_bytes"` // size of the pending changes, -1 if unknown
+	LastAck      int64  `json:"last_ack"`      // unix time of the last position check, 0 if none
+	Error        string `json:"error"`         // last replication error, empty while streaming
+}
+
+// InfoContext returns the replication state of the node
+func (n *Conn) InfoContext(ctx context.Context) (*Info, error) {
+
+	r, err := n.roundTrip(ctx, &pb.LCPROTO{Code: pb.LCPROTO_INFO})
+	if err != nil {
+		return nil, err
+	}
+
+	var info Info
+
+	if err = json.Unmarshal(r.Value, &info); err != nil {
+		return nil, err
+	}
+
+	return &info, nil
+}
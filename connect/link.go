@@ -0,0 +1,146 @@
+package connect
+
+import (
+	"net"
+	"sync"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/lj-team/go-generic/log"
+	"github.com/lj-team/lcluster/codecs"
+	"github.com/lj-team/lcluster/pb"
+)
+
+// link is a single tcp connection with a reader goroutine which
+// dispatches responses to the waiting requests by id
+type link struct {
+	conn    net.Conn
+	pending map[uint64]chan *pb.LCPROTO
+	orphans chan *pb.LCPROTO
+	done    chan struct{}
+	closed  bool
+	mt      sync.Mutex
+}
+
+func newLink(conn net.Conn, orphans chan *pb.LCPROTO) *link {
+	l := &link{
+		conn:    conn,
+		pending: make(map[uint64]chan *pb.LCPROTO),
+		orphans: orphans,
+		done:    make(chan struct{}),
+	}
+
+	go l.reader()
+
+	return l
+}
+
+// expect registers channel for the response with id
+func (l *link) expect(id uint64, wait chan *pb.LCPROTO) bool {
+	l.mt.Lock()
+	defer l.mt.Unlock()
+
+	if l.closed {
+		return false
+	}
+
+	l.pending[id] = wait
+
+	return true
+}
+
+// forget drops waiting request, its response will be ignored
+func (l *link) forget(id uint64) {
+	l.mt.Lock()
+	delete(l.pending, id)
+	l.mt.Unlock()
+}
+
+func (l *link) broken() bool {
+	l.mt.Lock()
+	defer l.mt.Unlock()
+
+	return l.closed
+}
+
+// close closes connection and wakes up all waiting requests
+func (l *link) close() {
+	l.mt.Lock()
+	defer l.mt.Unlock()
+
+	if l.closed {
+		return
+	}
+
+	l.closed = true
+	l.conn.Close()
+
+	for id, wait := range l.pending {
+		close(wait)
+		delete(l.pending, id)
+	}
+
+	close(l.done)
+}
+
+func (l *link) dispatch(msg *pb.LCPROTO) {
+	l.mt.Lock()
+
+	id := msg.Id
+
+	// servers without request ids answer in order
+	if id == 0 {
+		for k := range l.pending {
+			if id == 0 || k < id {
+				id = k
+			}
+		}
+	}
+
+	wait, ok := l.pending[id]
+	if ok {
+		delete(l.pending, id)
+	}
+
+	l.mt.Unlock()
+
+	if ok {
+		wait <- msg
+		return
+	}
+
+	select {
+	case l.orphans <- msg:
+	default:
+		log.Trace("drop unexpected response")
+	}
+}
+
+func (l *link) reader() {
+	defer l.close()
+
+	decoder := codecs.Decode{}
+	buffer := make([]byte, 40960)
+
+	for {
+		num, err := l.conn.Read(buffer)
+		if err != nil {
+			return
+		}
+
+		list, err := decoder.Write(buffer[:num])
+
+		for _, rec := range list {
+			var msg pb.LCPROTO
+			if err := proto.Unmarshal(rec, &msg); err != nil {
+				log.Trace("invalid response: " + err.Error())
+				return
+			}
+			l.dispatch(&msg)
+		}
+
+		if err != nil {
+			log.Error("invalid response: " + err.Error())
+			return
+		}
+	}
+}
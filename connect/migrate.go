@@ -0,0 +1,50 @@
+package connect
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/lj-team/lcluster/pb"
+)
+
+// MigrateContext sets migration state of the node with address self to
+// the list, see pb.MIGRATE_*. The list is ignored for MIGRATE_NONE
+func (n *Conn) MigrateContext(ctx context.Context, self string, list *NodeList, state int64) error {
+
+	msg := &pb.LCPROTO{
+		Code:   pb.LCPROTO_MIGRATE,
+		Key:    []byte(self),
+		Ivalue: state,
+	}
+
+	if list != nil {
+		msg.Value, _ = json.Marshal(list)
+	}
+
+	_, err := n.roundTrip(ctx, msg)
+
+	return err
+}
+
+// MoveKeysContext makes the node in MIGRATE_ASK state move keys of other
+// nodes to their owners, limit keys after cursor are checked. moved is the
+// number of moved keys, more is false at the end
+func (n *Conn) MoveKeysContext(ctx context.Context, cursor []byte, limit int) (next []byte, moved int, more bool, err error) {
+
+	msg := &pb.LCPROTO{
+		Code:   pb.LCPROTO_MOVEKEYS,
+		Key:    cursor,
+		Ivalue: int64(limit),
+	}
+
+	r, err := n.roundTrip(ctx, msg)
+	if r != nil {
+		moved = int(r.Counter)
+	}
+
+	if err != nil {
+		return cursor, moved, true, err
+	}
+
+	return r.Key, moved, r.Ivalue != 0, nil
+}
@@ -0,0 +1,113 @@
+package connect
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/lj-team/lcluster/codecs"
+	"github.com/lj-team/lcluster/pb"
+)
+
+// handlerNode answers every request by f, hits counts the requests
+func handlerNode(t *testing.T, hits *int32, f func(*pb.LCPROTO) *pb.LCPROTO) net.Listener {
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+
+			go func() {
+				defer conn.Close()
+
+				encoder := codecs.Encode{}
+				decoder := codecs.Decode{}
+				buffer := make([]byte, 4096)
+
+				for {
+					n, err := conn.Read(buffer)
+					if err != nil {
+						return
+					}
+
+					list, _ := decoder.Write(buffer[:n])
+
+					for _, rec := range list {
+						var msg pb.LCPROTO
+						proto.Unmarshal(rec, &msg)
+
+						atomic.AddInt32(hits, 1)
+
+						r := f(&msg)
+						r.Code = pb.LCPROTO_RESP
+						r.Id = msg.Id
+
+						res, _ := proto.Marshal(r)
+						conn.Write(encoder.Write(res))
+					}
+				}
+			}()
+		}
+	}()
+
+	return ln
+}
+
+func TestProxyRedirect(t *testing.T) {
+
+	var hitsA, hitsB int32
+
+	lnB := handlerNode(t, &hitsB, func(msg *pb.LCPROTO) *pb.LCPROTO {
+		return &pb.LCPROTO{Ivalue: 42}
+	})
+	defer lnB.Close()
+
+	addrB := lnB.Addr().String()
+	ask := int32(1)
+
+	lnA := handlerNode(t, &hitsA, func(msg *pb.LCPROTO) *pb.LCPROTO {
+		if atomic.LoadInt32(&ask) == 1 {
+			return pb.ErrorResponse(pb.ERR_ASK, addrB)
+		}
+		res := pb.ErrorResponse(pb.ERR_MOVED, addrB)
+		res.Value = []byte(`{"nodes": ["` + addrB + `"]}`)
+		return res
+	})
+	defer lnA.Close()
+
+	px := NewProxy([]string{lnA.Addr().String()}).(*Proxy)
+	defer px.Close()
+
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if res, err := px.GetIntContext(ctx, []byte("key"), nil); err != nil || res != 42 {
+			t.Fatal("ask is not followed", res, err)
+		}
+	}
+
+	if atomic.LoadInt32(&hitsA) != 2 || atomic.LoadInt32(&hitsB) != 2 {
+		t.Fatal("ask must not change routing")
+	}
+
+	atomic.StoreInt32(&ask, 0)
+
+	for i := 0; i < 2; i++ {
+		if res, err := px.GetIntContext(ctx, []byte("key"), nil); err != nil || res != 42 {
+			t.Fatal("moved is not followed", res, err)
+		}
+	}
+
+	if atomic.LoadInt32(&hitsA) != 3 || atomic.LoadInt32(&hitsB) != 4 {
+		t.Fatal("routing is not updated by moved")
+	}
+}
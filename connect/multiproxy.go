@@ -2,6 +2,7 @@ package connect
 
 import (
 	"encoding/json"
+	"errors"
 	"io/ioutil"
 	"time"
 
@@ -35,7 +36,7 @@ func MultiProxyFromFile(filename string) *MultiProxy {
 		panic(err)
 	}
 
-	var conf map[string][]string = map[string][]string{}
+	var conf map[string]*NodeList = map[string]*NodeList{}
 
 	err = json.Unmarshal(data, &conf)
 	if err != nil {
@@ -44,10 +45,11 @@ func MultiProxyFromFile(filename string) *MultiProxy {
 		panic(err)
 	}
 
-	obj := &MultiProxy{rings: map[string]Cluster{}}
-
-	for k, v := range conf {
-		obj.rings[k] = NewProxy(v)
+	obj, err := MultiProxyFromLists(conf, nil)
+	if err != nil {
+		log.Error(err.Error())
+		<-time.After(time.Second)
+		panic(err)
 	}
 
 	return obj
@@ -66,6 +68,43 @@ func MultiProxyFromMap(conf map[string][]string) *MultiProxy {
 	return obj
 }
 
+// MultiProxyFromLists makes rings with own placements
+func MultiProxyFromLists(conf map[string]*NodeList, opts *Options) (*MultiProxy, error) {
+
+	log.Info("init lcluster rings from lists")
+
+	obj := &MultiProxy{rings: map[string]Cluster{}}
+
+	for k, v := range conf {
+		px, err := NewProxyFromList(v, opts)
+		if err != nil {
+			return nil, errors.New("ring " + k + ": " + err.Error())
+		}
+		obj.rings[k] = px
+	}
+
+	return obj, nil
+}
+
+// MultiProxyFromSeeds makes rings by topology of their seed nodes
+func MultiProxyFromSeeds(conf map[string][]string, opts *Options) (*MultiProxy, error) {
+
+	log.Info("init lcluster rings from seeds")
+
+	obj := &MultiProxy{rings: map[string]Cluster{}}
+
+	for k, v := range conf {
+		px, err := NewProxyFromSeeds(v, opts)
+		if err != nil {
+			obj.Close()
+			return nil, errors.New(k + ": " + err.Error())
+		}
+		obj.rings[k] = px
+	}
+
+	return obj, nil
+}
+
 func (mp *MultiProxy) Get(name string) Cluster {
 
 	if p, h := mp.rings[name]; h {
@@ -78,3 +117,23 @@ func (mp *MultiProxy) Get(name string) Cluster {
 func (mp *MultiProxy) SetCluster(name string, px Cluster) {
 	mp.rings[name] = px
 }
+
+// GetV2 returns ring as ClusterV2, nil if the ring does not exist or
+// does not implement it
+func (mp *MultiProxy) GetV2(name string) ClusterV2 {
+
+	if p, h := mp.rings[name].(ClusterV2); h {
+		return p
+	}
+
+	return nil
+}
+
+// Close closes connections of the rings
+func (mp *MultiProxy) Close() {
+	for _, px := range mp.rings {
+		if c, ok := px.(interface{ Close() }); ok {
+			c.Close()
+		}
+	}
+}
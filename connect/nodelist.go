@@ -0,0 +1,116 @@
+package connect
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/lj-team/lcluster/hash"
+)
+
+// NodeInfo is an address or {"addr": "host:port", "weight": 2, "replica": "host:port"}
+type NodeInfo struct {
+	Addr    string `json:"addr"`
+	Weight  int    `json:"weight"`
+	Replica string `json:"replica,omitempty"` // replica of the node
+}
+
+func (ni *NodeInfo) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '"' {
+		*ni = NodeInfo{}
+		return json.Unmarshal(data, &ni.Addr)
+	}
+
+	type plain NodeInfo
+
+	return json.Unmarshal(data, (*plain)(ni))
+}
+
+// NodeList is a plain array of addresses or an object with placement
+// settings, see hash.New:
+//
+//	{"hash": "ring", "vnodes": 160, "nodes": ["host:port", {"addr": "host:port", "weight": 2}]}
+type NodeList struct {
+	Hash   string     `json:"hash"`   // placement type, range by default
+	VNodes int        `json:"vnodes"` // ring: virtual nodes per weight unit
+	Nodes  []NodeInfo `json:"nodes"`
+}
+
+func (nl *NodeList) UnmarshalJSON(data []byte) error {
+	*nl = NodeList{}
+
+	if len(data) > 0 && data[0] == '[' {
+		return json.Unmarshal(data, &nl.Nodes)
+	}
+
+	type plain NodeList
+
+	if err := json.Unmarshal(data, (*plain)(nl)); err != nil {
+		return err
+	}
+
+	return nl.Check()
+}
+
+// Check returns error if the placement type is unknown
+func (nl *NodeList) Check() error {
+	if !hash.Valid(nl.Hash) {
+		return errors.New("unknown hash type " + nl.Hash)
+	}
+
+	return nil
+}
+
+// NewNodeList makes list with range hashing
+func NewNodeList(addrs []string) *NodeList {
+	nl := &NodeList{Nodes: make([]NodeInfo, len(addrs))}
+
+	for i, addr := range addrs {
+		nl.Nodes[i].Addr = addr
+	}
+
+	return nl
+}
+
+func (nl *NodeList) Addrs() []string {
+	res := make([]string, len(nl.Nodes))
+
+	for i, n := range nl.Nodes {
+		res[i] = n.Addr
+	}
+
+	return res
+}
+
+// Placement returns key to node mapping of the list, error if the
+// placement type is unknown
+func (nl *NodeList) Placement() (hash.Placement, error) {
+
+	if err := nl.Check(); err != nil {
+		return nil, err
+	}
+
+	nodes := make([]hash.Node, len(nl.Nodes))
+
+	for i, n := range nl.Nodes {
+		nodes[i] = hash.Node{Name: n.Addr, Weight: n.Weight}
+	}
+
+	return hash.New(nl.Hash, nodes, nl.VNodes)
+}
+
+// Moved returns fraction of keys which change the node if the cluster is
+// switched from nl to list
+func (nl *NodeList) Moved(list *NodeList) (float64, error) {
+
+	from, err := nl.Placement()
+	if err != nil {
+		return 0, err
+	}
+
+	to, err := list.Placement()
+	if err != nil {
+		return 0, err
+	}
+
+	return hash.Moved(from, nl.Addrs(), to, list.Addrs(), 0), nil
+}
@@ -0,0 +1,47 @@
+package connect
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestNodeList(t *testing.T) {
+
+	var plain NodeList
+
+	if err := json.Unmarshal([]byte(`["a:1", "b:1"]`), &plain); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(plain.Nodes) != 2 || plain.Nodes[1].Addr != "b:1" || plain.Hash != "" {
+		t.Fatal("plain list parsed wrong")
+	}
+
+	var ring NodeList
+
+	src := `{"hash": "ring", "nodes": ["a:1", {"addr": "b:1", "weight": 2}, "c:1"]}`
+
+	if err := json.Unmarshal([]byte(src), &ring); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(ring.Nodes) != 3 || ring.Nodes[1].Weight != 2 || ring.Nodes[2].Addr != "c:1" {
+		t.Fatal("object list parsed wrong")
+	}
+
+	grown := ring
+	grown.Nodes = append(grown.Nodes[:3:3], NodeInfo{Addr: "d:1"})
+
+	if m, err := ring.Moved(&grown); err != nil || m <= 0 || m > 0.3 {
+		t.Fatalf("invalid moved fraction %f", m)
+	}
+
+	if err := json.Unmarshal([]byte(`{"hash": "md5", "nodes": []}`), &ring); err == nil {
+		t.Fatal("unknown hash must be rejected")
+	}
+
+	// lists made in code are checked by Proxy
+	if _, err := NewProxyFromList(&NodeList{Hash: "md5", Nodes: []NodeInfo{{Addr: "a:1"}}}, nil); err == nil {
+		t.Fatal("unknown hash must be rejected by Proxy")
+	}
+}
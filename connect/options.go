@@ -0,0 +1,97 @@
+package connect
+
+import (
+	"crypto/tls"
+	"time"
+
+	"github.com/lj-team/lcluster/auth"
+)
+
+// defaults for zero Options fields
+const (
+	DefaultTimeout      = time.Second * 10
+	DefaultWriteTimeout = time.Second * 5
+	DefaultDialTimeout  = time.Second * 5
+
+	DefaultFailoverAfter = time.Second * 10
+)
+
+// Options of connections to the nodes
+type Options struct {
+	TLS  *tls.Config       // nil for plain tcp
+	Auth *auth.Credentials // sent after every connect
+
+	// Timeout of waiting for the response, the connection is reset when
+	// it expires. 0 - DefaultTimeout, negative - wait forever
+	Timeout time.Duration
+
+	// WriteTimeout limits writing of one request. 0 - DefaultWriteTimeout
+	WriteTimeout time.Duration
+
+	// DialTimeout limits connecting to the node. 0 - DefaultDialTimeout
+	DialTimeout time.Duration
+
+	// NopAfter sends C_NOP after the number of async requests to detect
+	// broken connection. 0 - NOP_AFTER
+	NopAfter int
+
+	// Quorum enables reading from the next node if the key node is down
+	// and has no replica
+	Quorum bool
+
+	// Pool of connections to every node of Proxy
+	Pool PoolConfig
+
+	// FailoverAfter is the time the node must be unavailable before its
+	// replica is promoted by Proxy, the replica must not hear the node
+	// for this time too. 0 - DefaultFailoverAfter, negative - never
+	FailoverAfter time.Duration
+
+	// AdminAuth is sent by connections of failover and topology changes,
+	// nodes accept them only from internal tokens. nil - Auth
+	AdminAuth *auth.Credentials
+
+	// Refresh is the interval of topology checks of Proxy made by
+	// NewProxyFromSeeds. 0 - DefaultRefresh, negative - never
+	Refresh time.Duration
+
+	// Acks is the number of replicas that must apply C_* writes before
+	// the response. If they do not in the node sync timeout, the write
+	// stays asynchronous and ErrNotReplicated is returned. 0 - node default
+	Acks int
+}
+
+func (o *Options) timeout() time.Duration {
+	if o.Timeout == 0 {
+		return DefaultTimeout
+	}
+	return o.Timeout
+}
+
+func (o *Options) writeTimeout() time.Duration {
+	if o.WriteTimeout <= 0 {
+		return DefaultWriteTimeout
+	}
+	return o.WriteTimeout
+}
+
+func (o *Options) dialTimeout() time.Duration {
+	if o.DialTimeout <= 0 {
+		return DefaultDialTimeout
+	}
+	return o.DialTimeout
+}
+
+func (o *Options) nopAfter() int {
+	if o.NopAfter <= 0 {
+		return NOP_AFTER
+	}
+	return o.NopAfter
+}
+
+func (o *Options) failoverAfter() time.Duration {
+	if o == nil || o.FailoverAfter == 0 {
+		return DefaultFailoverAfter
+	}
+	return o.FailoverAfter
+}
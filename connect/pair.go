@@ -4,3 +4,20 @@ type Pair struct {
 	Key   []byte
 	Value []byte
 }
+
+// makePairs converts list of keys and values to pairs
+func makePairs(list [][]byte) []Pair {
+	if len(list) == 0 {
+		return nil
+	}
+
+	size := len(list) / 2
+	result := make([]Pair, size)
+
+	for i := 0; i < size; i++ {
+		result[i].Key = list[i*2]
+		result[i].Value = list[i*2+1]
+	}
+
+	return result
+}
@@ -1,53 +1,338 @@
 package connect
 
 import (
+	"context"
+	"errors"
 	"sync"
+	"time"
+
+	"github.com/lj-team/go-generic/log"
+	"github.com/lj-team/lcluster/pb"
+)
+
+// defaults for zero PoolConfig fields
+const (
+	DefaultPoolMax     = 4
+	DefaultStreams     = 256
+	DefaultIdleTimeout = time.Minute * 5
+	DefaultHealthCheck = time.Second * 30
 )
 
+var ErrPoolTimeout = errors.New("no free connection in pool")
+var ErrPoolClosed = errors.New("pool closed")
+
+// PoolConfig of connections to one node
+type PoolConfig struct {
+	Min     int // connections kept open, 0 - none
+	Max     int // connections opened at the same time, 0 - DefaultPoolMax
+	Streams int // requests sharing one connection at the same time, 0 - DefaultStreams
+
+	// IdleTimeout closes connections above Min not used for the time.
+	// 0 - DefaultIdleTimeout, negative - never
+	IdleTimeout time.Duration
+
+	// HealthCheck is the interval of C_NOP checks of idle connections,
+	// failed ones are closed. 0 - DefaultHealthCheck, negative - disabled
+	HealthCheck time.Duration
+
+	// WaitTimeout of Get if all streams are in use.
+	// 0 - Options.Timeout
+	WaitTimeout time.Duration
+}
+
+type pooledConn struct {
+	conn  *Conn
+	users int       // requests using the connection
+	since time.Time // last release
+}
+
+// Pool of connections to the node. Conn is multiplexed, so Get shares the
+// least used connection between requests and opens a new one while all
+// are used and there are less than Max. The connection must be returned
+// by Put or Conn.Release. Shared connections do not support Send and Read
 type Pool struct {
-	Addr     string
-	size     int
-	connects []*Conn
-	queue    chan int
+	Addr   string
+	opts   Options
+	cfg    PoolConfig
+	slots  chan struct{}
+	conns  []*pooledConn
+	done   chan struct{}
+	closed bool
 	sync.Mutex
+
+	// redirect follows ERR_MOVED, ERR_ASK and ERR_READONLY responses of
+	// node addr, set by Proxy
+	redirect func(ctx context.Context, addr string, pm, r *pb.LCPROTO) (*pb.LCPROTO, error)
 }
 
+// NewPool keeps limit connections opened
 func NewPool(addr string, limit int) *Pool {
+	return NewPoolWithOptions(addr, &Options{Pool: PoolConfig{Min: limit, Max: limit}})
+}
+
+func NewPoolWithOptions(addr string, opts *Options) *Pool {
 	p := &Pool{
-		Addr:     addr,
-		size:     limit,
-		queue:    make(chan int, limit),
-		connects: make([]*Conn, limit),
+		Addr: addr,
+		done: make(chan struct{}),
+	}
+
+	if opts != nil {
+		p.opts = *opts
+	}
+
+	p.cfg = p.opts.Pool
+
+	if p.cfg.Max < 1 {
+		p.cfg.Max = DefaultPoolMax
+	}
+
+	if p.cfg.Streams < 1 {
+		p.cfg.Streams = DefaultStreams
+	}
+
+	if p.cfg.Min > p.cfg.Max {
+		p.cfg.Min = p.cfg.Max
+	}
+
+	if p.cfg.IdleTimeout == 0 {
+		p.cfg.IdleTimeout = DefaultIdleTimeout
+	}
+
+	if p.cfg.HealthCheck == 0 {
+		p.cfg.HealthCheck = DefaultHealthCheck
 	}
 
-	for i := 0; i < limit; i++ {
-		p.queue <- 1
-		p.connects[i] = NewConn(addr)
-		p.connects[i].pool = p
+	if p.cfg.WaitTimeout == 0 {
+		p.cfg.WaitTimeout = p.opts.timeout()
+	}
+
+	p.slots = make(chan struct{}, p.cfg.Max*p.cfg.Streams)
+
+	for i := 0; i < p.cfg.Min; i++ {
+		p.conns = append(p.conns, &pooledConn{conn: p.newConn(), since: time.Now()})
+	}
+
+	if p.cfg.IdleTimeout > 0 || p.cfg.HealthCheck > 0 {
+		go p.maintain()
 	}
 
 	return p
 }
 
-func (p *Pool) Get() (c *Conn) {
-	<-p.queue
+func (p *Pool) newConn() *Conn {
+	c := NewConnWithOptions(p.Addr, &p.opts)
+	c.pool = p
+	return c
+}
+
+// Get waits for a free stream WaitTimeout, nil is returned if there is no one
+func (p *Pool) Get() *Conn {
+	c, err := p.GetContext(context.Background())
+	if err != nil {
+		log.Trace(p.Addr + ": " + err.Error())
+	}
+	return c
+}
+
+// GetContext waits for a free stream until WaitTimeout expires or ctx is done
+func (p *Pool) GetContext(ctx context.Context) (*Conn, error) {
+
+	var timeout <-chan time.Time
+
+	if p.cfg.WaitTimeout > 0 {
+		t := time.NewTimer(p.cfg.WaitTimeout)
+		defer t.Stop()
+		timeout = t.C
+	}
+
+	select {
+	case p.slots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-timeout:
+		return nil, ErrPoolTimeout
+	case <-p.done:
+		return nil, ErrPoolClosed
+	}
 
 	p.Lock()
 	defer p.Unlock()
 
-	c = p.connects[p.size-1]
-	p.size--
+	if p.closed {
+		<-p.slots
+		return nil, ErrPoolClosed
+	}
 
-	return c
+	var pc *pooledConn
+
+	for _, c := range p.conns {
+		if c.users < p.cfg.Streams && (pc == nil || c.users < pc.users) {
+			pc = c
+		}
+	}
+
+	if pc == nil || pc.users > 0 && len(p.conns) < p.cfg.Max {
+		pc = &pooledConn{conn: p.newConn()}
+		p.conns = append(p.conns, pc)
+	}
+
+	pc.users++
+
+	return pc.conn, nil
 }
 
+// Put returns the connection taken by Get, connections not taken are
+// ignored
 func (p *Pool) Put(c *Conn) {
 	p.Lock()
 	defer p.Unlock()
 
-	c.pool = p
-	p.connects[p.size] = c
-	p.size++
+	i := p.find(c)
 
-	p.queue <- 1
+	if i < 0 || p.conns[i].users == 0 {
+		log.Warn("connection to " + p.Addr + " is returned to pool twice")
+		return
+	}
+
+	pc := p.conns[i]
+	pc.users--
+	pc.since = time.Now()
+
+	if p.closed && pc.users == 0 {
+		c.Close()
+		p.conns = append(p.conns[:i], p.conns[i+1:]...)
+	}
+
+	<-p.slots
+}
+
+// find returns index of the connection, -1 if it is not in the pool
+func (p *Pool) find(c *Conn) int {
+	for i, pc := range p.conns {
+		if pc.conn == c {
+			return i
+		}
+	}
+	return -1
+}
+
+// Close closes idle connections, the used ones are closed by Put
+func (p *Pool) Close() {
+	p.Lock()
+	defer p.Unlock()
+
+	if p.closed {
+		return
+	}
+
+	p.closed = true
+	close(p.done)
+
+	list := p.conns[:0]
+
+	for _, pc := range p.conns {
+		if pc.users == 0 {
+			pc.conn.Close()
+			continue
+		}
+		list = append(list, pc)
+	}
+
+	p.conns = list
+}
+
+// maintain evicts idle connections and checks the rest
+func (p *Pool) maintain() {
+
+	period := p.cfg.HealthCheck
+	if period <= 0 || p.cfg.IdleTimeout > 0 && p.cfg.IdleTimeout < period {
+		period = p.cfg.IdleTimeout
+	}
+
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+
+	lastCheck := time.Now()
+
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-ticker.C:
+		}
+
+		p.evict()
+
+		if p.cfg.HealthCheck > 0 && time.Since(lastCheck) >= p.cfg.HealthCheck {
+			p.check()
+			lastCheck = time.Now()
+		}
+	}
+}
+
+func (p *Pool) evict() {
+	if p.cfg.IdleTimeout <= 0 {
+		return
+	}
+
+	p.Lock()
+	defer p.Unlock()
+
+	total := len(p.conns)
+	list := p.conns[:0]
+
+	for _, pc := range p.conns {
+		if total > p.cfg.Min && pc.users == 0 && time.Since(pc.since) > p.cfg.IdleTimeout {
+			log.Trace("close idle connection to " + p.Addr)
+			pc.conn.Close()
+			total--
+			continue
+		}
+		list = append(list, pc)
+	}
+
+	p.conns = list
+}
+
+// check sends C_NOP via idle connections, Conn is safe for concurrent
+// use so the connection may be taken by Get in the meantime
+func (p *Pool) check() {
+	p.Lock()
+	var list []*Conn
+	for _, pc := range p.conns {
+		if pc.users == 0 {
+			list = append(list, pc.conn)
+		}
+	}
+	p.Unlock()
+
+	timeout := p.opts.timeout()
+	if timeout < 0 {
+		timeout = DefaultTimeout
+	}
+
+	for _, c := range list {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		err := c.StatusContext(ctx)
+		cancel()
+
+		if err == nil {
+			continue
+		}
+
+		log.Warn("health check of " + p.Addr + " failed: " + err.Error())
+
+		p.Lock()
+		if i := p.find(c); i >= 0 && p.conns[i].users == 0 {
+			p.conns = append(p.conns[:i], p.conns[i+1:]...)
+			c.Close()
+		}
+		p.Unlock()
+	}
+
+	p.Lock()
+	for !p.closed && len(p.conns) < p.cfg.Min {
+		p.conns = append(p.conns, &pooledConn{conn: p.newConn(), since: time.Now()})
+	}
+	p.Unlock()
 }
@@ -0,0 +1,89 @@
+package connect
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestPool(t *testing.T) {
+
+	pool := NewPoolWithOptions("127.0.0.1:1", &Options{
+		Pool: PoolConfig{
+			Max:         1,
+			Streams:     1,
+			IdleTimeout: 10 * time.Millisecond,
+			HealthCheck: -1,
+			WaitTimeout: 10 * time.Millisecond,
+		},
+	})
+	defer pool.Close()
+
+	con, err := pool.GetContext(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = pool.GetContext(context.Background()); err != ErrPoolTimeout {
+		t.Fatal("Get must fail when all streams are in use")
+	}
+
+	con.Release()
+
+	// the second release is ignored and does not take the slot
+	con.Release()
+
+	if con, err = pool.GetContext(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	con.Release()
+
+	<-time.After(50 * time.Millisecond)
+
+	pool.Lock()
+	open := len(pool.conns)
+	pool.Unlock()
+
+	if open != 0 {
+		t.Fatal("idle connection must be evicted")
+	}
+}
+
+func TestPoolShared(t *testing.T) {
+
+	pool := NewPoolWithOptions("127.0.0.1:1", &Options{
+		Pool: PoolConfig{Max: 2, HealthCheck: -1},
+	})
+	defer pool.Close()
+
+	var list []*Conn
+
+	for i := 0; i < 5; i++ {
+		con, err := pool.GetContext(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		list = append(list, con)
+	}
+
+	if list[0] == list[1] || list[2] != list[0] && list[2] != list[1] {
+		t.Fatal("connections must be shared after Max are opened")
+	}
+
+	if _, err := list[0].ReadContext(context.Background()); err != ErrPooled {
+		t.Fatal("read of shared connection must fail", err)
+	}
+
+	for _, con := range list {
+		con.Release()
+	}
+
+	pool.Lock()
+	open := len(pool.conns)
+	pool.Unlock()
+
+	if open != 2 {
+		t.Fatal("Max connections expected", open)
+	}
+}
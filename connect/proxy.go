@@ -1,477 +1,709 @@
 package connect
 
 import (
-	"github.com/lj-team/lcluster/hash/consistent"
+	"bytes"
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/lj-team/go-generic/log"
+	"github.com/lj-team/lcluster/hash"
 	"github.com/lj-team/lcluster/pb"
 )
 
+// Proxy routes requests to the nodes by key, every node has own Pool.
+// The node list is replaced by ERR_MOVED responses of the nodes. If the
+// node has a replica, reads go to the replica while the node is down and
+// the replica is promoted after Options.FailoverAfter if it agrees
 type Proxy struct {
-	conns  []*Conn
-	hash   *consistent.Hash
-	keybuf []byte
+	pools    []*Pool
+	replicas []*Pool     // replica of every node, nil if there is no one
+	down     []time.Time // the node is not available since
+	hash     hash.Placement
+	extra    map[string]*Pool // nodes out of the list, reached by ERR_ASK
+	nodes    *NodeList        // current node list
+	list     []byte           // current node list json
+	epoch    int64            // topology epoch, see NewProxyFromSeeds
+	done     chan struct{}
+	opts     *Options
+	quorum   bool
+	mt       sync.RWMutex
 }
 
 func NewProxy(addrs []string) Cluster {
+	return NewProxyWithOptions(addrs, nil)
+}
+
+func NewProxyWithOptions(addrs []string, opts *Options) Cluster {
+	p := newProxy(opts)
+	p.setList(NewNodeList(addrs)) // range placement is always valid
+	return p
+}
+
+// NewProxyFromList makes Proxy with placement and replicas of the list,
+// error is returned if the placement type is unknown
+func NewProxyFromList(list *NodeList, opts *Options) (Cluster, error) {
+	p := newProxy(opts)
+
+	if err := p.setList(list); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// NewProxyWithPlacement makes Proxy with own placement of keys
+func NewProxyWithPlacement(addrs []string, placement hash.Placement, opts *Options) Cluster {
+	p := newProxy(opts)
+	p.setList(NewNodeList(addrs))
+	p.hash = placement
+	return p
+}
+
+func newProxy(opts *Options) *Proxy {
 	p := &Proxy{
-		hash:   consistent.New(len(addrs)),
-		conns:  make([]*Conn, len(addrs)),
-		keybuf: make([]byte, 256),
+		extra:  map[string]*Pool{},
+		done:   make(chan struct{}),
+		opts:   opts,
+		quorum: QUORUM,
 	}
 
-	for i := range p.conns {
-		p.conns[i] = NewConn(addrs[i])
+	if opts != nil && opts.Quorum {
+		p.quorum = true
 	}
 
 	return p
 }
 
-func (p *Proxy) ProtoSend(msg *pb.LCPROTO) {
-	size := int(msg.Key[0])
-	n := p.hash.Get(msg.Key[1:size])
-	con := p.conns[n]
-	con.Lock()
-	defer con.Unlock()
-	con.send(msg)
+func (p *Proxy) newPool(addr string) *Pool {
+	pool := NewPoolWithOptions(addr, p.opts)
+	pool.redirect = p.redirect
+	return pool
 }
 
-func (p *Proxy) ProtoDo(msg *pb.LCPROTO) *pb.LCPROTO {
-	size := int(msg.Key[0])
-	n := p.hash.Get(msg.Key[1:size])
-	con := p.conns[n]
-	con.Lock()
-	defer con.Unlock()
-	con.send(msg)
-	return con.Read()
+// node returns pool of node n, nil if there is no such node
+func (p *Proxy) node(n int) *Pool {
+	p.mt.RLock()
+	defer p.mt.RUnlock()
+
+	if n < 0 || n >= len(p.pools) {
+		return nil
+	}
+
+	return p.pools[n]
 }
 
-func (p *Proxy) Set(key, subkey []byte, value interface{}, sync bool) {
-	n := p.hash.Get(key)
-	con := p.conns[n]
-	con.Lock()
-	defer con.Unlock()
-	con.Set(key, subkey, value, sync)
+// nodeList returns pools of all nodes
+func (p *Proxy) nodeList() []*Pool {
+	p.mt.RLock()
+	defer p.mt.RUnlock()
+
+	return append([]*Pool{}, p.pools...)
 }
 
-func (p *Proxy) SetIfMore(key, subkey []byte, value int64, sync bool) int64 {
-	n := p.hash.Get(key)
-	con := p.conns[n]
-	con.Lock()
-	defer con.Unlock()
-	return con.SetIfMore(key, subkey, value, sync)
+// route returns number of the key node and pools of the node, of its
+// replica and of the next node
+func (p *Proxy) route(key []byte) (n int, pool, replica, next *Pool) {
+	p.mt.RLock()
+	defer p.mt.RUnlock()
+
+	n = p.hash.Get(key)
+
+	return n, p.pools[n], p.replicas[n], p.pools[p.hash.Next(n)]
 }
 
-func (p *Proxy) BitAnd(key, subkey []byte, value int64, sync bool) int64 {
-	n := p.hash.Get(key)
-	con := p.conns[n]
-	con.Lock()
-	defer con.Unlock()
-	return con.BitAnd(key, subkey, value, sync)
+// withContext runs f with a connection of the pool
+func (p *Proxy) withContext(ctx context.Context, pool *Pool, f func(*Conn) error) error {
+	if pool == nil {
+		return ErrNoNode
+	}
+
+	con, err := pool.GetContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer con.Release()
+
+	return f(con)
 }
 
-func (p *Proxy) BitAndNot(key, subkey []byte, value int64, sync bool) int64 {
-	n := p.hash.Get(key)
-	con := p.conns[n]
-	con.Lock()
-	defer con.Unlock()
-	return con.BitAndNot(key, subkey, value, sync)
+// writeContext runs f with a connection to the node of the key
+func (p *Proxy) writeContext(ctx context.Context, key []byte, f func(*Conn) error) error {
+
+	n, pool, replica, _ := p.route(key)
+
+	if replica == nil {
+		return p.withContext(ctx, pool, f)
+	}
+
+	con, err := p.alive(ctx, n, pool)
+
+	if err == ErrNotConnected && p.failover(ctx, n, pool) {
+		n, pool, _, _ = p.route(key)
+		con, err = p.alive(ctx, n, pool)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	defer con.Release()
+
+	return f(con)
 }
 
-func (p *Proxy) BitOr(key, subkey []byte, value int64, sync bool) int64 {
-	n := p.hash.Get(key)
-	con := p.conns[n]
-	con.Lock()
-	defer con.Unlock()
-	return con.BitOr(key, subkey, value, sync)
+// readContext runs f with a connection to the node of the key. If the
+// node is not available its replica is used, with quorum and without
+// replica the next node is used
+func (p *Proxy) readContext(ctx context.Context, key []byte, f func(*Conn) error) error {
+
+	n, pool, replica, next := p.route(key)
+
+	if replica == nil && !p.quorum {
+		return p.withContext(ctx, pool, f)
+	}
+
+	con, err := p.alive(ctx, n, pool)
+
+	if err != nil {
+		if replica == nil {
+			replica = next
+		}
+
+		con, err = replica.GetContext(ctx)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	defer con.Release()
+
+	return f(con)
 }
 
-func (p *Proxy) BitXor(key, subkey []byte, value int64, sync bool) int64 {
-	n := p.hash.Get(key)
-	con := p.conns[n]
-	con.Lock()
-	defer con.Unlock()
-	return con.BitXor(key, subkey, value, sync)
+// redirect repeats the request on the node of ERR_MOVED or ERR_ASK
+// response, ERR_MOVED replaces the node list. Write rejected by replica
+// addr is repeated on its primary if the node is replaced by failover
+func (p *Proxy) redirect(ctx context.Context, addr string, pm, r *pb.LCPROTO) (*pb.LCPROTO, error) {
+
+	err := r.Err()
+
+	if r.ErrCode == pb.ERR_READONLY {
+		pool := p.follow(addr, string(r.Value))
+		if pool == nil {
+			return r, err
+		}
+
+		con, e := pool.GetContext(ctx)
+		if e != nil {
+			return nil, e
+		}
+
+		r, err = con.roundTrip(ctx, pm)
+		con.Release()
+
+		if !r.Redirect() {
+			return r, err
+		}
+	}
+
+	for i := 0; i < MAX_REDIRECTS; i++ {
+		if r.ErrCode == pb.ERR_MOVED {
+			p.update(r.Value)
+		}
+
+		con, e := p.pool(r.ErrMsg).GetContext(ctx)
+		if e != nil {
+			return nil, e
+		}
+
+		r, err = con.roundTrip(ctx, pm)
+		con.Release()
+
+		if !r.Redirect() {
+			break
+		}
+	}
+
+	return r, err
 }
 
-func (p *Proxy) SetNX(key, subkey []byte, value interface{}, sync bool) bool {
-	n := p.hash.Get(key)
-	con := p.conns[n]
-	con.Lock()
-	defer con.Unlock()
-	return con.SetNX(key, subkey, value, sync)
+// pool returns pool of the node by address
+func (p *Proxy) pool(addr string) *Pool {
+	p.mt.Lock()
+	defer p.mt.Unlock()
+
+	for _, list := range [][]*Pool{p.pools, p.replicas} {
+		for _, pool := range list {
+			if pool != nil && pool.Addr == addr {
+				return pool
+			}
+		}
+	}
+
+	pool, ok := p.extra[addr]
+	if !ok {
+		pool = p.newPool(addr)
+		p.extra[addr] = pool
+	}
+
+	return pool
 }
 
-func (p *Proxy) Get(key, subkey []byte) []byte {
-	n := p.hash.Get(key)
-	con := p.conns[n]
-	con.Lock()
+// update replaces the node list by ERR_MOVED response
+func (p *Proxy) update(data []byte) {
+	var list NodeList
 
-	if con.KeepAlive() {
-		v := con.Get(key, subkey)
-		con.Unlock()
-		return v
+	if err := json.Unmarshal(data, &list); err != nil || len(list.Nodes) == 0 {
+		log.Error("invalid node list in ERR_MOVED")
+		return
 	}
 
-	con.Unlock()
+	p.mt.Lock()
+	err := p.setList(&list)
+	p.mt.Unlock()
+
+	if err != nil {
+		log.Error("node list of ERR_MOVED: " + err.Error())
+	}
+}
+
+// setList replaces the node list, pools of the remaining nodes are kept.
+// The list with unknown placement type is not applied. p.mt must be locked
+func (p *Proxy) setList(list *NodeList) error {
 
-	if QUORUM {
-		n = p.hash.Next(n)
-		con = p.conns[n]
-		con.Lock()
-		v := con.Get(key, subkey)
-		con.Unlock()
-		return v
+	place, err := list.Placement()
+	if err != nil {
+		return err
 	}
 
+	data, _ := json.Marshal(list)
+
+	if bytes.Equal(data, p.list) {
+		return nil
+	}
+
+	old := map[string]*Pool{}
+
+	for addr, pool := range p.extra {
+		old[addr] = pool
+	}
+
+	for _, pool := range append(p.pools, p.replicas...) {
+		if pool != nil {
+			old[pool.Addr] = pool
+		}
+	}
+
+	get := func(addr string) *Pool {
+		pool, ok := old[addr]
+		if ok {
+			delete(old, addr)
+		} else {
+			pool = p.newPool(addr)
+		}
+		return pool
+	}
+
+	pools := make([]*Pool, len(list.Nodes))
+	replicas := make([]*Pool, len(list.Nodes))
+
+	for i, node := range list.Nodes {
+		pools[i] = get(node.Addr)
+
+		if node.Replica != "" {
+			replicas[i] = get(node.Replica)
+		}
+	}
+
+	for _, pool := range old {
+		pool.Close()
+	}
+
+	if p.pools != nil {
+		log.Info("node list is updated: " + string(data))
+	}
+
+	p.pools = pools
+	p.replicas = replicas
+	p.down = make([]time.Time, len(pools))
+	p.hash = place
+	p.extra = map[string]*Pool{}
+	p.nodes = list
+	p.list = data
+
 	return nil
 }
 
-func (p *Proxy) GetInt(key, subkey []byte) int64 {
-	n := p.hash.Get(key)
-	con := p.conns[n]
-	con.Lock()
+func (p *Proxy) write(key []byte, f func(*Conn)) {
+	err := p.writeContext(context.Background(), key, func(con *Conn) error {
+		f(con)
+		return nil
+	})
 
-	if con.KeepAlive() {
-		v := con.GetInt(key, subkey)
-		con.Unlock()
-		return v
+	if err != nil {
+		log.Trace(err.Error())
 	}
+}
 
-	con.Unlock()
+func (p *Proxy) read(key []byte, f func(*Conn)) {
+	err := p.readContext(context.Background(), key, func(con *Conn) error {
+		f(con)
+		return nil
+	})
 
-	if QUORUM {
-		n := p.hash.Next(n)
-		con = p.conns[n]
-		con.Lock()
-		v := con.GetInt(key, subkey)
-		con.Unlock()
-		return v
+	if err != nil {
+		log.Trace(err.Error())
 	}
+}
 
-	return 0
+// validKey checks raw key: first byte is length of routing part plus one
+func validKey(key []byte) bool {
+	return len(key) > 0 && key[0] > 0 && int(key[0]) <= len(key)
 }
 
-func (p *Proxy) Has(key, subkey []byte) bool {
-	n := p.hash.Get(key)
-	con := p.conns[n]
-	con.Lock()
+func (p *Proxy) ProtoSend(msg *pb.LCPROTO) {
+	if !validKey(msg.Key) {
+		log.Trace("drop request with invalid key")
+		return
+	}
 
-	if con.KeepAlive() {
-		v := con.Has(key, subkey)
-		con.Unlock()
-		return v
+	size := int(msg.Key[0])
+
+	p.write(msg.Key[1:size], func(con *Conn) {
+		con.send(msg)
+	})
+}
+
+// ProtoDo routes request to the node and returns its response, reads
+// may be served by the replica. Node errors are passed in the response,
+// unavailable node is reported as ERR_UNAVAILABLE
+func (p *Proxy) ProtoDo(msg *pb.LCPROTO) *pb.LCPROTO {
+	if !validKey(msg.Key) {
+		res := pb.ErrorResponse(pb.ERR_BAD_ARGS, "invalid key")
+		res.Id = msg.Id
+		return res
 	}
 
-	con.Unlock()
+	size := int(msg.Key[0])
+
+	// connection assigns own request id
+	id := msg.Id
+
+	var r *pb.LCPROTO
 
-	if QUORUM {
-		n := p.hash.Next(n)
-		con = p.conns[n]
-		con.Lock()
-		v := con.Has(key, subkey)
-		con.Unlock()
-		return v
+	route := p.readContext
+	if msg.Code.Mutating() {
+		route = p.writeContext
 	}
 
-	return false
+	err := route(context.Background(), msg.Key[1:size], func(con *Conn) (e error) {
+		r, e = con.call(msg)
+		return
+	})
+
+	msg.Id = id
+
+	if r == nil {
+		r = pb.ErrorResponse(pb.ERR_UNAVAILABLE, err.Error())
+	}
+
+	r.Id = id
+
+	return r
 }
 
-func (p *Proxy) Del(key, subkey []byte, sync bool) bool {
-	n := p.hash.Get(key)
-	con := p.conns[n]
-	con.Lock()
-	defer con.Unlock()
-	return con.Del(key, subkey, sync)
+func (p *Proxy) Set(key, subkey []byte, value interface{}, sync bool) {
+	p.write(key, func(con *Conn) {
+		con.Set(key, subkey, value, sync)
+	})
 }
 
-func (p *Proxy) Inc(key, subkey []byte, val int64, sync bool) int64 {
-	n := p.hash.Get(key)
-	con := p.conns[n]
-	con.Lock()
-	defer con.Unlock()
-	return con.Inc(key, subkey, val, sync)
+func (p *Proxy) SetIfMore(key, subkey []byte, value int64, sync bool) int64 {
+	var res int64
+
+	p.write(key, func(con *Conn) {
+		res = con.SetIfMore(key, subkey, value, sync)
+	})
+
+	return res
 }
 
-func (p *Proxy) Dec(key, subkey []byte, val int64, sync bool) int64 {
-	n := p.hash.Get(key)
-	con := p.conns[n]
-	con.Lock()
-	defer con.Unlock()
-	return con.Dec(key, subkey, val, sync)
+func (p *Proxy) BitAnd(key, subkey []byte, value int64, sync bool) int64 {
+	var res int64
+
+	p.write(key, func(con *Conn) {
+		res = con.BitAnd(key, subkey, value, sync)
+	})
+
+	return res
 }
 
-func (p *Proxy) SeqAdd(seq []byte, value interface{}, sync bool) {
-	n := p.hash.Get(seq)
-	con := p.conns[n]
-	con.Lock()
-	defer con.Unlock()
-	con.SeqAdd(seq, value, sync)
+func (p *Proxy) BitAndNot(key, subkey []byte, value int64, sync bool) int64 {
+	var res int64
+
+	p.write(key, func(con *Conn) {
+		res = con.BitAndNot(key, subkey, value, sync)
+	})
+
+	return res
 }
 
-func (p *Proxy) HKill(key []byte, sync bool) {
-	n := p.hash.Get(key)
-	con := p.conns[n]
-	con.Lock()
-	defer con.Unlock()
-	con.HKill(key, sync)
+func (p *Proxy) BitOr(key, subkey []byte, value int64, sync bool) int64 {
+	var res int64
+
+	p.write(key, func(con *Conn) {
+		res = con.BitOr(key, subkey, value, sync)
+	})
+
+	return res
 }
 
-func (p *Proxy) SeqKill(seq []byte, sync bool) {
-	n := p.hash.Get(seq)
-	con := p.conns[n]
-	con.Lock()
-	defer con.Unlock()
-	con.SeqKill(seq, sync)
+func (p *Proxy) BitXor(key, subkey []byte, value int64, sync bool) int64 {
+	var res int64
+
+	p.write(key, func(con *Conn) {
+		res = con.BitXor(key, subkey, value, sync)
+	})
+
+	return res
 }
 
-func (p *Proxy) HKeysAll(key []byte) [][]byte {
-	n := p.hash.Get(key)
-	con := p.conns[n]
-	con.Lock()
+func (p *Proxy) SetNX(key, subkey []byte, value interface{}, sync bool) bool {
+	var res bool
 
-	if con.KeepAlive() {
-		v := con.HKeysAll(key)
-		con.Unlock()
-		return v
-	}
+	p.write(key, func(con *Conn) {
+		res = con.SetNX(key, subkey, value, sync)
+	})
 
-	con.Unlock()
+	return res
+}
 
-	if QUORUM {
-		n := p.hash.Next(n)
-		con = p.conns[n]
-		con.Lock()
-		v := con.HKeysAll(key)
-		con.Unlock()
-		return v
-	}
+func (p *Proxy) Get(key, subkey []byte) []byte {
+	var res []byte
+
+	p.read(key, func(con *Conn) {
+		res = con.Get(key, subkey)
+	})
 
-	return [][]byte{}
+	return res
 }
 
-func (p *Proxy) HAll(key []byte) []Pair {
-	n := p.hash.Get(key)
-	con := p.conns[n]
-	con.Lock()
+func (p *Proxy) GetInt(key, subkey []byte) int64 {
+	var res int64
 
-	if con.KeepAlive() {
-		v := con.HAll(key)
-		con.Unlock()
-		return v
-	}
+	p.read(key, func(con *Conn) {
+		res = con.GetInt(key, subkey)
+	})
 
-	con.Unlock()
+	return res
+}
 
-	if QUORUM {
-		n := p.hash.Next(n)
-		con = p.conns[n]
-		con.Lock()
-		v := con.HAll(key)
-		con.Unlock()
-		return v
-	}
+func (p *Proxy) Has(key, subkey []byte) bool {
+	var res bool
+
+	p.read(key, func(con *Conn) {
+		res = con.Has(key, subkey)
+	})
 
-	return []Pair{}
+	return res
 }
 
-func (p *Proxy) HKeys(key []byte, limit, offset int64) [][]byte {
-	n := p.hash.Get(key)
-	con := p.conns[n]
-	con.Lock()
+func (p *Proxy) Del(key, subkey []byte, sync bool) bool {
+	var res bool
 
-	if con.KeepAlive() {
-		v := con.HKeys(key, limit, offset)
-		con.Unlock()
-		return v
-	}
+	p.write(key, func(con *Conn) {
+		res = con.Del(key, subkey, sync)
+	})
 
-	con.Unlock()
+	return res
+}
 
-	if QUORUM {
-		n = p.hash.Next(n)
-		con := p.conns[n]
-		con.Lock()
-		v := con.HKeys(key, limit, offset)
-		con.Unlock()
-		return v
-	}
+func (p *Proxy) Inc(key, subkey []byte, val int64, sync bool) int64 {
+	var res int64
+
+	p.write(key, func(con *Conn) {
+		res = con.Inc(key, subkey, val, sync)
+	})
 
-	return [][]byte{}
+	return res
 }
 
-func (p *Proxy) HKeysRand(key []byte, limit int64) [][]byte {
-	n := p.hash.Get(key)
-	con := p.conns[n]
-	con.Lock()
+func (p *Proxy) Dec(key, subkey []byte, val int64, sync bool) int64 {
+	var res int64
 
-	if con.KeepAlive() {
-		v := con.HKeysRand(key, limit)
-		con.Unlock()
-		return v
-	}
+	p.write(key, func(con *Conn) {
+		res = con.Dec(key, subkey, val, sync)
+	})
 
-	con.Unlock()
+	return res
+}
 
-	if QUORUM {
-		n = p.hash.Next(n)
-		con = p.conns[n]
-		con.Lock()
-		v := con.HKeysRand(key, limit)
-		con.Unlock()
-		return v
-	}
+func (p *Proxy) SeqAdd(seq []byte, value interface{}, sync bool) {
+	p.write(seq, func(con *Conn) {
+		con.SeqAdd(seq, value, sync)
+	})
+}
 
-	return [][]byte{}
+func (p *Proxy) HKill(key []byte, sync bool) {
+	p.write(key, func(con *Conn) {
+		con.HKill(key, sync)
+	})
 }
 
-func (p *Proxy) SeqRange(seq []byte, limit, offset int64) [][]byte {
-	n := p.hash.Get(seq)
-	con := p.conns[n]
-	con.Lock()
+func (p *Proxy) SeqKill(seq []byte, sync bool) {
+	p.write(seq, func(con *Conn) {
+		con.SeqKill(seq, sync)
+	})
+}
 
-	if con.KeepAlive() {
-		v := con.SeqRange(seq, limit, offset)
-		con.Unlock()
-		return v
-	}
+func (p *Proxy) HKeysAll(key []byte) [][]byte {
+	res := [][]byte{}
 
-	con.Unlock()
+	p.read(key, func(con *Conn) {
+		res = con.HKeysAll(key)
+	})
 
-	if QUORUM {
-		n = p.hash.Next(n)
-		con = p.conns[n]
-		con.Lock()
-		v := con.SeqRange(seq, limit, offset)
-		con.Unlock()
-		return v
-	}
+	return res
+}
 
-	return [][]byte{}
+func (p *Proxy) HAll(key []byte) []Pair {
+	res := []Pair{}
+
+	p.read(key, func(con *Conn) {
+		res = con.HAll(key)
+	})
+
+	return res
 }
 
-func (p *Proxy) HSize(key []byte) int64 {
-	n := p.hash.Get(key)
-	con := p.conns[n]
-	con.Lock()
-	if con.KeepAlive() {
-		v := con.HSize(key)
-		con.Unlock()
-		return v
-	}
-	con.Unlock()
+func (p *Proxy) HKeys(key []byte, limit, offset int64) [][]byte {
+	res := [][]byte{}
 
-	if QUORUM {
-		n = p.hash.Next(n)
-		con = p.conns[n]
-		con.Lock()
-		v := con.HSize(key)
-		con.Unlock()
-		return v
-	}
+	p.read(key, func(con *Conn) {
+		res = con.HKeys(key, limit, offset)
+	})
 
-	return 0
+	return res
 }
 
-func (p *Proxy) KeyTotal(n int) int64 {
-	con := p.conns[n]
-	con.Lock()
-	defer con.Unlock()
-	return con.KeyTotal()
+func (p *Proxy) HKeysRand(key []byte, limit int64) [][]byte {
+	res := [][]byte{}
+
+	p.read(key, func(con *Conn) {
+		res = con.HKeysRand(key, limit)
+	})
+
+	return res
 }
 
-func (p *Proxy) SeqSize(seq []byte) int64 {
-	n := p.hash.Get(seq)
-	con := p.conns[n]
-	con.Lock()
+func (p *Proxy) SeqRange(seq []byte, limit, offset int64) [][]byte {
+	res := [][]byte{}
 
-	if con.KeepAlive() {
-		v := con.SeqSize(seq)
-		con.Unlock()
-		return v
-	}
+	p.read(seq, func(con *Conn) {
+		res = con.SeqRange(seq, limit, offset)
+	})
 
-	con.Unlock()
+	return res
+}
 
-	if QUORUM {
-		n = p.hash.Next(n)
-		con = p.conns[n]
-		con.Lock()
-		v := con.SeqSize(seq)
-		con.Unlock()
-		return v
-	}
+func (p *Proxy) HSize(key []byte) int64 {
+	var res int64
+
+	p.read(key, func(con *Conn) {
+		res = con.HSize(key)
+	})
+
+	return res
+}
+
+func (p *Proxy) SeqSize(seq []byte) int64 {
+	var res int64
+
+	p.read(seq, func(con *Conn) {
+		res = con.SeqSize(seq)
+	})
 
-	return 0
+	return res
 }
 
 func (p *Proxy) ZKill(key []byte, sync bool) {
-	n := p.hash.Get(key)
-	con := p.conns[n]
-	con.Lock()
-	defer con.Unlock()
-	con.ZKill(key, sync)
+	p.write(key, func(con *Conn) {
+		con.ZKill(key, sync)
+	})
 }
 
 func (p *Proxy) ZRange(key []byte, limit, offset, min, max int64) []ZRec {
-	n := p.hash.Get(key)
-	con := p.conns[n]
-	con.Lock()
-
-	if con.KeepAlive() {
-		v := con.ZRange(key, limit, offset, min, max)
-		con.Unlock()
-		return v
-	}
+	res := []ZRec{}
 
-	con.Unlock()
+	p.read(key, func(con *Conn) {
+		res = con.ZRange(key, limit, offset, min, max)
+	})
 
-	if QUORUM {
-		n = p.hash.Next(n)
-		con = p.conns[n]
-		con.Lock()
-		v := con.ZRange(key, limit, offset, min, max)
-		con.Unlock()
-		return v
-	}
-
-	return []ZRec{}
+	return res
 }
 
 func (p *Proxy) ZRangeSize(key []byte, min, max int64) int64 {
-	n := p.hash.Get(key)
-	con := p.conns[n]
-	con.Lock()
+	var res int64
 
-	if con.KeepAlive() {
-		v := con.ZRangeSize(key, min, max)
-		con.Unlock()
-		return v
-	}
+	p.read(key, func(con *Conn) {
+		res = con.ZRangeSize(key, min, max)
+	})
 
-	con.Unlock()
+	return res
+}
 
-	if QUORUM {
-		n = p.hash.Next(n)
-		con = p.conns[n]
-		con.Lock()
-		v := con.ZRangeSize(key, min, max)
-		con.Unlock()
-		return v
-	}
+func (p *Proxy) KeyTotal(n int) int64 {
+	var res int64
+
+	p.withContext(context.Background(), p.node(n), func(con *Conn) error {
+		res = con.KeyTotal()
+		return nil
+	})
 
-	return 0
+	return res
 }
 
 func (p *Proxy) Status() bool {
 
-	for _, c := range p.conns {
-		c.Lock()
-		c.Nop()
-		v := c.KeepAlive()
-		c.Unlock()
-		if !v {
+	for _, pool := range p.nodeList() {
+		err := p.withContext(context.Background(), pool, func(con *Conn) error {
+			con.Nop()
+			if !con.KeepAlive() {
+				return ErrNotConnected
+			}
+			return nil
+		})
+
+		if err != nil {
 			return false
 		}
 	}
 
 	return true
 }
+
+func (p *Proxy) Close() {
+	p.mt.Lock()
+	defer p.mt.Unlock()
+
+	select {
+	case <-p.done:
+		return
+	default:
+		close(p.done)
+	}
+
+	for _, pool := range append(p.pools, p.replicas...) {
+		if pool != nil {
+			pool.Close()
+		}
+	}
+
+	for _, pool := range p.extra {
+		pool.Close()
+	}
+}
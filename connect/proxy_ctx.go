@@ -0,0 +1,231 @@
+package connect
+
+import (
+	"context"
+	"errors"
+)
+
+var ErrNoNode = errors.New("node index out of range")
+
+// ClusterV2 methods of Proxy
+
+func (p *Proxy) SetContext(ctx context.Context, key, subkey []byte, value interface{}) error {
+	return p.writeContext(ctx, key, func(con *Conn) error {
+		return con.SetContext(ctx, key, subkey, value)
+	})
+}
+
+func (p *Proxy) SetIfMoreContext(ctx context.Context, key, subkey []byte, value int64) (res int64, err error) {
+	err = p.writeContext(ctx, key, func(con *Conn) (e error) {
+		res, e = con.SetIfMoreContext(ctx, key, subkey, value)
+		return
+	})
+	return
+}
+
+func (p *Proxy) BitAndContext(ctx context.Context, key, subkey []byte, value int64) (res int64, err error) {
+	err = p.writeContext(ctx, key, func(con *Conn) (e error) {
+		res, e = con.BitAndContext(ctx, key, subkey, value)
+		return
+	})
+	return
+}
+
+func (p *Proxy) BitAndNotContext(ctx context.Context, key, subkey []byte, value int64) (res int64, err error) {
+	err = p.writeContext(ctx, key, func(con *Conn) (e error) {
+		res, e = con.BitAndNotContext(ctx, key, subkey, value)
+		return
+	})
+	return
+}
+
+func (p *Proxy) BitOrContext(ctx context.Context, key, subkey []byte, value int64) (res int64, err error) {
+	err = p.writeContext(ctx, key, func(con *Conn) (e error) {
+		res, e = con.BitOrContext(ctx, key, subkey, value)
+		return
+	})
+	return
+}
+
+func (p *Proxy) BitXorContext(ctx context.Context, key, subkey []byte, value int64) (res int64, err error) {
+	err = p.writeContext(ctx, key, func(con *Conn) (e error) {
+		res, e = con.BitXorContext(ctx, key, subkey, value)
+		return
+	})
+	return
+}
+
+func (p *Proxy) SetNXContext(ctx context.Context, key, subkey []byte, value interface{}) (res bool, err error) {
+	err = p.writeContext(ctx, key, func(con *Conn) (e error) {
+		res, e = con.SetNXContext(ctx, key, subkey, value)
+		return
+	})
+	return
+}
+
+func (p *Proxy) GetContext(ctx context.Context, key, subkey []byte) (res []byte, found bool, err error) {
+	err = p.readContext(ctx, key, func(con *Conn) (e error) {
+		res, found, e = con.GetContext(ctx, key, subkey)
+		return
+	})
+	return
+}
+
+func (p *Proxy) GetIntContext(ctx context.Context, key, subkey []byte) (res int64, err error) {
+	err = p.readContext(ctx, key, func(con *Conn) (e error) {
+		res, e = con.GetIntContext(ctx, key, subkey)
+		return
+	})
+	return
+}
+
+func (p *Proxy) HasContext(ctx context.Context, key, subkey []byte) (res bool, err error) {
+	err = p.readContext(ctx, key, func(con *Conn) (e error) {
+		res, e = con.HasContext(ctx, key, subkey)
+		return
+	})
+	return
+}
+
+func (p *Proxy) DelContext(ctx context.Context, key, subkey []byte) (res bool, err error) {
+	err = p.writeContext(ctx, key, func(con *Conn) (e error) {
+		res, e = con.DelContext(ctx, key, subkey)
+		return
+	})
+	return
+}
+
+func (p *Proxy) IncContext(ctx context.Context, key, subkey []byte, val int64) (res int64, err error) {
+	err = p.writeContext(ctx, key, func(con *Conn) (e error) {
+		res, e = con.IncContext(ctx, key, subkey, val)
+		return
+	})
+	return
+}
+
+func (p *Proxy) DecContext(ctx context.Context, key, subkey []byte, val int64) (res int64, err error) {
+	err = p.writeContext(ctx, key, func(con *Conn) (e error) {
+		res, e = con.DecContext(ctx, key, subkey, val)
+		return
+	})
+	return
+}
+
+func (p *Proxy) SeqAddContext(ctx context.Context, seq []byte, value interface{}) error {
+	return p.writeContext(ctx, seq, func(con *Conn) error {
+		return con.SeqAddContext(ctx, seq, value)
+	})
+}
+
+func (p *Proxy) HKillContext(ctx context.Context, key []byte) error {
+	return p.writeContext(ctx, key, func(con *Conn) error {
+		return con.HKillContext(ctx, key)
+	})
+}
+
+func (p *Proxy) SeqKillContext(ctx context.Context, seq []byte) error {
+	return p.writeContext(ctx, seq, func(con *Conn) error {
+		return con.SeqKillContext(ctx, seq)
+	})
+}
+
+func (p *Proxy) HKeysAllContext(ctx context.Context, key []byte) (res [][]byte, err error) {
+	err = p.readContext(ctx, key, func(con *Conn) (e error) {
+		res, e = con.HKeysAllContext(ctx, key)
+		return
+	})
+	return
+}
+
+func (p *Proxy) HAllContext(ctx context.Context, key []byte) (res []Pair, err error) {
+	err = p.readContext(ctx, key, func(con *Conn) (e error) {
+		res, e = con.HAllContext(ctx, key)
+		return
+	})
+	return
+}
+
+func (p *Proxy) HKeysContext(ctx context.Context, key []byte, limit, offset int64) (res [][]byte, err error) {
+	err = p.readContext(ctx, key, func(con *Conn) (e error) {
+		res, e = con.HKeysContext(ctx, key, limit, offset)
+		return
+	})
+	return
+}
+
+func (p *Proxy) HKeysRandContext(ctx context.Context, key []byte, limit int64) (res [][]byte, err error) {
+	err = p.readContext(ctx, key, func(con *Conn) (e error) {
+		res, e = con.HKeysRandContext(ctx, key, limit)
+		return
+	})
+	return
+}
+
+func (p *Proxy) SeqRangeContext(ctx context.Context, seq []byte, limit, offset int64) (res [][]byte, err error) {
+	err = p.readContext(ctx, seq, func(con *Conn) (e error) {
+		res, e = con.SeqRangeContext(ctx, seq, limit, offset)
+		return
+	})
+	return
+}
+
+func (p *Proxy) HSizeContext(ctx context.Context, key []byte) (res int64, err error) {
+	err = p.readContext(ctx, key, func(con *Conn) (e error) {
+		res, e = con.HSizeContext(ctx, key)
+		return
+	})
+	return
+}
+
+func (p *Proxy) SeqSizeContext(ctx context.Context, seq []byte) (res int64, err error) {
+	err = p.readContext(ctx, seq, func(con *Conn) (e error) {
+		res, e = con.SeqSizeContext(ctx, seq)
+		return
+	})
+	return
+}
+
+func (p *Proxy) ZKillContext(ctx context.Context, key []byte) error {
+	return p.writeContext(ctx, key, func(con *Conn) error {
+		return con.ZKillContext(ctx, key)
+	})
+}
+
+func (p *Proxy) ZRangeContext(ctx context.Context, key []byte, limit, offset, min, max int64) (res []ZRec, err error) {
+	err = p.readContext(ctx, key, func(con *Conn) (e error) {
+		res, e = con.ZRangeContext(ctx, key, limit, offset, min, max)
+		return
+	})
+	return
+}
+
+func (p *Proxy) ZRangeSizeContext(ctx context.Context, key []byte, min, max int64) (res int64, err error) {
+	err = p.readContext(ctx, key, func(con *Conn) (e error) {
+		res, e = con.ZRangeSizeContext(ctx, key, min, max)
+		return
+	})
+	return
+}
+
+func (p *Proxy) KeyTotalContext(ctx context.Context, n int) (res int64, err error) {
+	err = p.withContext(ctx, p.node(n), func(con *Conn) (e error) {
+		res, e = con.KeyTotalContext(ctx, n)
+		return
+	})
+	return
+}
+
+// StatusContext returns the first error of the nodes
+func (p *Proxy) StatusContext(ctx context.Context) error {
+	for _, pool := range p.nodeList() {
+		err := p.withContext(ctx, pool, func(con *Conn) error {
+			return con.StatusContext(ctx)
+		})
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,224 @@
+package connect
+
+import (
+	"context"
+
+	"github.com/lj-team/lcluster/pb"
+)
+
+// ReplPosContext returns the last seq of log id applied by the replica,
+// -1 if the replica follows other log or its full copy is not finished
+func (n *Conn) ReplPosContext(ctx context.Context, id []byte) (int64, error) {
+
+	msg := &pb.LCPROTO{
+		Code: pb.LCPROTO_REPLPOS,
+		Key:  id,
+	}
+
+	r, err := n.roundTrip(ctx, msg)
+	if err != nil {
+		return 0, err
+	}
+
+	return r.Ivalue, nil
+}
+
+// PeerPosContext returns the last seq of log id of the node origin
+// applied by the peer of other datacenter, -1 if the log is unknown
+func (n *Conn) PeerPosContext(ctx context.Context, origin string, id []byte) (int64, error) {
+
+	msg := &pb.LCPROTO{
+		Code:   pb.LCPROTO_REPLPOS,
+		Key:    id,
+		Origin: origin,
+		Peer:   true,
+	}
+
+	r, err := n.roundTrip(ctx, msg)
+	if err != nil {
+		return 0, err
+	}
+
+	return r.Ivalue, nil
+}
+
+// ResyncContext starts full copy of log id on the replica if seq is 0,
+// the client keys of the replica are deleted by parts until it returns
+// false. Positive seq is the one the copy is consistent from, client
+// requests are rejected by the replica until it is applied. The replica
+// accepts it only from its primary
+func (n *Conn) ResyncContext(ctx context.Context, primary string, id []byte, seq int64) (bool, error) {
+
+	msg := &pb.LCPROTO{
+		Code:   pb.LCPROTO_RESYNC,
+		Key:    id,
+		Value:  []byte(primary),
+		Ivalue: seq,
+	}
+
+	r, err := n.roundTrip(ctx, msg)
+	if err != nil {
+		return false, err
+	}
+
+	return r.Ivalue == 1, nil
+}
+
+// SyncContext finishes full copy of log id sent by SYNC parts, the log
+// is applied from seq
+func (n *Conn) SyncContext(ctx context.Context, id []byte, seq int64) error {
+
+	msg := &pb.LCPROTO{
+		Code:   pb.LCPROTO_SYNC,
+		Key:    id,
+		Ivalue: seq,
+		Sync:   true,
+	}
+
+	_, err := n.roundTrip(ctx, msg)
+
+	return err
+}
+
+// RoleContext switches role of the node if role is not empty, the role
+// of the node is returned
+func (n *Conn) RoleContext(ctx context.Context, role string) (string, error) {
+
+	msg := &pb.LCPROTO{
+		Code:  pb.LCPROTO_ROLE,
+		Value: []byte(role),
+	}
+
+	r, err := n.roundTrip(ctx, msg)
+	if err != nil {
+		return "", err
+	}
+
+	return string(r.Value), nil
+}
+
+// ReplicaOfContext switches the node to replica of primary, writes to
+// the node are answered with ERR_READONLY and the primary address. The
+// primary sends its topology epoch and the time it is promoted at, the
+// node rejects the primary replaced by failover and returns the address
+// of the newer one
+func (n *Conn) ReplicaOfContext(ctx context.Context, primary string, epoch, promoted int64) (string, error) {
+
+	msg := &pb.LCPROTO{
+		Code:   pb.LCPROTO_ROLE,
+		Key:    []byte(primary),
+		Value:  []byte("replica"),
+		Ivalue: epoch,
+		Ts:     uint64(promoted),
+	}
+
+	r, err := n.roundTrip(ctx, msg)
+	if r == nil {
+		return "", err
+	}
+
+	return string(r.Value), err
+}
+
+// CheckContext compares digest of the key value read by the primary at
+// seq of log id with the replica value. It returns 1 if they are same, 0
+// if differ and -1 if the replica has not applied seq yet
+func (n *Conn) CheckContext(ctx context.Context, id []byte, seq int64, key, digest []byte) (int64, error) {
+
+	msg := &pb.LCPROTO{
+		Code:   pb.LCPROTO_CHECK,
+		Key:    key,
+		Value:  digest,
+		List:   [][]byte{id},
+		Ivalue: seq,
+	}
+
+	r, err := n.roundTrip(ctx, msg)
+	if err != nil {
+		return 0, err
+	}
+
+	return r.Ivalue, nil
+}
+
+// DigestPart is a range of keys returned by DigestContext, it ends before
+// the first key of the next part
+type DigestPart struct {
+	First  []byte
+	Digest pb.Digest
+}
+
+// DigestContext splits keys from start before end into parts of per
+// keys, empty end is after the last key. If the range has too many
+// parts, the end of the returned ones is returned too
+func (n *Conn) DigestContext(ctx context.Context, start, end []byte, per int64) ([]DigestPart, []byte, error) {
+
+	msg := &pb.LCPROTO{
+		Code:   pb.LCPROTO_DIGEST,
+		Key:    start,
+		Value:  end,
+		Ivalue: per,
+	}
+
+	r, err := n.roundTrip(ctx, msg)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	parts := make([]DigestPart, 0, len(r.List)/2)
+
+	for i := 0; i+1 < len(r.List); i += 2 {
+		parts = append(parts, DigestPart{First: r.List[i], Digest: pb.ParseDigest(r.List[i+1])})
+	}
+
+	if r.Ivalue == 1 {
+		return parts, r.Value, nil
+	}
+
+	return parts, nil, nil
+}
+
+// DigestPartsContext returns digests of the parts starting with starts,
+// the last one ends before end
+func (n *Conn) DigestPartsContext(ctx context.Context, starts [][]byte, end []byte) ([]pb.Digest, error) {
+
+	msg := &pb.LCPROTO{
+		Code:  pb.LCPROTO_DIGEST,
+		Value: end,
+		List:  starts,
+	}
+
+	r, err := n.roundTrip(ctx, msg)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(r.List) != len(starts) {
+		return nil, ErrInvalidResponse
+	}
+
+	list := make([]pb.Digest, len(r.List))
+
+	for i, d := range r.List {
+		list[i] = pb.ParseDigest(d)
+	}
+
+	return list, nil
+}
+
+// RepairContext makes the primary send the current values of keys to
+// its replicas, the number of keys is returned
+func (n *Conn) RepairContext(ctx context.Context, keys [][]byte) (int64, error) {
+
+	msg := &pb.LCPROTO{
+		Code: pb.LCPROTO_REPAIR,
+		List: keys,
+	}
+
+	r, err := n.roundTrip(ctx, msg)
+	if err != nil {
+		return 0, err
+	}
+
+	return r.Ivalue, nil
+}
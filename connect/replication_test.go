@@ -0,0 +1,34 @@
+package connect
+
+import (
+	"context"
+	"testing"
+
+	"github.com/lj-team/lcluster/pb"
+)
+
+func TestNotReplicated(t *testing.T) {
+
+	var hits int32
+
+	ln := handlerNode(t, &hits, func(msg *pb.LCPROTO) *pb.LCPROTO {
+		if msg.Acks != 2 {
+			return pb.ErrorResponse(pb.ERR_BAD_ARGS, "acks expected")
+		}
+		return &pb.LCPROTO{Ivalue: 3, Acks: 1, Async: true}
+	})
+	defer ln.Close()
+
+	c := NewConnWithOptions(ln.Addr().String(), &Options{Acks: 2})
+	defer c.Close()
+
+	res, err := c.IncContext(context.Background(), []byte("key"), nil, 1)
+	if err != ErrNotReplicated || res != 3 {
+		t.Fatal("ErrNotReplicated expected", err)
+	}
+
+	// legacy methods return the result of the node
+	if res = c.Inc([]byte("key"), nil, 1, true); res != 3 {
+		t.Fatal("result of the node expected", res)
+	}
+}
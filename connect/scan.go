@@ -0,0 +1,33 @@
+package connect
+
+import (
+	"context"
+
+	"github.com/lj-team/lcluster/pb"
+)
+
+// ScanContext returns raw keys and values of the node after cursor, nil
+// cursor starts from the beginning. more is false at the end
+func (n *Conn) ScanContext(ctx context.Context, cursor []byte, limit int) (list []Pair, more bool, err error) {
+
+	msg := &pb.LCPROTO{
+		Code:   pb.LCPROTO_SCAN,
+		Key:    cursor,
+		Ivalue: int64(limit),
+	}
+
+	r, err := n.callContext(ctx, msg)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return makePairs(r.List), r.Ivalue != 0, nil
+}
+
+// RouteKey returns part of the raw key used for placement
+func RouteKey(raw []byte) []byte {
+	if !validKey(raw) {
+		return nil
+	}
+	return raw[1:raw[0]]
+}
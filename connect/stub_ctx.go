@@ -0,0 +1,232 @@
+package connect
+
+import (
+	"context"
+)
+
+// ClusterV2 methods of Stub, only ctx errors are returned
+
+func (st *Stub) SetContext(ctx context.Context, key, subkey []byte, value interface{}) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	st.Set(key, subkey, value, true)
+
+	return nil
+}
+
+func (st *Stub) SetIfMoreContext(ctx context.Context, key, subkey []byte, value int64) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	return st.SetIfMore(key, subkey, value, true), nil
+}
+
+func (st *Stub) BitAndContext(ctx context.Context, key, subkey []byte, value int64) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	return st.BitAnd(key, subkey, value, true), nil
+}
+
+func (st *Stub) BitAndNotContext(ctx context.Context, key, subkey []byte, value int64) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	return st.BitAndNot(key, subkey, value, true), nil
+}
+
+func (st *Stub) BitOrContext(ctx context.Context, key, subkey []byte, value int64) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	return st.BitOr(key, subkey, value, true), nil
+}
+
+func (st *Stub) BitXorContext(ctx context.Context, key, subkey []byte, value int64) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	return st.BitXor(key, subkey, value, true), nil
+}
+
+func (st *Stub) SetNXContext(ctx context.Context, key, subkey []byte, value interface{}) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	return st.SetNX(key, subkey, value, true), nil
+}
+
+func (st *Stub) GetContext(ctx context.Context, key, subkey []byte) ([]byte, bool, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, false, err
+	}
+
+	res := st.Get(key, subkey)
+
+	return res, res != nil, nil
+}
+
+func (st *Stub) GetIntContext(ctx context.Context, key, subkey []byte) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	return st.GetInt(key, subkey), nil
+}
+
+func (st *Stub) HasContext(ctx context.Context, key, subkey []byte) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	return st.Has(key, subkey), nil
+}
+
+func (st *Stub) DelContext(ctx context.Context, key, subkey []byte) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	return st.Del(key, subkey, true), nil
+}
+
+func (st *Stub) IncContext(ctx context.Context, key, subkey []byte, val int64) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	// the node returns current value for nonpositive val too
+	if val <= 0 {
+		return st.GetInt(key, subkey), nil
+	}
+
+	return st.Inc(key, subkey, val, true), nil
+}
+
+func (st *Stub) DecContext(ctx context.Context, key, subkey []byte, val int64) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	if val <= 0 {
+		return st.GetInt(key, subkey), nil
+	}
+
+	return st.Dec(key, subkey, val, true), nil
+}
+
+func (st *Stub) SeqAddContext(ctx context.Context, seq []byte, value interface{}) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	st.SeqAdd(seq, value, true)
+
+	return nil
+}
+
+func (st *Stub) HKillContext(ctx context.Context, key []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	st.HKill(key, true)
+
+	return nil
+}
+
+func (st *Stub) SeqKillContext(ctx context.Context, seq []byte) error {
+	return st.HKillContext(ctx, seq)
+}
+
+func (st *Stub) HKeysAllContext(ctx context.Context, key []byte) ([][]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return st.HKeysAll(key), nil
+}
+
+func (st *Stub) HAllContext(ctx context.Context, key []byte) ([]Pair, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return st.HAll(key), nil
+}
+
+func (st *Stub) HKeysContext(ctx context.Context, key []byte, limit, offset int64) ([][]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return st.HKeys(key, limit, offset), nil
+}
+
+func (st *Stub) HKeysRandContext(ctx context.Context, key []byte, limit int64) ([][]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return st.HKeysRand(key, limit), nil
+}
+
+func (st *Stub) SeqRangeContext(ctx context.Context, seq []byte, limit, offset int64) ([][]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return st.SeqRange(seq, limit, offset), nil
+}
+
+func (st *Stub) HSizeContext(ctx context.Context, key []byte) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	return st.HSize(key), nil
+}
+
+func (st *Stub) KeyTotalContext(ctx context.Context, n int) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	return st.KeyTotal(n), nil
+}
+
+func (st *Stub) SeqSizeContext(ctx context.Context, seq []byte) (int64, error) {
+	return st.HSizeContext(ctx, seq)
+}
+
+func (st *Stub) ZKillContext(ctx context.Context, key []byte) error {
+	return st.HKillContext(ctx, key)
+}
+
+func (st *Stub) ZRangeContext(ctx context.Context, key []byte, limit, offset, min, max int64) ([]ZRec, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return st.ZRange(key, limit, offset, min, max), nil
+}
+
+func (st *Stub) ZRangeSizeContext(ctx context.Context, key []byte, min, max int64) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	return st.ZRangeSize(key, min, max), nil
+}
+
+func (st *Stub) StatusContext(ctx context.Context) error {
+	return ctx.Err()
+}
@@ -2,6 +2,7 @@ package connect
 
 import (
 	"bytes"
+	"context"
 	"testing"
 
 	"github.com/lj-team/go-generic/encode/pack"
@@ -291,3 +292,28 @@ func TestSub(t *testing.T) {
 		}
 	}
 }
+
+func TestStubContext(t *testing.T) {
+
+	st := NewStub().(ClusterV2)
+	ctx := context.Background()
+
+	if _, found, err := st.GetContext(ctx, []byte("k"), nil); found || err != nil {
+		t.Fatal("key must not be found")
+	}
+
+	if err := st.SetContext(ctx, []byte("k"), nil, int64(0)); err != nil {
+		t.Fatal(err)
+	}
+
+	if v, found, err := st.GetContext(ctx, []byte("k"), nil); !found || err != nil || pack.Bytes2Int(v) != 0 {
+		t.Fatal("zero value must be found")
+	}
+
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+
+	if _, err := st.GetIntContext(cctx, []byte("k"), nil); err != context.Canceled {
+		t.Fatal("canceled context must be reported")
+	}
+}
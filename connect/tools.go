@@ -16,13 +16,13 @@ func LoadNodeList(filename string) []string {
 		os.Exit(1)
 	}
 
-	var nodes []string
+	var nodes NodeList
 
 	if err = json.Unmarshal(data, &nodes); err != nil {
 		fmt.Println(err)
 		os.Exit(1)
 	}
 
-	return nodes
+	return nodes.Addrs()
 
 }
@@ -0,0 +1,221 @@
+package connect
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/lj-team/go-generic/log"
+	"github.com/lj-team/lcluster/hash"
+	"github.com/lj-team/lcluster/pb"
+)
+
+// DefaultRefresh is the interval of topology checks of Proxy made by seeds
+const DefaultRefresh = time.Second * 30
+
+var ErrNoTopology = errors.New("no topology on seed nodes")
+
+// Topology of the cluster stored by the nodes, the one with greater
+// Epoch replaces older ones
+type Topology struct {
+	Epoch  int64      `json:"epoch"`
+	Hash   string     `json:"hash"`
+	VNodes int        `json:"vnodes"`
+	Nodes  []NodeInfo `json:"nodes"`
+}
+
+func NewTopology(epoch int64, list *NodeList) *Topology {
+	return &Topology{
+		Epoch:  epoch,
+		Hash:   list.Hash,
+		VNodes: list.VNodes,
+		Nodes:  list.Nodes,
+	}
+}
+
+// List returns node list of the topology
+func (t *Topology) List() *NodeList {
+	return &NodeList{Hash: t.Hash, VNodes: t.VNodes, Nodes: t.Nodes}
+}
+
+func (t *Topology) Check() error {
+	if t.Epoch < 1 {
+		return errors.New("epoch must be positive")
+	}
+
+	if len(t.Nodes) == 0 {
+		return errors.New("empty node list")
+	}
+
+	if !hash.Valid(t.Hash) {
+		return errors.New("unknown hash type " + t.Hash)
+	}
+
+	return nil
+}
+
+// TopologyContext returns topology of the node if its epoch is greater
+// than known, nil otherwise
+func (n *Conn) TopologyContext(ctx context.Context, known int64) (*Topology, error) {
+
+	msg := &pb.LCPROTO{
+		Code:   pb.LCPROTO_TOPOLOGY,
+		Ivalue: known,
+	}
+
+	r, err := n.roundTrip(ctx, msg)
+	if err != nil || len(r.Value) == 0 {
+		return nil, err
+	}
+
+	var t Topology
+
+	if err = json.Unmarshal(r.Value, &t); err != nil {
+		return nil, err
+	}
+
+	return &t, nil
+}
+
+// SetTopologyContext saves topology on the node if it is newer than the
+// stored one. The epoch of the node is returned
+func (n *Conn) SetTopologyContext(ctx context.Context, t *Topology) (int64, error) {
+
+	msg := &pb.LCPROTO{
+		Code: pb.LCPROTO_SETTOPOLOGY,
+	}
+
+	msg.Value, _ = json.Marshal(t)
+
+	r, err := n.roundTrip(ctx, msg)
+	if err != nil {
+		return 0, err
+	}
+
+	return r.Ivalue, nil
+}
+
+// Discover returns topology of the first available seed node
+func Discover(ctx context.Context, seeds []string, opts *Options) (*Topology, error) {
+
+	err := ErrNoTopology
+
+	for _, addr := range seeds {
+		con := NewConnWithOptions(addr, opts)
+		t, e := con.TopologyContext(ctx, 0)
+		con.Close()
+
+		if e != nil {
+			log.Warn("topology of " + addr + ": " + e.Error())
+			err = e
+			continue
+		}
+
+		if t != nil {
+			return t, nil
+		}
+	}
+
+	return nil, err
+}
+
+// NewProxyFromSeeds makes Proxy by topology of seed nodes, the nodes are
+// asked for newer topology every Options.Refresh
+func NewProxyFromSeeds(seeds []string, opts *Options) (Cluster, error) {
+
+	ctx := context.Background()
+
+	if opts != nil && opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+
+	t, err := Discover(ctx, seeds, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	px, err := NewProxyFromList(t.List(), opts)
+	if err != nil {
+		return nil, err
+	}
+
+	p := px.(*Proxy)
+	p.epoch = t.Epoch
+
+	if interval := p.refresh(); interval > 0 {
+		go p.watch(interval)
+	}
+
+	return p, nil
+}
+
+func (p *Proxy) refresh() time.Duration {
+	if p.opts == nil || p.opts.Refresh == 0 {
+		return DefaultRefresh
+	}
+	return p.opts.Refresh
+}
+
+// watch checks topology of the nodes until Proxy is closed
+func (p *Proxy) watch(interval time.Duration) {
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-ticker.C:
+		}
+
+		p.checkTopology()
+	}
+}
+
+// checkTopology asks the nodes in order until one answers
+func (p *Proxy) checkTopology() {
+
+	p.mt.RLock()
+	epoch := p.epoch
+	p.mt.RUnlock()
+
+	for _, pool := range p.nodeList() {
+		var t *Topology
+
+		timeout := pool.opts.timeout()
+		if timeout < 0 {
+			timeout = DefaultTimeout
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+
+		err := p.withContext(ctx, pool, func(con *Conn) (e error) {
+			t, e = con.TopologyContext(ctx, epoch)
+			return
+		})
+
+		cancel()
+
+		if err != nil {
+			log.Trace("topology of " + pool.Addr + ": " + err.Error())
+			continue
+		}
+
+		if t != nil && t.Check() == nil {
+			p.mt.Lock()
+			if t.Epoch > p.epoch {
+				p.epoch = t.Epoch
+				if err = p.setList(t.List()); err != nil {
+					log.Error("topology of " + pool.Addr + ": " + err.Error())
+				}
+			}
+			p.mt.Unlock()
+		}
+
+		return
+	}
+}
@@ -0,0 +1,64 @@
+package connect
+
+import (
+	"context"
+	"encoding/json"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/lj-team/lcluster/pb"
+)
+
+func TestProxyFromSeeds(t *testing.T) {
+
+	var hitsA, hitsB int32
+
+	lnB := handlerNode(t, &hitsB, func(msg *pb.LCPROTO) *pb.LCPROTO {
+		return &pb.LCPROTO{Ivalue: 2}
+	})
+	defer lnB.Close()
+
+	var topology atomic.Value
+
+	lnA := handlerNode(t, &hitsA, func(msg *pb.LCPROTO) *pb.LCPROTO {
+		if msg.Code != pb.LCPROTO_TOPOLOGY {
+			return &pb.LCPROTO{Ivalue: 1}
+		}
+
+		t := topology.Load().(*Topology)
+		if t.Epoch <= msg.Ivalue {
+			return &pb.LCPROTO{Ivalue: t.Epoch}
+		}
+
+		data, _ := json.Marshal(t)
+		return &pb.LCPROTO{Ivalue: t.Epoch, Value: data}
+	})
+	defer lnA.Close()
+
+	addrA := lnA.Addr().String()
+	topology.Store(&Topology{Epoch: 1, Nodes: []NodeInfo{{Addr: addrA}}})
+
+	px, err := NewProxyFromSeeds([]string{"127.0.0.1:1", addrA}, &Options{Refresh: time.Millisecond * 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer px.(*Proxy).Close()
+
+	ctx := context.Background()
+
+	if res, _ := px.(ClusterV2).GetIntContext(ctx, []byte("key"), nil); res != 1 {
+		t.Fatal("node of the seed topology expected")
+	}
+
+	topology.Store(&Topology{Epoch: 2, Nodes: []NodeInfo{{Addr: lnB.Addr().String()}}})
+
+	for i := 0; i < 100; i++ {
+		if res, _ := px.(ClusterV2).GetIntContext(ctx, []byte("key"), nil); res == 2 {
+			return
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	t.Fatal("topology is not refreshed")
+}
@@ -1,10 +1,24 @@
 package connect
 
+import (
+	"time"
+)
+
 // вызывать реконнет в случае переполнения буфера
 var BUFFER_FULL_KILL bool = true
 
 // отправлять C_NOP после заданного числа последовательных асинхронных команд
+// (если не задано Options.NopAfter)
 var NOP_AFTER int = 50
 
-// включить кворум для чтения
+// включить кворум для чтения во всех Proxy (см. Options.Quorum)
 var QUORUM bool = false
+
+// размер очереди ответов для Send/Read
+var ORPHANS_SIZE int = 64
+
+// максимальное число переходов по ERR_MOVED/ERR_ASK для одного запроса
+var MAX_REDIRECTS int = 3
+
+// время ожидания ответа на AUTH
+var AUTH_TIMEOUT time.Duration = time.Second * 5
@@ -1,6 +1,22 @@
 package connect
 
+import (
+	"github.com/lj-team/go-generic/encode/pack"
+)
+
 type ZRec struct {
 	Key   []byte
 	Value int64
 }
+
+// makeZRecs converts list of keys and packed values to records
+func makeZRecs(list [][]byte) []ZRec {
+	res := make([]ZRec, len(list)/2)
+
+	for i := range res {
+		res[i].Key = list[i*2]
+		res[i].Value = pack.Bytes2Int(list[i*2+1])
+	}
+
+	return res
+}
@@ -0,0 +1,126 @@
+package engine
+
+import (
+	"bytes"
+
+	"github.com/lj-team/lcluster/pb"
+)
+
+// DIGEST_MAX_PARTS limits parts of a range in DIGEST request and response
+const DIGEST_MAX_PARTS = 1000
+
+// forEachRange calls fn for client keys from start before end in order,
+// empty end is after the last key
+func forEachRange(start, end []byte, fn func(key, value []byte) bool) {
+
+	visit := func(key, value []byte) bool {
+		if key[0] == 0 {
+			return true
+		}
+		if len(end) > 0 && bytes.Compare(key, end) >= 0 {
+			return false
+		}
+		return fn(key, value)
+	}
+
+	if len(start) == 0 {
+		forEachAfter([]byte{0}, false, visit)
+		return
+	}
+
+	if db.Has(start) && !visit(start, db.Get(start)) {
+		return
+	}
+
+	forEachAfter(start, true, visit)
+}
+
+// handleDigest splits the range into parts of ivalue keys and returns
+// their first keys and digests, or digests of the parts starting with
+// list keys. The replica is compared with the primary by the parts of
+// the primary
+func handleDigest(msg *pb.LCPROTO) *pb.LCPROTO {
+
+	if len(msg.List) > DIGEST_MAX_PARTS {
+		return badArgs("too many parts")
+	}
+
+	if len(msg.List) > 0 {
+		return digestParts(msg.List, msg.Value)
+	}
+
+	per := msg.Ivalue
+
+	if per <= 0 {
+		return badArgs("keys per part expected")
+	}
+
+	var list [][]byte
+	var first, next []byte
+	var part pb.Digest
+
+	mutex.Lock()
+
+	forEachRange(msg.Key, msg.Value, func(key, value []byte) bool {
+
+		if part.Count == per {
+			list = append(list, first, part.Bytes())
+			part = pb.Digest{}
+
+			if len(list) == DIGEST_MAX_PARTS*2 {
+				next = append([]byte{}, key...)
+				return false
+			}
+		}
+
+		if part.Count == 0 {
+			first = append([]byte{}, key...)
+		}
+
+		part.Add(key, value)
+
+		return true
+	})
+
+	mutex.Unlock()
+
+	if next != nil {
+		return &pb.LCPROTO{List: list, Value: next, Ivalue: 1}
+	}
+
+	if part.Count > 0 {
+		list = append(list, first, part.Bytes())
+	}
+
+	return &pb.LCPROTO{List: list}
+}
+
+// digestParts returns digests of parts starting with keys of starts, the
+// last one ends before end
+func digestParts(starts [][]byte, end []byte) *pb.LCPROTO {
+
+	parts := make([]pb.Digest, len(starts))
+	i := 0
+
+	mutex.Lock()
+
+	forEachRange(starts[0], end, func(key, value []byte) bool {
+		for i+1 < len(starts) && bytes.Compare(key, starts[i+1]) >= 0 {
+			i++
+		}
+
+		parts[i].Add(key, value)
+
+		return true
+	})
+
+	mutex.Unlock()
+
+	list := make([][]byte, len(parts))
+
+	for i, d := range parts {
+		list[i] = d.Bytes()
+	}
+
+	return &pb.LCPROTO{List: list}
+}
@@ -0,0 +1,55 @@
+package engine
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/lj-team/go-generic/db/ldb"
+	"github.com/lj-team/lcluster/pb"
+)
+
+func TestDigest(t *testing.T) {
+	ldb.Open("test=1 default=1")
+
+	keys := [][]byte{{5, 'a'}, {5, 'b'}, {5, 'b', 1}, {5, 'c'}, {5, 'd'}}
+
+	for _, k := range keys {
+		ldb.Set(k, []byte{1})
+	}
+	defer func() {
+		for _, k := range keys {
+			ldb.Del(k)
+		}
+	}()
+
+	start, end := []byte{5}, []byte{6}
+
+	res := handleDigest(&pb.LCPROTO{Key: start, Value: end, Ivalue: 2})
+
+	if len(res.List) != 6 || !bytes.Equal(res.List[2], keys[2]) || pb.ParseDigest(res.List[5]).Count != 1 {
+		t.Fatal("three parts expected")
+	}
+
+	// the same parts are digested by bounds
+	starts := [][]byte{start, res.List[2], res.List[4]}
+
+	parts := handleDigest(&pb.LCPROTO{List: starts, Value: end})
+
+	for i := range starts {
+		if !bytes.Equal(parts.List[i], res.List[i*2+1]) {
+			t.Fatal("digests of same parts differ", i)
+		}
+	}
+
+	ldb.Set(keys[1], []byte{2})
+
+	parts = handleDigest(&pb.LCPROTO{List: starts, Value: end})
+
+	if bytes.Equal(parts.List[0], res.List[1]) || !bytes.Equal(parts.List[1], res.List[3]) {
+		t.Fatal("only the changed part must differ")
+	}
+
+	if res = handleDigest(&pb.LCPROTO{Key: start, Value: end, Ivalue: 1}); len(res.List) != 10 {
+		t.Fatal("part per key expected")
+	}
+}
@@ -1,21 +1,18 @@
 package engine
 
 import (
-	"errors"
 	"math/rand"
 	"sort"
-	"sync"
 	"time"
 
 	"github.com/golang/protobuf/proto"
-	"github.com/lj-team/go-generic/db/ldb"
 	"github.com/lj-team/go-generic/encode/pack"
 	"github.com/lj-team/lcluster/pb"
 )
 
 type HANDLER func(*pb.LCPROTO) *pb.LCPROTO
 
-var mutex sync.Mutex
+var mutex batchMutex
 
 var callbacks map[pb.LCPROTO_Code]HANDLER = map[pb.LCPROTO_Code]HANDLER{
 	pb.LCPROTO_BITAND:      handleBitAND,
@@ -69,32 +66,75 @@ var callbacks map[pb.LCPROTO_Code]HANDLER = map[pb.LCPROTO_Code]HANDLER{
 	pb.LCPROTO_C_ZKILL:      handleCZKill,
 	pb.LCPROTO_C_ZRANGE:     handleCZRange,
 	pb.LCPROTO_C_ZRANGESIZE: handleCZRangeSize,
+
+	pb.LCPROTO_AUTH: handleAuth,
+	pb.LCPROTO_SCAN: handleScan,
+
+	pb.LCPROTO_MIGRATE:  handleMigrate,
+	pb.LCPROTO_MOVEKEYS: handleMoveKeys,
+
+	pb.LCPROTO_TOPOLOGY:    handleTopology,
+	pb.LCPROTO_SETTOPOLOGY: handleSetTopology,
+
+	pb.LCPROTO_PROMOTE: handlePromote,
+	pb.LCPROTO_REPLPOS: handleReplPos,
+	pb.LCPROTO_RESYNC:  handleResync,
+	pb.LCPROTO_SYNC:    handleSync,
+	pb.LCPROTO_ROLE:    handleRole,
+	pb.LCPROTO_CHECK:   handleCheck,
+	pb.LCPROTO_DIGEST:  handleDigest,
+	pb.LCPROTO_REPAIR:  handleRepair,
+	pb.LCPROTO_INFO:    handleInfo,
 }
 
-func handler(req []byte) ([]byte, error) {
+// handler replies at once unless the write waits for replicas to confirm
+// it, then reply is called by another goroutine and the connection goes on
+// with next requests
+func handler(req []byte, reply func([]byte)) error {
 
 	var msg pb.LCPROTO
 
 	err := proto.Unmarshal(req, &msg)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
 	f, ok := callbacks[msg.Code]
 	if !ok {
-		return nil, errors.New("unknown command code")
+		reply(response(&msg, pb.ErrorResponse(pb.ERR_UNKNOWN_CODE, "unknown command code "+msg.Code.String())))
+		return nil
+	}
+
+	res := route(&msg, f)
+
+	if confirmAcks(&msg, res) > 0 {
+		go func() {
+			confirm(&msg, res)
+			reply(response(&msg, res))
+		}()
+		return nil
 	}
 
-	res := f(&msg)
+	reply(response(&msg, res))
+
+	return nil
+}
+
+func response(msg, res *pb.LCPROTO) []byte {
 
 	if res == nil {
-		return nil, nil
+		return nil
 	}
 
 	res.Code = pb.LCPROTO_RESP
+	res.Id = msg.Id
 	rbuf, _ := proto.Marshal(res)
 
-	return rbuf, nil
+	return rbuf
+}
+
+func badArgs(message string) *pb.LCPROTO {
+	return pb.ErrorResponse(pb.ERR_BAD_ARGS, message)
 }
 
 func bool2Bytes(val bool) []byte {
@@ -111,29 +151,30 @@ func bool2Bytes(val bool) []byte {
 
 func handleDel(msg *pb.LCPROTO) *pb.LCPROTO {
 	mutex.Lock()
-	ldb.Del(msg.Key)
+	db.Del(msg.Key)
+	repl.Log(msg.Key, nil, pb.LOG_DEL)
 	mutex.Unlock()
-	repl.Log(msg.Key, nil, 1)
 	return nil
 }
 
 func handleCDel(msg *pb.LCPROTO) *pb.LCPROTO {
+	var seq int64
 	res := int64(1)
 	mutex.Lock()
 
-	if msg.Sync && !ldb.Has(msg.Key) {
+	if msg.Sync && !db.Has(msg.Key) {
 		res = 0
 	}
 
 	if res == 1 {
-		ldb.Del(msg.Key)
+		db.Del(msg.Key)
+		seq = repl.Log(msg.Key, nil, pb.LOG_DEL)
 	}
 
 	mutex.Unlock()
-	repl.Log(msg.Key, nil, 1)
 
 	if msg.Sync {
-		return &pb.LCPROTO{Ivalue: res}
+		return &pb.LCPROTO{Ivalue: res, Seq: seq}
 	}
 
 	return nil
@@ -141,49 +182,50 @@ func handleCDel(msg *pb.LCPROTO) *pb.LCPROTO {
 
 func handleDelR(msg *pb.LCPROTO) *pb.LCPROTO {
 	mutex.Lock()
-	has := ldb.Has(msg.Key)
+	has := db.Has(msg.Key)
 	if has {
-		ldb.Del(msg.Key)
+		db.Del(msg.Key)
+		repl.Log(msg.Key, nil, pb.LOG_DEL)
 	}
 	mutex.Unlock()
-	repl.Log(msg.Key, nil, 1)
 
 	return &pb.LCPROTO{Key: msg.Key, Value: bool2Bytes(has)}
 }
 
 func handleSet(msg *pb.LCPROTO) *pb.LCPROTO {
 	mutex.Lock()
-	ldb.Set(msg.Key, msg.Value)
+	db.Set(msg.Key, msg.Value)
+	repl.Log(msg.Key, msg.Value, pb.LOG_SET)
 	mutex.Unlock()
-	repl.Log(msg.Key, msg.Value, 1)
 	return nil
 }
 
 func handleCSet(msg *pb.LCPROTO) *pb.LCPROTO {
 	mutex.Lock()
-	ldb.Set(msg.Key, msg.Value)
+	db.Set(msg.Key, msg.Value)
+	seq := repl.Log(msg.Key, msg.Value, pb.LOG_SET)
 	mutex.Unlock()
-	repl.Log(msg.Key, msg.Value, 1)
 	if msg.Sync {
-		return &pb.LCPROTO{Ivalue: 1}
+		return &pb.LCPROTO{Ivalue: 1, Seq: seq}
 	}
 	return nil
 }
 
 func handleCSetIfMore(msg *pb.LCPROTO) *pb.LCPROTO {
+	var seq int64
 	mutex.Lock()
-	old := pack.Bytes2Int(ldb.Get(msg.Key))
+	old := pack.Bytes2Int(db.Get(msg.Key))
 	new := msg.Ivalue
 	if new > old {
-		ldb.Set(msg.Key, pack.Int2Bytes(new))
+		res := pack.Int2Bytes(new)
+		db.Set(msg.Key, res)
+		seq = repl.Log(msg.Key, res, pb.LOG_SET)
 		old = new
 	}
-	res := pack.Int2Bytes(old)
 	mutex.Unlock()
-	repl.Log(msg.Key, res, 1)
 
 	if msg.Sync {
-		return &pb.LCPROTO{Ivalue: old}
+		return &pb.LCPROTO{Ivalue: old, Seq: seq}
 	}
 
 	return nil
@@ -191,48 +233,60 @@ func handleCSetIfMore(msg *pb.LCPROTO) *pb.LCPROTO {
 
 func handleSetR(msg *pb.LCPROTO) *pb.LCPROTO {
 	mutex.Lock()
-	ldb.Set(msg.Key, msg.Value)
+	db.Set(msg.Key, msg.Value)
+	repl.Log(msg.Key, msg.Value, pb.LOG_SET)
 	mutex.Unlock()
-	repl.Log(msg.Key, msg.Value, 1)
 	return &pb.LCPROTO{Value: pack.Int2Bytes(1)}
 }
 
 func handleSetNX(msg *pb.LCPROTO) *pb.LCPROTO {
 	mutex.Lock()
-	has := ldb.Has(msg.Key)
-	ldb.Set(msg.Key, msg.Value)
+	has := db.Has(msg.Key)
+	db.Set(msg.Key, msg.Value)
+	repl.Log(msg.Key, msg.Value, pb.LOG_SET)
 	mutex.Unlock()
-	repl.Log(msg.Key, msg.Value, 1)
 
 	return &pb.LCPROTO{Value: bool2Bytes(!has)}
 }
 
 func handleCSetNX(msg *pb.LCPROTO) *pb.LCPROTO {
+	var seq int64
 	mutex.Lock()
-	has := ldb.Has(msg.Key)
+	has := db.Has(msg.Key)
 	if !has {
-		ldb.Set(msg.Key, msg.Value)
+		db.Set(msg.Key, msg.Value)
+		seq = repl.Log(msg.Key, msg.Value, pb.LOG_SET)
 	}
 	mutex.Unlock()
-	repl.Log(msg.Key, msg.Value, 1)
 
 	if msg.Sync {
-		return &pb.LCPROTO{Value: bool2Bytes(!has)}
+		return &pb.LCPROTO{Value: bool2Bytes(!has), Seq: seq}
 	}
 
 	return nil
 }
 
 func handleGet(msg *pb.LCPROTO) *pb.LCPROTO {
-	res := ldb.Get(msg.Key)
-	repl.Log(msg.Key, res, 1)
+	res := db.Get(msg.Key)
+	readRepair(msg.Key, res)
 	return &pb.LCPROTO{Value: res}
 }
 
 func handleCGet(msg *pb.LCPROTO) *pb.LCPROTO {
-	res := ldb.Get(msg.Key)
-	repl.Log(msg.Key, res, 1)
-	return &pb.LCPROTO{Value: res}
+	res := db.Get(msg.Key)
+	readRepair(msg.Key, res)
+
+	// empty value is found too
+	if res != nil {
+		return &pb.LCPROTO{Value: res, Ivalue: 1}
+	}
+
+	return &pb.LCPROTO{}
+}
+
+// connection is already authenticated or auth disabled
+func handleAuth(msg *pb.LCPROTO) *pb.LCPROTO {
+	return &pb.LCPROTO{Ivalue: 1}
 }
 
 func handleCNop(msg *pb.LCPROTO) *pb.LCPROTO {
@@ -240,26 +294,25 @@ func handleCNop(msg *pb.LCPROTO) *pb.LCPROTO {
 }
 
 func handleCGetInt(msg *pb.LCPROTO) *pb.LCPROTO {
-	res := ldb.Get(msg.Key)
-	repl.Log(msg.Key, res, 1)
+	res := db.Get(msg.Key)
+	readRepair(msg.Key, res)
 	val := pack.Bytes2Int(res)
 	return &pb.LCPROTO{Ivalue: val}
 }
 
 func handleCBitAND(msg *pb.LCPROTO) *pb.LCPROTO {
 	mutex.Lock()
-	res := ldb.Get(msg.Key)
+	res := db.Get(msg.Key)
 	v1 := pack.Bytes2Int(res)
 	v2 := msg.Ivalue
 	ires := v1 & v2
 	res = pack.Int2Bytes(ires)
-	ldb.Set(msg.Key, res)
+	db.Set(msg.Key, res)
+	seq := repl.Log(msg.Key, res, pb.LOG_SET)
 	mutex.Unlock()
 
-	repl.Log(msg.Key, res, 1)
-
 	if msg.Sync {
-		return &pb.LCPROTO{Ivalue: ires}
+		return &pb.LCPROTO{Ivalue: ires, Seq: seq}
 	}
 
 	return nil
@@ -267,18 +320,17 @@ func handleCBitAND(msg *pb.LCPROTO) *pb.LCPROTO {
 
 func handleCBitANDNOT(msg *pb.LCPROTO) *pb.LCPROTO {
 	mutex.Lock()
-	res := ldb.Get(msg.Key)
+	res := db.Get(msg.Key)
 	v1 := pack.Bytes2Int(res)
 	v2 := msg.Ivalue
 	ires := v1 &^ v2
 	res = pack.Int2Bytes(ires)
-	ldb.Set(msg.Key, res)
+	db.Set(msg.Key, res)
+	seq := repl.Log(msg.Key, res, pb.LOG_SET)
 	mutex.Unlock()
 
-	repl.Log(msg.Key, res, 1)
-
 	if msg.Sync {
-		return &pb.LCPROTO{Ivalue: ires}
+		return &pb.LCPROTO{Ivalue: ires, Seq: seq}
 	}
 
 	return nil
@@ -286,18 +338,17 @@ func handleCBitANDNOT(msg *pb.LCPROTO) *pb.LCPROTO {
 
 func handleCBitOR(msg *pb.LCPROTO) *pb.LCPROTO {
 	mutex.Lock()
-	res := ldb.Get(msg.Key)
+	res := db.Get(msg.Key)
 	v1 := pack.Bytes2Int(res)
 	v2 := msg.Ivalue
 	ires := v1 | v2
 	res = pack.Int2Bytes(ires)
-	ldb.Set(msg.Key, res)
+	db.Set(msg.Key, res)
+	seq := repl.Log(msg.Key, res, pb.LOG_SET)
 	mutex.Unlock()
 
-	repl.Log(msg.Key, res, 1)
-
 	if msg.Sync {
-		return &pb.LCPROTO{Ivalue: ires}
+		return &pb.LCPROTO{Ivalue: ires, Seq: seq}
 	}
 
 	return nil
@@ -305,60 +356,65 @@ func handleCBitOR(msg *pb.LCPROTO) *pb.LCPROTO {
 
 func handleCBitXOR(msg *pb.LCPROTO) *pb.LCPROTO {
 	mutex.Lock()
-	res := ldb.Get(msg.Key)
+	res := db.Get(msg.Key)
 	v1 := pack.Bytes2Int(res)
 	v2 := msg.Ivalue
 	ires := v1 ^ v2
 	res = pack.Int2Bytes(ires)
-	ldb.Set(msg.Key, res)
+	db.Set(msg.Key, res)
+	seq := repl.Log(msg.Key, res, pb.LOG_SET)
 	mutex.Unlock()
 
-	repl.Log(msg.Key, res, 1)
-
 	if msg.Sync {
-		return &pb.LCPROTO{Ivalue: ires}
+		return &pb.LCPROTO{Ivalue: ires, Seq: seq}
 	}
 
 	return nil
 }
 
 func handleBitAND(msg *pb.LCPROTO) *pb.LCPROTO {
-	res := ldb.Get(msg.Key)
+	mutex.Lock()
+	res := db.Get(msg.Key)
 	v1 := pack.Bytes2Int(res)
 	v2 := pack.Bytes2Int(msg.Value)
 	res = pack.Int2Bytes(v1 & v2)
-	ldb.Set(msg.Key, res)
-	repl.Log(msg.Key, res, 1)
+	db.Set(msg.Key, res)
+	repl.Log(msg.Key, res, pb.LOG_SET)
+	mutex.Unlock()
 	return nil
 }
 
 func handleBitOR(msg *pb.LCPROTO) *pb.LCPROTO {
-	res := ldb.Get(msg.Key)
+	mutex.Lock()
+	res := db.Get(msg.Key)
 	v1 := pack.Bytes2Int(res)
 	v2 := pack.Bytes2Int(msg.Value)
 	res = pack.Int2Bytes(v1 | v2)
-	ldb.Set(msg.Key, res)
-	repl.Log(msg.Key, res, 1)
+	db.Set(msg.Key, res)
+	repl.Log(msg.Key, res, pb.LOG_SET)
+	mutex.Unlock()
 	return nil
 }
 
 func handleBitXOR(msg *pb.LCPROTO) *pb.LCPROTO {
-	res := ldb.Get(msg.Key)
+	mutex.Lock()
+	res := db.Get(msg.Key)
 	v1 := pack.Bytes2Int(res)
 	v2 := pack.Bytes2Int(msg.Value)
 	res = pack.Int2Bytes(v1 ^ v2)
-	ldb.Set(msg.Key, res)
-	repl.Log(msg.Key, res, 1)
+	db.Set(msg.Key, res)
+	repl.Log(msg.Key, res, pb.LOG_SET)
+	mutex.Unlock()
 	return nil
 }
 
 func handleHas(msg *pb.LCPROTO) *pb.LCPROTO {
-	res := ldb.Has(msg.Key)
+	res := db.Has(msg.Key)
 	return &pb.LCPROTO{Value: bool2Bytes(res)}
 }
 
 func handleCHas(msg *pb.LCPROTO) *pb.LCPROTO {
-	res := ldb.Has(msg.Key)
+	res := db.Has(msg.Key)
 	data := int64(0)
 	if res {
 		data = 1
@@ -369,22 +425,23 @@ func handleCHas(msg *pb.LCPROTO) *pb.LCPROTO {
 func handleCInc(msg *pb.LCPROTO) *pb.LCPROTO {
 	mutex.Lock()
 
-	res := ldb.Get(msg.Key)
-	cur := pack.Bytes2Int(res)
+	res := db.Get(msg.Key)
+	old := pack.Bytes2Int(res)
+	cur := old
 
 	if msg.Ivalue > 0 {
 		cur = cur + msg.Ivalue
 	}
 
 	res = pack.Int2Bytes(cur)
-	ldb.Set(msg.Key, res)
+	db.Set(msg.Key, res)
 
-	mutex.Unlock()
+	seq := logIncBy(msg.Key, old, cur)
 
-	repl.Log(msg.Key, res, 1)
+	mutex.Unlock()
 
 	if msg.Sync {
-		return &pb.LCPROTO{Ivalue: cur}
+		return &pb.LCPROTO{Ivalue: cur, Seq: seq}
 	}
 
 	return nil
@@ -393,8 +450,9 @@ func handleCInc(msg *pb.LCPROTO) *pb.LCPROTO {
 func handleCDec(msg *pb.LCPROTO) *pb.LCPROTO {
 	mutex.Lock()
 
-	res := ldb.Get(msg.Key)
-	cur := pack.Bytes2Int(res)
+	res := db.Get(msg.Key)
+	old := pack.Bytes2Int(res)
+	cur := old
 
 	if msg.Ivalue > 0 {
 		cur = cur - msg.Ivalue
@@ -404,14 +462,14 @@ func handleCDec(msg *pb.LCPROTO) *pb.LCPROTO {
 	}
 
 	res = pack.Int2Bytes(cur)
-	ldb.Set(msg.Key, res)
+	db.Set(msg.Key, res)
 
-	mutex.Unlock()
+	seq := logIncBy(msg.Key, old, cur)
 
-	repl.Log(msg.Key, res, 1)
+	mutex.Unlock()
 
 	if msg.Sync {
-		return &pb.LCPROTO{Ivalue: cur}
+		return &pb.LCPROTO{Ivalue: cur, Seq: seq}
 	}
 
 	return nil
@@ -421,17 +479,18 @@ func handleIncr(msg *pb.LCPROTO) *pb.LCPROTO {
 
 	mutex.Lock()
 
-	res := ldb.Get(msg.Key)
+	res := db.Get(msg.Key)
 
-	val := pack.Bytes2Int(res)
+	old := pack.Bytes2Int(res)
+	val := old
 	val++
 	buf := pack.Int2Bytes(val)
 
-	ldb.Set(msg.Key, buf)
+	db.Set(msg.Key, buf)
 
-	mutex.Unlock()
+	logIncBy(msg.Key, old, val)
 
-	repl.Log(msg.Key, buf, 1)
+	mutex.Unlock()
 
 	return &pb.LCPROTO{Value: buf}
 }
@@ -440,9 +499,10 @@ func handleDecr(msg *pb.LCPROTO) *pb.LCPROTO {
 
 	mutex.Lock()
 
-	res := ldb.Get(msg.Key)
+	res := db.Get(msg.Key)
 
-	val := pack.Bytes2Int(res)
+	old := pack.Bytes2Int(res)
+	val := old
 
 	if val > 0 {
 		val--
@@ -450,11 +510,11 @@ func handleDecr(msg *pb.LCPROTO) *pb.LCPROTO {
 
 	buf := pack.Int2Bytes(val)
 
-	ldb.Set(msg.Key, buf)
+	db.Set(msg.Key, buf)
 
-	mutex.Unlock()
+	logIncBy(msg.Key, old, val)
 
-	repl.Log(msg.Key, buf, 1)
+	mutex.Unlock()
 
 	return &pb.LCPROTO{Value: buf}
 }
@@ -463,17 +523,18 @@ func handleInc(msg *pb.LCPROTO) *pb.LCPROTO {
 
 	mutex.Lock()
 
-	res := ldb.Get(msg.Key)
+	res := db.Get(msg.Key)
 
-	val := pack.Bytes2Int(res)
+	old := pack.Bytes2Int(res)
+	val := old
 	val++
 	buf := pack.Int2Bytes(val)
 
-	ldb.Set(msg.Key, buf)
+	db.Set(msg.Key, buf)
 
-	mutex.Unlock()
+	logIncBy(msg.Key, old, val)
 
-	repl.Log(msg.Key, buf, 1)
+	mutex.Unlock()
 
 	return nil
 }
@@ -482,18 +543,19 @@ func handleIncBy(msg *pb.LCPROTO) *pb.LCPROTO {
 
 	mutex.Lock()
 
-	res := ldb.Get(msg.Key)
+	res := db.Get(msg.Key)
 
-	val := pack.Bytes2Int(res)
+	old := pack.Bytes2Int(res)
+	val := old
 	val = val + pack.Bytes2Int(msg.Value)
 
 	buf := pack.Int2Bytes(val)
 
-	ldb.Set(msg.Key, buf)
+	db.Set(msg.Key, buf)
 
-	mutex.Unlock()
+	logIncBy(msg.Key, old, val)
 
-	repl.Log(msg.Key, buf, 1)
+	mutex.Unlock()
 
 	return nil
 }
@@ -501,9 +563,10 @@ func handleIncBy(msg *pb.LCPROTO) *pb.LCPROTO {
 func handleHKill(msg *pb.LCPROTO) *pb.LCPROTO {
 	mutex.Lock()
 
-	ldb.ForEach(msg.Key, false, func(key []byte, value []byte) bool {
-		ldb.Del(key)
-		repl.Log(key, nil, 1)
+	repl.Log(msg.Key, nil, pb.LOG_DELALL)
+
+	db.ForEach(msg.Key, false, func(key []byte, value []byte) bool {
+		db.Del(key)
 		return true
 	})
 
@@ -517,7 +580,7 @@ func handleHAll(msg *pb.LCPROTO) *pb.LCPROTO {
 
 	var res [][]byte
 
-	ldb.ForEach(msg.Key, true, func(key []byte, value []byte) bool {
+	db.ForEach(msg.Key, true, func(key []byte, value []byte) bool {
 
 		if res == nil {
 			res = make([][]byte, 0, 100)
@@ -553,7 +616,7 @@ func handleCHSize(msg *pb.LCPROTO) *pb.LCPROTO {
 
 	res := int64(0)
 
-	ldb.ForEach(msg.Key, true, func(key []byte, value []byte) bool {
+	db.ForEach(msg.Key, true, func(key []byte, value []byte) bool {
 		res++
 		return true
 	})
@@ -568,7 +631,7 @@ func handleHKeysTotal(msg *pb.LCPROTO) *pb.LCPROTO {
 
 	res := int64(0)
 
-	ldb.ForEach(msg.Key, true, func(key []byte, value []byte) bool {
+	db.ForEach(msg.Key, true, func(key []byte, value []byte) bool {
 		res++
 		return true
 	})
@@ -578,34 +641,29 @@ func handleHKeysTotal(msg *pb.LCPROTO) *pb.LCPROTO {
 	return &pb.LCPROTO{Value: pack.Int2Bytes(res)}
 }
 
-func handleKeyTotal(msg *pb.LCPROTO) *pb.LCPROTO {
+// keyTotal counts client keys, internal keys starting with zero byte
+// are skipped
+func keyTotal() int64 {
 	mutex.Lock()
 
 	res := int64(0)
 
-	ldb.ForEach([]byte{}, false, func(key []byte, value []byte) bool {
+	forEachAfter([]byte{0}, false, func(key []byte, value []byte) bool {
 		res++
 		return true
 	})
 
 	mutex.Unlock()
 
-	return &pb.LCPROTO{Value: pack.Int2Bytes(res)}
+	return res
 }
 
-func handleCKeyTotal(msg *pb.LCPROTO) *pb.LCPROTO {
-	mutex.Lock()
-
-	res := int64(0)
-
-	ldb.ForEach([]byte{}, false, func(key []byte, value []byte) bool {
-		res++
-		return true
-	})
-
-	mutex.Unlock()
+func handleKeyTotal(msg *pb.LCPROTO) *pb.LCPROTO {
+	return &pb.LCPROTO{Value: pack.Int2Bytes(keyTotal())}
+}
 
-	return &pb.LCPROTO{Ivalue: res}
+func handleCKeyTotal(msg *pb.LCPROTO) *pb.LCPROTO {
+	return &pb.LCPROTO{Ivalue: keyTotal()}
 }
 
 func handleCHKeys(msg *pb.LCPROTO) *pb.LCPROTO {
@@ -614,7 +672,12 @@ func handleCHKeys(msg *pb.LCPROTO) *pb.LCPROTO {
 	var res [][]byte
 	args := pack.Bytes2IntList(msg.Value)
 
-	if args == nil || len(args) != 2 || args[0] == 0 {
+	if len(args) != 2 {
+		mutex.Unlock()
+		return badArgs("limit and offset expected")
+	}
+
+	if args[0] == 0 {
 		mutex.Unlock()
 		return &pb.LCPROTO{List: res}
 	}
@@ -623,7 +686,7 @@ func handleCHKeys(msg *pb.LCPROTO) *pb.LCPROTO {
 	limit := args[0]
 	i := int64(-1)
 
-	ldb.ForEach(msg.Key, true, func(key []byte, value []byte) bool {
+	db.ForEach(msg.Key, true, func(key []byte, value []byte) bool {
 
 		i++
 
@@ -661,7 +724,7 @@ func handleCHAll(msg *pb.LCPROTO) *pb.LCPROTO {
 
 	i := int64(-1)
 
-	ldb.ForEach(msg.Key, true, func(key []byte, value []byte) bool {
+	db.ForEach(msg.Key, true, func(key []byte, value []byte) bool {
 
 		i++
 
@@ -693,7 +756,13 @@ func handleHKeysLimit(msg *pb.LCPROTO) *pb.LCPROTO {
 	var res [][]byte
 	args := pack.Bytes2IntList(msg.Value)
 
-	if args == nil || len(args) != 2 || args[0] == 0 {
+	if len(args) != 2 {
+		mutex.Unlock()
+		return badArgs("limit and offset expected")
+	}
+
+	if args[0] == 0 {
+		mutex.Unlock()
 		return &pb.LCPROTO{List: res}
 	}
 
@@ -701,7 +770,7 @@ func handleHKeysLimit(msg *pb.LCPROTO) *pb.LCPROTO {
 	limit := args[0]
 	i := int64(-1)
 
-	ldb.ForEach(msg.Key, true, func(key []byte, value []byte) bool {
+	db.ForEach(msg.Key, true, func(key []byte, value []byte) bool {
 
 		i++
 
@@ -739,7 +808,12 @@ func handleCHKeysRand(msg *pb.LCPROTO) *pb.LCPROTO {
 
 	limit := int64(100)
 
-	if msg.Value != nil && len(msg.Value) >= 8 {
+	if len(msg.Value) > 0 && len(msg.Value) < 8 {
+		mutex.Unlock()
+		return badArgs("invalid limit")
+	}
+
+	if len(msg.Value) >= 8 {
 		limit = pack.Bytes2Int(msg.Value)
 	}
 
@@ -752,7 +826,7 @@ func handleCHKeysRand(msg *pb.LCPROTO) *pb.LCPROTO {
 
 	rnd := rand.New(rand.NewSource(time.Now().UnixNano()))
 
-	ldb.ForEach(msg.Key, true, func(key []byte, value []byte) bool {
+	db.ForEach(msg.Key, true, func(key []byte, value []byte) bool {
 
 		i++
 
@@ -792,11 +866,17 @@ func handleHKeysRandom(msg *pb.LCPROTO) *pb.LCPROTO {
 
 	limit := int64(100)
 
-	if msg.Value != nil && len(msg.Value) >= 8 {
+	if len(msg.Value) > 0 && len(msg.Value) < 8 {
+		mutex.Unlock()
+		return badArgs("invalid limit")
+	}
+
+	if len(msg.Value) >= 8 {
 		limit = pack.Bytes2Int(msg.Value)
 	}
 
 	if limit < 1 {
+		mutex.Unlock()
 		return &pb.LCPROTO{List: nil}
 	}
 
@@ -804,7 +884,7 @@ func handleHKeysRandom(msg *pb.LCPROTO) *pb.LCPROTO {
 
 	rnd := rand.New(rand.NewSource(time.Now().UnixNano()))
 
-	ldb.ForEach(msg.Key, true, func(key []byte, value []byte) bool {
+	db.ForEach(msg.Key, true, func(key []byte, value []byte) bool {
 
 		i++
 
@@ -841,9 +921,10 @@ func handleDec(msg *pb.LCPROTO) *pb.LCPROTO {
 
 	mutex.Lock()
 
-	res := ldb.Get(msg.Key)
+	res := db.Get(msg.Key)
 
-	val := pack.Bytes2Int(res)
+	old := pack.Bytes2Int(res)
+	val := old
 
 	if val > 0 {
 		val--
@@ -851,11 +932,11 @@ func handleDec(msg *pb.LCPROTO) *pb.LCPROTO {
 
 	buf := pack.Int2Bytes(val)
 
-	ldb.Set(msg.Key, buf)
+	db.Set(msg.Key, buf)
 
-	mutex.Unlock()
+	logIncBy(msg.Key, old, val)
 
-	repl.Log(msg.Key, buf, 1)
+	mutex.Unlock()
 
 	return nil
 }
@@ -864,9 +945,10 @@ func handleDecBy(msg *pb.LCPROTO) *pb.LCPROTO {
 
 	mutex.Lock()
 
-	res := ldb.Get(msg.Key)
+	res := db.Get(msg.Key)
 
-	val := pack.Bytes2Int(res)
+	old := pack.Bytes2Int(res)
+	val := old
 	val = val - pack.Bytes2Int(msg.Value)
 
 	if val < 0 {
@@ -875,43 +957,29 @@ func handleDecBy(msg *pb.LCPROTO) *pb.LCPROTO {
 
 	buf := pack.Int2Bytes(val)
 
-	ldb.Set(msg.Key, buf)
-
-	mutex.Unlock()
-
-	repl.Log(msg.Key, buf, 1)
-
-	return nil
-}
+	db.Set(msg.Key, buf)
 
-func handleLog(msg *pb.LCPROTO) *pb.LCPROTO {
+	logIncBy(msg.Key, old, val)
 
-	mutex.Lock()
-	defer mutex.Unlock()
+	mutex.Unlock()
 
-	if msg.Counter == 1 {
-		if msg.Value == nil || len(msg.Value) == 0 {
-			ldb.Del(msg.Key)
-		} else {
-			ldb.Set(msg.Key, msg.Value)
-		}
-	}
 	return nil
 }
 
 func handleCHKill(msg *pb.LCPROTO) *pb.LCPROTO {
 	mutex.Lock()
 
-	ldb.ForEach(msg.Key, false, func(key []byte, value []byte) bool {
-		ldb.Del(key)
-		repl.Log(key, nil, 1)
+	seq := repl.Log(msg.Key, nil, pb.LOG_DELALL)
+
+	db.ForEach(msg.Key, false, func(key []byte, value []byte) bool {
+		db.Del(key)
 		return true
 	})
 
 	mutex.Unlock()
 
 	if msg.Sync {
-		return &pb.LCPROTO{Ivalue: 1}
+		return &pb.LCPROTO{Ivalue: 1, Seq: seq}
 	}
 
 	return nil
@@ -920,16 +988,17 @@ func handleCHKill(msg *pb.LCPROTO) *pb.LCPROTO {
 func handleCZKill(msg *pb.LCPROTO) *pb.LCPROTO {
 	mutex.Lock()
 
-	ldb.ForEach(msg.Key, false, func(key []byte, value []byte) bool {
-		ldb.Del(key)
-		repl.Log(key, nil, 1)
+	seq := repl.Log(msg.Key, nil, pb.LOG_DELALL)
+
+	db.ForEach(msg.Key, false, func(key []byte, value []byte) bool {
+		db.Del(key)
 		return true
 	})
 
 	mutex.Unlock()
 
 	if msg.Sync {
-		return &pb.LCPROTO{Ivalue: 1}
+		return &pb.LCPROTO{Ivalue: 1, Seq: seq}
 	}
 
 	return nil
@@ -941,7 +1010,7 @@ func handleCZRange(msg *pb.LCPROTO) *pb.LCPROTO {
 	args := pack.Bytes2IntList(msg.Value)
 	if len(args) != 4 {
 		mutex.Unlock()
-		return &pb.LCPROTO{List: [][]byte{}}
+		return badArgs("limit, offset, min and max expected")
 	}
 
 	limit := args[0]
@@ -949,6 +1018,11 @@ func handleCZRange(msg *pb.LCPROTO) *pb.LCPROTO {
 	min := args[2]
 	max := args[3]
 
+	if offset < 0 {
+		mutex.Unlock()
+		return badArgs("negative offset")
+	}
+
 	if limit < 1 || min > max {
 		mutex.Unlock()
 		return &pb.LCPROTO{List: [][]byte{}}
@@ -956,7 +1030,7 @@ func handleCZRange(msg *pb.LCPROTO) *pb.LCPROTO {
 
 	var list []*ZRec
 
-	ldb.ForEach(msg.Key, true, func(key []byte, value []byte) bool {
+	db.ForEach(msg.Key, true, func(key []byte, value []byte) bool {
 
 		if list == nil {
 			list = make([]*ZRec, 0, 100)
@@ -1007,7 +1081,7 @@ func handleCZRangeSize(msg *pb.LCPROTO) *pb.LCPROTO {
 	args := pack.Bytes2IntList(msg.Value)
 	if len(args) != 2 {
 		mutex.Unlock()
-		return &pb.LCPROTO{Ivalue: 0}
+		return badArgs("min and max expected")
 	}
 
 	min := args[0]
@@ -1020,7 +1094,7 @@ func handleCZRangeSize(msg *pb.LCPROTO) *pb.LCPROTO {
 
 	total := int64(0)
 
-	ldb.ForEach(msg.Key, true, func(key []byte, value []byte) bool {
+	db.ForEach(msg.Key, true, func(key []byte, value []byte) bool {
 
 		i := pack.Bytes2Int(value)
 
@@ -1039,9 +1113,10 @@ func handleCZRangeSize(msg *pb.LCPROTO) *pb.LCPROTO {
 func handleZKill(msg *pb.LCPROTO) *pb.LCPROTO {
 	mutex.Lock()
 
-	ldb.ForEach(msg.Key, false, func(key []byte, value []byte) bool {
-		ldb.Del(key)
-		repl.Log(key, nil, 1)
+	repl.Log(msg.Key, nil, pb.LOG_DELALL)
+
+	db.ForEach(msg.Key, false, func(key []byte, value []byte) bool {
+		db.Del(key)
 		return true
 	})
 
@@ -1055,7 +1130,8 @@ func handleZRange(msg *pb.LCPROTO) *pb.LCPROTO {
 
 	args := pack.Bytes2IntList(msg.Value)
 	if len(args) != 4 {
-		return &pb.LCPROTO{List: [][]byte{}}
+		mutex.Unlock()
+		return badArgs("limit, offset, min and max expected")
 	}
 
 	limit := args[0]
@@ -1063,13 +1139,19 @@ func handleZRange(msg *pb.LCPROTO) *pb.LCPROTO {
 	min := args[2]
 	max := args[3]
 
+	if offset < 0 {
+		mutex.Unlock()
+		return badArgs("negative offset")
+	}
+
 	if limit < 1 || min > max {
+		mutex.Unlock()
 		return &pb.LCPROTO{List: [][]byte{}}
 	}
 
 	var list []*ZRec
 
-	ldb.ForEach(msg.Key, true, func(key []byte, value []byte) bool {
+	db.ForEach(msg.Key, true, func(key []byte, value []byte) bool {
 
 		if list == nil {
 			list = make([]*ZRec, 0, 100)
@@ -1119,19 +1201,21 @@ func handleZRangeSize(msg *pb.LCPROTO) *pb.LCPROTO {
 
 	args := pack.Bytes2IntList(msg.Value)
 	if len(args) != 2 {
-		return &pb.LCPROTO{Value: pack.Int2Bytes(int64(0))}
+		mutex.Unlock()
+		return badArgs("min and max expected")
 	}
 
 	min := args[0]
 	max := args[1]
 
 	if min > max {
+		mutex.Unlock()
 		return &pb.LCPROTO{Value: pack.Int2Bytes(int64(0))}
 	}
 
 	total := int64(0)
 
-	ldb.ForEach(msg.Key, true, func(key []byte, value []byte) bool {
+	db.ForEach(msg.Key, true, func(key []byte, value []byte) bool {
 
 		i := pack.Bytes2Int(value)
 
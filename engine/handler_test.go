@@ -3,7 +3,10 @@ package engine
 import (
 	"testing"
 
+	"github.com/golang/protobuf/proto"
 	"github.com/lj-team/go-generic/db/ldb"
+	"github.com/lj-team/go-generic/encode/pack"
+	"github.com/lj-team/lcluster/pb"
 )
 
 func TestEngine(t *testing.T) {
@@ -26,3 +29,77 @@ func TestEngine(t *testing.T) {
 	tBB(true)
 	tBB(false)
 }
+
+func TestErrorResponses(t *testing.T) {
+	ldb.Open("test=1 default=1")
+
+	call := func(msg *pb.LCPROTO) *pb.LCPROTO {
+		req, _ := proto.Marshal(msg)
+
+		var buf []byte
+
+		err := handler(req, func(res []byte) { buf = res })
+		if err != nil {
+			t.Fatal("connection must not be closed")
+		}
+
+		var res pb.LCPROTO
+		if err = proto.Unmarshal(buf, &res); err != nil {
+			t.Fatal(err)
+		}
+
+		if res.Id != msg.Id {
+			t.Fatal("invalid response id")
+		}
+
+		return &res
+	}
+
+	res := call(&pb.LCPROTO{Code: pb.LCPROTO_Code(1000), Id: 1})
+	if res.ErrCode != pb.ERR_UNKNOWN_CODE {
+		t.Fatal("unknown code must be reported")
+	}
+
+	res = call(&pb.LCPROTO{Code: pb.LCPROTO_C_ZRANGE, Id: 2, Key: []byte{2, 'z'}, Value: pack.IntList2Bytes([]int64{10, 0, 1})})
+	if e, ok := res.Err().(*pb.Error); !ok || e.Code != pb.ERR_BAD_ARGS {
+		t.Fatal("wrong arity must be reported")
+	}
+
+	res = call(&pb.LCPROTO{Code: pb.LCPROTO_C_ZRANGE, Id: 3, Key: []byte{2, 'z'}, Value: pack.IntList2Bytes([]int64{10, 0, 1, 2})})
+	if res.Err() != nil {
+		t.Fatal(res.Err())
+	}
+}
+
+func TestGetFound(t *testing.T) {
+	ldb.Open("test=1 default=1")
+
+	key := []byte{2, 'g', 'f'}
+
+	if res := handleCGet(&pb.LCPROTO{Key: key}); res.Ivalue != 0 || res.Value != nil {
+		t.Fatal("missing key must not be found")
+	}
+
+	ldb.Set(key, []byte("v"))
+
+	if res := handleCGet(&pb.LCPROTO{Key: key}); res.Ivalue != 1 || string(res.Value) != "v" {
+		t.Fatal("found flag expected")
+	}
+}
+
+func TestKeyTotal(t *testing.T) {
+	ldb.Open("test=1 default=1")
+
+	ldb.Set([]byte{2, 'a'}, []byte("v"))
+	ldb.Set([]byte{2, 'b'}, []byte("v"))
+	ldb.Set([]byte("\x00log:1"), []byte("v"))
+	ldb.Set([]byte("\x00ts:\x02a"), []byte("v"))
+
+	if res := handleCKeyTotal(&pb.LCPROTO{}); res.Ivalue != 2 {
+		t.Fatal("internal keys must not be counted", res.Ivalue)
+	}
+
+	if res := handleKeyTotal(&pb.LCPROTO{}); pack.Bytes2Int(res.Value) != 2 {
+		t.Fatal("internal keys must not be counted")
+	}
+}
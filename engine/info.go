@@ -0,0 +1,45 @@
+package engine
+
+import (
+	"encoding/json"
+	"sync/atomic"
+
+	"github.com/lj-team/lcluster/connect"
+	"github.com/lj-team/lcluster/pb"
+)
+
+// handleInfo returns the role, log positions of the node and the state
+// of replication to its replicas and peers
+func handleInfo(msg *pb.LCPROTO) *pb.LCPROTO {
+
+	id, first, last, _ := rlog.State()
+
+	info := &connect.Info{
+		Role:     currentRole(),
+		Log:      string(id),
+		First:    first,
+		Last:     last,
+		Syncing:  atomic.LoadInt32(&syncing) == 1,
+		Replicas: []connect.ReplicaInfo{},
+		Origin:   origin,
+		Peers:    []connect.ReplicaInfo{},
+	}
+
+	mutex.Lock()
+	loadApplied()
+	info.Primary = string(applied.id)
+	info.Applied = applied.seq
+	mutex.Unlock()
+
+	for _, r := range repl.List() {
+		info.Replicas = append(info.Replicas, r.Info())
+	}
+
+	for _, r := range dcPeers.List() {
+		info.Peers = append(info.Peers, r.Info())
+	}
+
+	data, _ := json.Marshal(info)
+
+	return &pb.LCPROTO{Value: data}
+}
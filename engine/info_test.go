@@ -0,0 +1,35 @@
+package engine
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/lj-team/go-generic/db/ldb"
+	"github.com/lj-team/lcluster/connect"
+	"github.com/lj-team/lcluster/pb"
+)
+
+func TestInfo(t *testing.T) {
+	ldb.Open("test=1 default=1")
+
+	repl.Set([]string{"127.0.0.1:1"})
+	defer repl.Close()
+
+	handleCSet(&pb.LCPROTO{Key: []byte{2, 'i'}, Value: []byte("v")})
+
+	var info connect.Info
+
+	if err := json.Unmarshal(handleInfo(&pb.LCPROTO{}).Value, &info); err != nil {
+		t.Fatal(err)
+	}
+
+	if info.Role != ROLE_PRIMARY || info.Last < 1 || len(info.Replicas) != 1 {
+		t.Fatal("state of primary with one replica expected")
+	}
+
+	r := info.Replicas[0]
+
+	if r.Addr != "127.0.0.1:1" || r.Acked != -1 || r.Pending != -1 || r.PendingBytes != -1 {
+		t.Fatal("unknown position of replica expected", r)
+	}
+}
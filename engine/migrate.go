@@ -0,0 +1,528 @@
+package engine
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+
+	"github.com/lj-team/go-generic/log"
+	"github.com/lj-team/lcluster/connect"
+	"github.com/lj-team/lcluster/hash"
+	"github.com/lj-team/lcluster/pb"
+)
+
+// migration of keys to a new node list. While keys are moved (MIGRATE_ASK)
+// the node serves keys of other nodes which are still stored here and
+// answers ERR_ASK for the rest. When all keys are moved (MIGRATE_MOVED)
+// ERR_MOVED with the new list is returned for keys of other nodes
+type migration struct {
+	Self  string            `json:"self"` // address of the node in the list
+	State int64             `json:"state"`
+	List  *connect.NodeList `json:"list"`
+
+	addrs []string
+	place hash.Placement
+	data  []byte // list json for ERR_MOVED
+}
+
+var migrationKey = []byte("\x00migration")
+
+// migrating is held for read by requests and for write by moving of
+// keys, so a request never sees a key half-moved
+var migrating sync.RWMutex
+
+// migr is protected by migrating
+var migr *migration
+
+// frozen is the prefix with the last changes being moved, requests of its
+// keys wait until done is closed. Protected by migrating
+var frozen struct {
+	prefix string
+	done   chan struct{}
+}
+
+var peers = map[string]*connect.Conn{}
+var peersMutex sync.Mutex
+
+// peerOpts of connections to other nodes, they share replica credentials
+var peerOpts = &connect.Options{}
+
+// unrouted commands are not redirected
+var unrouted = map[pb.LCPROTO_Code]bool{
+	pb.LCPROTO_NOP:        true,
+	pb.LCPROTO_LOG:        true,
+	pb.LCPROTO_KEYTOTAL:   true,
+	pb.LCPROTO_C_KEYTOTAL: true,
+	pb.LCPROTO_C_NOP:      true,
+	pb.LCPROTO_AUTH:       true,
+	pb.LCPROTO_SCAN:       true,
+	pb.LCPROTO_MIGRATE:    true,
+	pb.LCPROTO_MOVEKEYS:   true,
+
+	pb.LCPROTO_TOPOLOGY:    true,
+	pb.LCPROTO_SETTOPOLOGY: true,
+	pb.LCPROTO_PROMOTE:     true,
+	pb.LCPROTO_REPLPOS:     true,
+	pb.LCPROTO_RESYNC:      true,
+	pb.LCPROTO_SYNC:        true,
+	pb.LCPROTO_ROLE:        true,
+	pb.LCPROTO_CHECK:       true,
+	pb.LCPROTO_DIGEST:      true,
+	pb.LCPROTO_REPAIR:      true,
+	pb.LCPROTO_INFO:        true,
+}
+
+// replyIfSync lists commands without response: true - the response is
+// sent if sync flag is set, false - never
+var replyIfSync = map[pb.LCPROTO_Code]bool{
+	pb.LCPROTO_BITAND: false,
+	pb.LCPROTO_BITOR:  false,
+	pb.LCPROTO_BITXOR: false,
+	pb.LCPROTO_DEC:    false,
+	pb.LCPROTO_DECBY:  false,
+	pb.LCPROTO_DEL:    false,
+	pb.LCPROTO_HKILL:  false,
+	pb.LCPROTO_INC:    false,
+	pb.LCPROTO_INCBY:  false,
+	pb.LCPROTO_SET:    false,
+	pb.LCPROTO_ZKILL:  false,
+
+	pb.LCPROTO_C_BITAND:    true,
+	pb.LCPROTO_C_BITANDNOT: true,
+	pb.LCPROTO_C_BITOR:     true,
+	pb.LCPROTO_C_BITXOR:    true,
+	pb.LCPROTO_C_DEC:       true,
+	pb.LCPROTO_C_DEL:       true,
+	pb.LCPROTO_C_HKILL:     true,
+	pb.LCPROTO_C_INC:       true,
+	pb.LCPROTO_C_SET:       true,
+	pb.LCPROTO_C_SETIFMORE: true,
+	pb.LCPROTO_C_SETNX:     true,
+	pb.LCPROTO_C_ZKILL:     true,
+
+	pb.LCPROTO_SYNC: true,
+}
+
+// noReply returns true if the client does not wait for the response
+func noReply(msg *pb.LCPROTO) bool {
+	sync, ok := replyIfSync[msg.Code]
+	return ok && !(sync && msg.Sync)
+}
+
+// validKey checks raw key: first byte is length of routing part plus one
+func validKey(key []byte) bool {
+	return len(key) > 0 && key[0] > 0 && int(key[0]) <= len(key)
+}
+
+func newMigration(self string, state int64, data []byte) (*migration, error) {
+	m := &migration{Self: self, State: state}
+
+	if err := json.Unmarshal(data, &m.List); err != nil {
+		return nil, err
+	}
+
+	if err := m.init(); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+func (m *migration) init() error {
+	if m.List == nil || len(m.List.Nodes) == 0 {
+		return errors.New("empty node list")
+	}
+
+	if m.State != pb.MIGRATE_ASK && m.State != pb.MIGRATE_MOVED {
+		return errors.New("unknown migration state")
+	}
+
+	place, err := m.List.Placement()
+	if err != nil {
+		return err
+	}
+
+	m.addrs = m.List.Addrs()
+	m.place = place
+	m.data, _ = json.Marshal(m.List)
+
+	return nil
+}
+
+// owner returns address of the node of the prefix key[:key[0]]
+func (m *migration) owner(prefix []byte) string {
+	return m.addrs[m.place.Get(prefix[1:])]
+}
+
+// redirect returns response for keys of other nodes, done is false if
+// the request is served here. Called with migrating locked for read
+func (m *migration) redirect(msg *pb.LCPROTO) (res *pb.LCPROTO, done bool) {
+
+	if !validKey(msg.Key) {
+		return nil, false
+	}
+
+	prefix := msg.Key[:msg.Key[0]]
+	addr := m.owner(prefix)
+
+	if addr == m.Self {
+		return nil, false
+	}
+
+	if m.State == pb.MIGRATE_ASK && hasPrefix(prefix) {
+		return nil, false
+	}
+
+	// the client does not read the response, so the request is passed
+	if noReply(msg) {
+		peer(addr).Post(msg)
+		return nil, true
+	}
+
+	if m.State == pb.MIGRATE_ASK {
+		return pb.ErrorResponse(pb.ERR_ASK, addr), true
+	}
+
+	res = pb.ErrorResponse(pb.ERR_MOVED, addr)
+	res.Value = m.data
+
+	return res, true
+}
+
+func hasPrefix(prefix []byte) bool {
+	found := false
+
+	mutex.Lock()
+
+	db.ForEach(prefix, false, func(key, value []byte) bool {
+		found = true
+		return false
+	})
+
+	mutex.Unlock()
+
+	return found
+}
+
+func peer(addr string) *connect.Conn {
+	peersMutex.Lock()
+	defer peersMutex.Unlock()
+
+	c, ok := peers[addr]
+	if !ok {
+		c = connect.NewConnWithOptions(addr, peerOpts)
+		peers[addr] = c
+	}
+
+	return c
+}
+
+// route runs f or returns redirect if the key belongs to other node
+func route(msg *pb.LCPROTO, f HANDLER) *pb.LCPROTO {
+
+	if unrouted[msg.Code] {
+		return f(msg)
+	}
+
+	if res, done := unsynced(msg); done {
+		return res
+	}
+
+	if res, done := readOnly(msg); done {
+		return res
+	}
+
+	migrating.RLock()
+
+	for isFrozen(msg.Key) {
+		done := frozen.done
+		migrating.RUnlock()
+		<-done
+		migrating.RLock()
+	}
+
+	defer migrating.RUnlock()
+
+	if migr != nil {
+		if res, done := migr.redirect(msg); done {
+			return res
+		}
+	}
+
+	return f(msg)
+}
+
+// isFrozen reports whether the key prefix is being moved. Called with
+// migrating locked for read
+func isFrozen(key []byte) bool {
+	return frozen.done != nil && validKey(key) && string(key[:key[0]]) == frozen.prefix
+}
+
+// loadMigration restores migration state saved by MIGRATE
+func loadMigration() {
+	mutex.Lock()
+	data := db.Get(migrationKey)
+	mutex.Unlock()
+
+	if data == nil {
+		return
+	}
+
+	m := &migration{}
+
+	if err := json.Unmarshal(data, m); err != nil {
+		log.Error("migration state: " + err.Error())
+		return
+	}
+
+	if err := m.init(); err != nil {
+		log.Error("migration state: " + err.Error())
+		return
+	}
+
+	migrating.Lock()
+	migr = m
+	migrating.Unlock()
+}
+
+// handleMigrate sets migration state, MIGRATE_NONE stops redirects
+func handleMigrate(msg *pb.LCPROTO) *pb.LCPROTO {
+
+	var m *migration
+
+	if msg.Ivalue != pb.MIGRATE_NONE {
+		var err error
+
+		if m, err = newMigration(string(msg.Key), msg.Ivalue, msg.Value); err != nil {
+			return badArgs(err.Error())
+		}
+	}
+
+	migrating.Lock()
+
+	migr = m
+
+	mutex.Lock()
+	if m == nil {
+		db.Del(migrationKey)
+	} else {
+		data, _ := json.Marshal(m)
+		db.Set(migrationKey, data)
+	}
+	mutex.Unlock()
+
+	migrating.Unlock()
+
+	if m == nil {
+		log.Info("migration stopped")
+	} else {
+		log.Info("migration state " + string(m.data))
+	}
+
+	return &pb.LCPROTO{Ivalue: 1}
+}
+
+// handleMoveKeys moves keys of other nodes after cursor to their owners,
+// limit is the number of checked keys
+func handleMoveKeys(msg *pb.LCPROTO) *pb.LCPROTO {
+
+	limit := int(msg.Ivalue)
+
+	if limit < 0 {
+		return badArgs("negative limit")
+	}
+
+	if limit == 0 {
+		limit = SCAN_LIMIT
+	}
+
+	if limit > SCAN_MAX_LIMIT {
+		limit = SCAN_MAX_LIMIT
+	}
+
+	migrating.RLock()
+	m := migr
+	migrating.RUnlock()
+
+	if m == nil || m.State != pb.MIGRATE_ASK {
+		return badArgs("no migration in progress")
+	}
+
+	cursor, subtree := msg.Key, true
+	if len(cursor) == 0 {
+		cursor, subtree = []byte{0}, false
+	}
+
+	var prefixes [][]byte
+	var last []byte
+
+	checked := 0
+	more := int64(0)
+
+	mutex.Lock()
+
+	forEachAfter(cursor, subtree, func(key, value []byte) bool {
+		if checked >= limit {
+			more = 1
+			return false
+		}
+
+		checked++
+		last = append(last[:0], key...)
+
+		if key[0] == 0 || !validKey(key) {
+			return true
+		}
+
+		prefix := key[:key[0]]
+
+		if size := len(prefixes); size > 0 && string(prefixes[size-1]) == string(prefix) {
+			return true
+		}
+
+		if m.owner(prefix) != m.Self {
+			prefixes = append(prefixes, append([]byte{}, prefix...))
+		}
+
+		return true
+	})
+
+	mutex.Unlock()
+
+	moved := 0
+
+	for _, prefix := range prefixes {
+		n, err := moveKeys(m, prefix)
+		moved += n
+
+		if err != nil {
+			res := pb.ErrorResponse(pb.ERR_UNAVAILABLE, err.Error())
+			res.Counter = int32(moved)
+			return res
+		}
+	}
+
+	return &pb.LCPROTO{Key: last, Ivalue: more, Counter: int32(moved)}
+}
+
+// moveRounds of copying with requests served, keys changed meanwhile are
+// copied again, the last time with requests of the prefix waiting
+const moveRounds = 3
+
+// moveKeys copies keys with the prefix to the owner and deletes them. Keys
+// are copied while requests are served, then the prefix is frozen: its
+// requests wait until the last changes are copied and the keys are
+// deleted, other keys are served. The keys of the prefix are deleted
+// together, so requests are served here or redirected for all of them
+func moveKeys(m *migration, prefix []byte) (int, error) {
+
+	addr := m.owner(prefix)
+	con := peer(addr)
+
+	copied := map[string]string{}
+
+	// send copies changed keys and deletes keys deleted here
+	send := func() error {
+		cur := prefixKeys(prefix)
+
+		for key, value := range cur {
+			if old, ok := copied[key]; ok && old == value {
+				continue
+			}
+
+			_, err := con.Call(&pb.LCPROTO{Code: pb.LCPROTO_C_SET, Key: []byte(key), Value: []byte(value), Sync: true})
+			if err != nil {
+				return errors.New("move to " + addr + ": " + err.Error())
+			}
+
+			copied[key] = value
+		}
+
+		for key := range copied {
+			if _, ok := cur[key]; ok {
+				continue
+			}
+
+			if _, err := con.Call(&pb.LCPROTO{Code: pb.LCPROTO_C_DEL, Key: []byte(key), Sync: true}); err != nil {
+				return errors.New("move to " + addr + ": " + err.Error())
+			}
+
+			delete(copied, key)
+		}
+
+		return nil
+	}
+
+	for round := 1; ; round++ {
+		if err := send(); err != nil {
+			return 0, err
+		}
+
+		if round == moveRounds || !prefixChanged(prefix, copied) {
+			break
+		}
+	}
+
+	done := make(chan struct{})
+
+	// the lock waits for requests already routed
+	migrating.Lock()
+	frozen.prefix, frozen.done = string(prefix), done
+	migrating.Unlock()
+
+	defer func() {
+		migrating.Lock()
+		frozen.prefix, frozen.done = "", nil
+		migrating.Unlock()
+
+		close(done)
+	}()
+
+	if err := send(); err != nil {
+		return 0, err
+	}
+
+	mutex.Lock()
+	for key := range copied {
+		db.Del([]byte(key))
+		repl.Log([]byte(key), nil, pb.LOG_DEL)
+	}
+	mutex.Unlock()
+
+	return len(copied), nil
+}
+
+// prefixKeys returns keys with the prefix and their values
+func prefixKeys(prefix []byte) map[string]string {
+
+	res := map[string]string{}
+
+	mutex.Lock()
+
+	db.ForEach(prefix, false, func(key, value []byte) bool {
+		res[string(key)] = string(value)
+		return true
+	})
+
+	mutex.Unlock()
+
+	return res
+}
+
+// prefixChanged reports whether keys with the prefix differ from copied
+func prefixChanged(prefix []byte, copied map[string]string) bool {
+
+	cur := prefixKeys(prefix)
+
+	if len(cur) != len(copied) {
+		return true
+	}
+
+	for key, value := range cur {
+		if old, ok := copied[key]; !ok || old != value {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,100 @@
+package engine
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/lj-team/go-generic/db/ldb"
+	"github.com/lj-team/lcluster/hash"
+	"github.com/lj-team/lcluster/pb"
+)
+
+func TestMigrationRedirect(t *testing.T) {
+	ldb.Open("test=1 default=1")
+
+	list := []byte(`{"hash": "rendezvous", "nodes": ["self", "other"]}`)
+
+	place, _ := hash.New(hash.RENDEZVOUS, []hash.Node{{Name: "self"}, {Name: "other"}}, 0)
+
+	// keys of the other node
+	var keys [][]byte
+	for c := byte('a'); len(keys) < 2; c++ {
+		if place.Get([]byte{c}) == 1 {
+			keys = append(keys, []byte{2, c, 's'})
+		}
+	}
+
+	ldb.Set(keys[0], []byte("value"))
+
+	migrate := func(state int64) {
+		res := handleMigrate(&pb.LCPROTO{Key: []byte("self"), Value: list, Ivalue: state})
+		if res.Err() != nil {
+			t.Fatal(res.Err())
+		}
+	}
+
+	get := func(key []byte) *pb.LCPROTO {
+		return route(&pb.LCPROTO{Code: pb.LCPROTO_C_GET, Key: key}, handleCGet)
+	}
+
+	migrate(pb.MIGRATE_ASK)
+
+	if res := get(keys[0]); res.Err() != nil || !bytes.Equal(res.Value, []byte("value")) {
+		t.Fatal("stored key must be served")
+	}
+
+	if res := get(keys[1]); res.ErrCode != pb.ERR_ASK || res.ErrMsg != "other" {
+		t.Fatal("ERR_ASK expected")
+	}
+
+	migrate(pb.MIGRATE_MOVED)
+
+	// the state is saved
+	migr = nil
+	loadMigration()
+
+	if res := get(keys[0]); res.ErrCode != pb.ERR_MOVED || len(res.Value) == 0 {
+		t.Fatal("ERR_MOVED with node list expected")
+	}
+
+	migrate(pb.MIGRATE_NONE)
+
+	if res := get(keys[1]); res.Err() != nil {
+		t.Fatal("all keys must be served without migration")
+	}
+}
+
+func TestFrozenPrefix(t *testing.T) {
+	ldb.Open("test=1 default=1")
+
+	ldb.Set([]byte{2, 'f', 'z'}, []byte("value"))
+
+	done := make(chan struct{})
+	frozen.prefix, frozen.done = string([]byte{2, 'f'}), done
+
+	res := make(chan *pb.LCPROTO)
+
+	go func() {
+		res <- route(&pb.LCPROTO{Code: pb.LCPROTO_C_GET, Key: []byte{2, 'f', 'z'}}, handleCGet)
+	}()
+
+	if r := route(&pb.LCPROTO{Code: pb.LCPROTO_C_GET, Key: []byte{2, 'g', 'z'}}, handleCGet); r.Err() != nil {
+		t.Fatal("other prefixes must be served")
+	}
+
+	select {
+	case <-res:
+		t.Fatal("request of the frozen prefix must wait")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	migrating.Lock()
+	frozen.prefix, frozen.done = "", nil
+	migrating.Unlock()
+	close(done)
+
+	if r := <-res; r.Err() != nil || !bytes.Equal(r.Value, []byte("value")) {
+		t.Fatal("request must be served after the prefix is moved")
+	}
+}
@@ -0,0 +1,151 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"hash/fnv"
+	"math/rand"
+
+	"github.com/lj-team/go-generic/log"
+	"github.com/lj-team/lcluster/connect"
+	"github.com/lj-team/lcluster/pb"
+)
+
+// REPAIR_QUEUE limits reads waiting to be checked on replicas, the
+// others are not checked
+const REPAIR_QUEUE = 1000
+
+// readRepairRate is the fraction of reads checked on replicas, 0 - read
+// repair is disabled
+var readRepairRate float64
+
+// repairCheck is the value digest of key read at seq of the log
+type repairCheck struct {
+	id     []byte
+	seq    int64
+	key    []byte
+	digest []byte
+}
+
+var repairs = make(chan *repairCheck, REPAIR_QUEUE)
+
+func digest(value []byte) []byte {
+	h := fnv.New64a()
+	h.Write(value)
+	return h.Sum(nil)
+}
+
+// readRepair queues the value read by the client to be compared with
+// replicas. Only digests are sent, the value is resent if a replica has
+// another one
+func readRepair(key, value []byte) {
+
+	if readRepairRate <= 0 || rand.Float64() >= readRepairRate || len(repl.List()) == 0 {
+		return
+	}
+
+	id, _, seq, _ := rlog.State()
+
+	select {
+	case repairs <- &repairCheck{id: id, seq: seq, key: key, digest: digest(value)}:
+	default:
+	}
+}
+
+// repairLoop checks queued reads on replicas
+func repairLoop() {
+	for c := range repairs {
+		for _, r := range repl.List() {
+			if r.check(c) {
+				repair(c.key)
+				break
+			}
+		}
+	}
+}
+
+// check returns true if the replica has another value of the key
+func (r *replica) check(c *repairCheck) bool {
+
+	ctx, cancel := context.WithTimeout(context.Background(), connect.DefaultTimeout)
+	defer cancel()
+
+	res, err := r.conn.CheckContext(ctx, c.id, c.seq, c.key, c.digest)
+	if err != nil {
+		log.Trace("read repair check on " + r.addr + ": " + err.Error())
+		return false
+	}
+
+	return res == 0
+}
+
+// repair logs the current value of the key again, so replicas apply it
+// after the changes they have not applied yet. The stamp and the slots of
+// the key are kept, so peers do not take it as a new change
+func repair(key []byte) {
+
+	mutex.Lock()
+
+	rec := &pb.LCPROTO{Key: key, Value: db.Get(key), Counter: pb.LOG_SET}
+
+	if len(rec.Value) == 0 {
+		rec.Counter = pb.LOG_DEL
+	}
+
+	if origin != "" {
+		s := loadStamp(key)
+		rec.Ts, rec.Origin = s.ts, s.origin
+		rec.List = slotList(loadSlots(key), s.known())
+	}
+
+	appendLog(rec)
+
+	mutex.Unlock()
+
+	log.Debug("read repair of key " + string(key))
+}
+
+// handleCheck compares the value digest of the primary with the replica
+// one, the result is unknown until the replica applies the seq the
+// value is read at
+func handleCheck(msg *pb.LCPROTO) *pb.LCPROTO {
+
+	if len(msg.List) == 0 {
+		return badArgs("log id expected")
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	loadApplied()
+
+	if !bytes.Equal(applied.id, msg.List[0]) || applied.seq < msg.Ivalue {
+		return &pb.LCPROTO{Ivalue: -1}
+	}
+
+	if bytes.Equal(digest(db.Get(msg.Key)), msg.Value) {
+		return &pb.LCPROTO{Ivalue: 1}
+	}
+
+	return &pb.LCPROTO{Ivalue: 0}
+}
+
+// handleRepair logs the current values of list keys again, so replicas
+// get the values of the primary
+func handleRepair(msg *pb.LCPROTO) *pb.LCPROTO {
+
+	if len(repl.List()) == 0 {
+		return pb.ErrorResponse(pb.ERR_UNAVAILABLE, "replication is disabled")
+	}
+
+	n := int64(0)
+
+	for _, key := range msg.List {
+		if len(key) > 0 && key[0] != 0 {
+			repair(key)
+			n++
+		}
+	}
+
+	return &pb.LCPROTO{Ivalue: n}
+}
@@ -0,0 +1,115 @@
+package engine
+
+import (
+	"testing"
+
+	"github.com/lj-team/go-generic/db/ldb"
+	"github.com/lj-team/go-generic/encode/pack"
+	"github.com/lj-team/lcluster/pb"
+)
+
+func TestLogMutations(t *testing.T) {
+	ldb.Open("test=1 default=1")
+
+	repl.Set([]string{"127.0.0.1:1"})
+	defer repl.Close()
+
+	key := []byte{2, 'm', 'a'}
+	counter := []byte{2, 'm', 'c'}
+
+	_, _, last, _ := rlog.State()
+
+	handleCSet(&pb.LCPROTO{Key: key, Value: []byte("v")})
+	handleCGet(&pb.LCPROTO{Key: key})
+	handleCGetInt(&pb.LCPROTO{Key: counter})
+	handleCInc(&pb.LCPROTO{Key: counter, Ivalue: 5})
+	handleCDec(&pb.LCPROTO{Key: counter, Ivalue: 7})
+	handleCHKill(&pb.LCPROTO{Key: []byte{2, 'm'}})
+
+	list, _ := rlog.Read(last+1, 10)
+
+	ops := []int32{pb.LOG_SET, pb.LOG_INCBY, pb.LOG_INCBY, pb.LOG_DELALL}
+	deltas := []int64{0, 5, -5, 0}
+
+	if len(list) != len(ops) {
+		t.Fatal("only mutations must be logged", len(list))
+	}
+
+	for i, rec := range list {
+		if rec.Counter != ops[i] {
+			t.Fatal("wrong operation", i, rec.Counter)
+		}
+
+		if rec.Counter == pb.LOG_INCBY && pack.Bytes2Int(rec.Value) != deltas[i] {
+			t.Fatal("wrong delta", i, pack.Bytes2Int(rec.Value))
+		}
+	}
+
+	// replica applies the operations, the change made during full copy
+	// may be applied twice
+	ldb.Set(counter, pack.Int2Bytes(5))
+
+	applyLog(list[1])
+
+	if pack.Bytes2Int(ldb.Get(counter)) != 5 {
+		t.Fatal("resulting value must be set")
+	}
+
+	// changes logged before the resulting value add the delta
+	applyLog(&pb.LCPROTO{Key: counter, Value: pack.Int2Bytes(10), Counter: pb.LOG_INCBY})
+
+	if pack.Bytes2Int(ldb.Get(counter)) != 15 {
+		t.Fatal("delta must be added")
+	}
+
+	ldb.Set(key, []byte("v"))
+
+	applyLog(list[3])
+
+	if ldb.Has(counter) || ldb.Has(key) {
+		t.Fatal("keys with prefix must be deleted")
+	}
+}
+
+func TestReadRepair(t *testing.T) {
+	ldb.Open("test=1 default=1")
+
+	mutex.Lock()
+	saveApplied([]byte("primary"), 5, 0)
+	mutex.Unlock()
+
+	defer saveApplied(nil, -1, 0)
+
+	key := []byte{2, 'r', 'r'}
+
+	ldb.Set(key, []byte("old"))
+
+	check := func(seq int64, value string) int64 {
+		return handleCheck(&pb.LCPROTO{
+			Key:    key,
+			Value:  digest([]byte(value)),
+			List:   [][]byte{[]byte("primary")},
+			Ivalue: seq,
+		}).Ivalue
+	}
+
+	if check(6, "old") != -1 {
+		t.Fatal("unknown result expected before seq is applied")
+	}
+
+	if check(5, "old") != 1 || check(4, "new") != 0 {
+		t.Fatal("digests must be compared")
+	}
+
+	repl.Set([]string{"127.0.0.1:1"})
+	defer repl.Close()
+
+	_, _, last, _ := rlog.State()
+
+	repair(key)
+
+	list, _ := rlog.Read(last+1, 10)
+	if len(list) != 1 || list[0].Counter != pb.LOG_SET || string(list[0].Value) != "old" {
+		t.Fatal("current value must be logged")
+	}
+}
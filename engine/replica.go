@@ -0,0 +1,726 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/lj-team/go-generic/encode/pack"
+	"github.com/lj-team/go-generic/log"
+	"github.com/lj-team/lcluster/connect"
+	"github.com/lj-team/lcluster/pb"
+)
+
+// REPL_BATCH is the number of changes sent before the replica position
+// is checked
+const REPL_BATCH = 1000
+
+// REPL_IDLE_CHECK is the interval of position checks without changes, so
+// broken connection to the replica is detected
+const REPL_IDLE_CHECK = time.Second * 10
+
+// PRIMARY_TIMEOUT is the least time the primary must be silent for the
+// replica to accept failover, the primary checks the position of the
+// replica at least every REPL_IDLE_CHECK
+const PRIMARY_TIMEOUT = REPL_IDLE_CHECK * 2
+
+// DefaultSyncTimeout limits waiting for replicas to confirm a write
+const DefaultSyncTimeout = time.Second
+
+// states of replication to the replica
+const (
+	REPL_CONNECTING = "connecting"
+	REPL_COPYING    = "copying"
+	REPL_STREAMING  = "streaming"
+)
+
+var (
+	errTruncated = errors.New("changes are deleted from the log")
+	errStopped   = errors.New("replication stopped")
+)
+
+// replica receives changes of the node from the log in its own
+// goroutine, so a slow replica does not stall others and handlers
+type replica struct {
+	set   *replicaSet
+	addr  string
+	conn  *connect.Conn
+	done  chan struct{}
+	sent  int64 // last sent seq
+	acked int64 // last seq applied by the replica, -1 if unknown
+	ackAt int64 // unix time of the last position check
+	err   string
+	state string
+	mt    sync.Mutex // err and state
+}
+
+// replicaSet is the list of replicas of the node, it is replaced by
+// PROMOTE
+type replicaSet struct {
+	list  []*replica
+	acked chan struct{} // closed when a replica confirms changes
+	peer  bool          // nodes of other datacenters, see xdc.go
+	mt    sync.RWMutex
+}
+
+var repl = &replicaSet{}
+
+// selfAddr is the address of the node, its replicas send clients to it
+var selfAddr string
+
+// replicaAddrs are the replicas of the node while it is primary, they are
+// replaced by PROMOTE. Guarded by mutex
+var replicaAddrs []string
+
+// primarySeen is unix time in nanoseconds of the last change or position
+// check of the primary
+var primarySeen int64
+
+// synchronous replication defaults for C_* writes with sync flag
+var (
+	syncReplicas int
+	syncTimeout  = DefaultSyncTimeout
+)
+
+// Log saves the change for replicas and returns its seq, nothing is
+// saved if replication is disabled and 0 is returned. It is called with
+// mutex locked, so changes are logged in the order they are made
+func (s *replicaSet) Log(key, value []byte, op int32) int64 {
+	return s.log(&pb.LCPROTO{Key: key, Value: value, Counter: op})
+}
+
+// log stamps the change if origin is set and saves it
+func (s *replicaSet) log(rec *pb.LCPROTO) int64 {
+
+	if origin != "" {
+		stampChange(rec)
+	}
+
+	return appendLog(rec)
+}
+
+// appendLog saves the change if there are replicas or peers, seq of the
+// change is returned, 0 if it is not saved. Without them the log is
+// dropped, so a replica or peer added later makes full copy
+func appendLog(rec *pb.LCPROTO) int64 {
+	if len(repl.List()) > 0 || len(dcPeers.List()) > 0 {
+		return rlog.Append(rec)
+	}
+	rlog.Skip()
+	return 0
+}
+
+// logIncBy saves the change of the counter from old to cur. Replicas set
+// the resulting value, so the change applied again after full copy is
+// counted once, peers merge the slot of the node
+func logIncBy(key []byte, old, cur int64) int64 {
+	return repl.log(&pb.LCPROTO{
+		Key:     key,
+		Value:   pack.Int2Bytes(cur - old),
+		List:    [][]byte{pack.Int2Bytes(cur)},
+		Counter: pb.LOG_INCBY,
+	})
+}
+
+// startReplicas replicates to the replicas while the node is primary
+func startReplicas() {
+
+	var addrs []string
+
+	if currentRole() == ROLE_PRIMARY {
+		mutex.Lock()
+		addrs = replicaAddrs
+		mutex.Unlock()
+	}
+
+	repl.Set(addrs)
+}
+
+// Set replaces the replica addresses, replication to the kept ones
+// continues. Empty list stops replication
+func (s *replicaSet) Set(addrs []string) {
+
+	s.mt.Lock()
+	defer s.mt.Unlock()
+
+	running := make(map[string]*replica, len(s.list))
+	for _, r := range s.list {
+		running[r.addr] = r
+	}
+
+	var list []*replica
+
+	seen := make(map[string]bool, len(addrs))
+
+	for _, addr := range addrs {
+		if addr == "" || seen[addr] {
+			continue
+		}
+
+		seen[addr] = true
+
+		r := running[addr]
+
+		if r == nil {
+			r = newReplica(s, addr)
+		}
+
+		delete(running, addr)
+		list = append(list, r)
+	}
+
+	for _, r := range running {
+		r.stop()
+	}
+
+	s.list = list
+}
+
+// List returns running replicas
+func (s *replicaSet) List() []*replica {
+	s.mt.RLock()
+	defer s.mt.RUnlock()
+
+	return s.list
+}
+
+func (s *replicaSet) Close() {
+	s.Set(nil)
+}
+
+// notify wakes up requests waiting for confirmations
+func (s *replicaSet) notify() {
+	s.mt.Lock()
+	if s.acked != nil {
+		close(s.acked)
+		s.acked = nil
+	}
+	s.mt.Unlock()
+}
+
+// Wait waits until k replicas apply seq or timeout expires, the number
+// of replicas applied it is returned
+func (s *replicaSet) Wait(seq int64, k int, timeout time.Duration) int {
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for {
+		s.mt.Lock()
+
+		if s.acked == nil {
+			s.acked = make(chan struct{})
+		}
+
+		wait := s.acked
+
+		n := 0
+		for _, r := range s.list {
+			if atomic.LoadInt64(&r.acked) >= seq {
+				n++
+			}
+		}
+
+		ready := n >= k || len(s.list) < k
+
+		s.mt.Unlock()
+
+		if ready {
+			return n
+		}
+
+		select {
+		case <-wait:
+		case <-timer.C:
+			return n
+		}
+	}
+}
+
+// confirm waits for replicas to apply C_* write with sync flag up to its
+// seq in the response, the number of confirmations is returned in acks.
+// The write stays asynchronous if they are not received in time
+func confirm(msg, res *pb.LCPROTO) {
+
+	k := confirmAcks(msg, res)
+	if k <= 0 {
+		return
+	}
+
+	n := repl.Wait(res.Seq, k, syncTimeout)
+
+	res.Acks = int32(n)
+
+	if n < k {
+		res.Async = true
+		log.Debug(fmt.Sprintf("%s confirmed by %d of %d replicas", msg.Code.String(), n, k))
+	}
+}
+
+// confirmAcks returns the number of replicas to confirm the write, zero
+// if it is not waited for
+func confirmAcks(msg, res *pb.LCPROTO) int {
+
+	if res == nil || res.ErrCode != 0 || !msg.Sync || !msg.Code.Mutating() {
+		return 0
+	}
+
+	if msg.Acks != 0 {
+		return int(msg.Acks)
+	}
+
+	return syncReplicas
+}
+
+func newReplica(s *replicaSet, addr string) *replica {
+
+	r := &replica{
+		set:   s,
+		addr:  addr,
+		conn:  connect.NewConnWithOptions(addr, peerOpts),
+		done:  make(chan struct{}),
+		acked: -1,
+		state: REPL_CONNECTING,
+	}
+
+	go r.run()
+
+	return r
+}
+
+func (r *replica) stop() {
+	close(r.done)
+	r.conn.Close()
+}
+
+// Lag returns the number of changes not applied by the replica, -1 if
+// its position is unknown
+func (r *replica) Lag() int64 {
+
+	acked := atomic.LoadInt64(&r.acked)
+
+	if acked < 0 {
+		return -1
+	}
+
+	_, _, last, _ := rlog.State()
+
+	return last - acked
+}
+
+// Err returns the last replication error, empty while streaming
+func (r *replica) Err() string {
+	r.mt.Lock()
+	defer r.mt.Unlock()
+
+	return r.err
+}
+
+func (r *replica) setErr(err string) {
+	r.mt.Lock()
+	r.err = err
+	r.mt.Unlock()
+}
+
+func (r *replica) setState(state string) {
+	r.mt.Lock()
+	r.state = state
+	r.mt.Unlock()
+}
+
+// Info returns the state of replication to the replica
+func (r *replica) Info() connect.ReplicaInfo {
+
+	r.mt.Lock()
+	info := connect.ReplicaInfo{
+		Addr:  r.addr,
+		State: r.state,
+		Error: r.err,
+	}
+	r.mt.Unlock()
+
+	info.Sent = atomic.LoadInt64(&r.sent)
+	info.Acked = atomic.LoadInt64(&r.acked)
+	info.LastAck = atomic.LoadInt64(&r.ackAt)
+	info.Pending = r.Lag()
+
+	switch {
+	case info.Pending < 0:
+		info.PendingBytes = -1
+	case info.Pending > 0:
+		info.PendingBytes = rlog.Size(info.Acked)
+	}
+
+	return info
+}
+
+// run sends the log to the replica until it is stopped, errors are
+// retried every second
+func (r *replica) run() {
+	for {
+		err := r.follow()
+		if err == errStopped {
+			return
+		}
+
+		name := "replica " + r.addr
+		if r.set.peer {
+			name = "peer " + r.addr
+		}
+
+		// repeated errors are not logged while the replica is down
+		if err.Error() == r.Err() {
+			log.Trace(name + ": " + err.Error())
+		} else {
+			log.Warn(name + ": " + err.Error())
+		}
+
+		r.setErr(err.Error())
+		r.setState(REPL_CONNECTING)
+
+		select {
+		case <-r.done:
+			return
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// position asks the replica for the applied seq of log id, the peer
+// returns the seq applied from the node origin
+func (r *replica) position(id []byte) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), connect.DefaultTimeout)
+	defer cancel()
+
+	var pos int64
+	var err error
+
+	if r.set.peer {
+		pos, err = r.conn.PeerPosContext(ctx, origin, id)
+	} else {
+		pos, err = r.conn.ReplPosContext(ctx, id)
+	}
+
+	if err != nil {
+		return 0, err
+	}
+
+	atomic.StoreInt64(&r.ackAt, time.Now().Unix())
+
+	if atomic.SwapInt64(&r.acked, pos) != pos {
+		r.set.notify()
+	}
+
+	return pos, nil
+}
+
+func (r *replica) stopped() bool {
+	select {
+	case <-r.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// follow sends changes after the replica position, full copy is made if
+// the position is unknown or deleted from the log. The replica is
+// switched to read only role, so the old primary does not accept writes
+// after failover and sends clients to the node. Peers keep their role
+// and get only changes of the node origin
+func (r *replica) follow() error {
+
+	if currentRole() != ROLE_PRIMARY {
+		return errStopped
+	}
+
+	id, first, last, _ := rlog.State()
+
+	if !r.set.peer {
+		if err := r.replicaOf(); err != nil {
+			return err
+		}
+	}
+
+	pos, err := r.position(id)
+	if err != nil {
+		return err
+	}
+
+	if pos < first-1 || pos > last {
+		r.setState(REPL_COPYING)
+
+		if r.set.peer {
+			pos, err = r.copyToPeer(id)
+		} else {
+			pos, err = r.resync(id)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	r.setState(REPL_STREAMING)
+	r.setErr("")
+
+	for next := pos + 1; ; {
+		_, _, _, wait := rlog.State()
+
+		list, ok := rlog.Read(next, REPL_BATCH)
+		if !ok {
+			return errTruncated
+		}
+
+		if len(list) == 0 {
+			idle := time.NewTimer(REPL_IDLE_CHECK)
+
+			select {
+			case <-r.done:
+				idle.Stop()
+				return errStopped
+			case <-wait:
+				idle.Stop()
+			case <-idle.C:
+				if pos, err = r.position(id); err != nil {
+					return err
+				}
+
+				if pos != next-1 {
+					return fmt.Errorf("replica is at %d, sent %d", pos, next-1)
+				}
+			}
+			continue
+		}
+
+		next += int64(len(list))
+
+		if r.set.peer {
+			list = peerBatch(list)
+		}
+
+		for _, rec := range list {
+			if !r.conn.Post(rec) {
+				return connect.ErrNotConnected
+			}
+		}
+
+		atomic.StoreInt64(&r.sent, next-1)
+
+		// the replica skips changes after lost ones
+		if pos, err = r.position(id); err != nil {
+			return err
+		}
+
+		if pos != next-1 {
+			return fmt.Errorf("replica is at %d, sent %d", pos, next-1)
+		}
+
+		r.setErr("")
+
+		if r.stopped() {
+			return errStopped
+		}
+	}
+}
+
+// resync streams full copy of the node to the replica by parts and
+// returns the seq the log is applied after. Keys are read while the node
+// is changed, so the replica rejects client requests until it applies
+// the changes made during the copy
+func (r *replica) resync(id []byte) (int64, error) {
+
+	_, _, seq, _ := rlog.State()
+
+	log.Info("full copy to replica " + r.addr + ", log " + string(id) + fmt.Sprintf(" at %d", seq))
+
+	call := func(f func(ctx context.Context) error) error {
+		ctx, cancel := context.WithTimeout(context.Background(), connect.DefaultTimeout)
+		defer cancel()
+		return f(ctx)
+	}
+
+	for more := true; more; {
+		err := call(func(ctx context.Context) (e error) {
+			more, e = r.conn.ResyncContext(ctx, selfAddr, id, 0)
+			return
+		})
+
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	err := r.sendParts(id, func(cursor []byte) ([][]byte, int64) {
+		res := handleScan(&pb.LCPROTO{Key: cursor})
+		return res.List, res.Ivalue
+	})
+
+	// stamps and slots are needed to merge changes of peers after failover
+	if err == nil && origin != "" {
+		err = r.sendParts(id, scanState)
+	}
+
+	if err != nil {
+		return 0, err
+	}
+
+	err = call(func(ctx context.Context) error {
+		return r.conn.SyncContext(ctx, id, seq+1)
+	})
+
+	if err != nil {
+		return 0, err
+	}
+
+	// changes made during the copy
+	_, _, last, _ := rlog.State()
+
+	err = call(func(ctx context.Context) (e error) {
+		_, e = r.conn.ResyncContext(ctx, selfAddr, id, last+1)
+		return
+	})
+
+	if err != nil {
+		return 0, err
+	}
+
+	return seq, nil
+}
+
+// sendParts sends keys and values returned by scan to the replica by
+// parts, scan returns 1 if there are more keys after the cursor
+func (r *replica) sendParts(id []byte, scan func(cursor []byte) ([][]byte, int64)) error {
+
+	var cursor []byte
+
+	for {
+		list, more := scan(cursor)
+
+		part := &pb.LCPROTO{
+			Code: pb.LCPROTO_SYNC,
+			Key:  id,
+			List: list,
+		}
+
+		if !r.conn.Post(part) {
+			return connect.ErrNotConnected
+		}
+
+		if more == 0 {
+			return nil
+		}
+
+		cursor = list[len(list)-2]
+
+		if r.stopped() {
+			return errStopped
+		}
+
+		// wait for the replica to save the part
+		if _, err := r.position(id); err != nil {
+			return err
+		}
+	}
+}
+
+// replicaOf switches the replica to read only role. If the replica has
+// newer primary, the node is replaced by failover and becomes its replica
+func (r *replica) replicaOf() error {
+
+	mutex.Lock()
+	since := promoted
+	mutex.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), connect.DefaultTimeout)
+	primary, err := r.conn.ReplicaOfContext(ctx, selfAddr, topologyEpoch(), since)
+	cancel()
+
+	if e, ok := err.(*pb.Error); ok && e.Code == pb.ERR_REJECTED && primary != "" && primary != selfAddr {
+		log.Warn("replica " + r.addr + " rejects the node: " + e.Message + ", switch to replica of " + primary)
+		setRole(ROLE_REPLICA)
+		setPrimary(primary)
+		return errStopped
+	}
+
+	return err
+}
+
+// handlePromote makes the replica primary, its changes are sent to the
+// old primary and other replicas listed in value from now. Failover of
+// the proxy is accepted if the replica does not hear the primary too and
+// the topology of the failover is newer, so proxies with different views
+// of the primary do not make two primaries
+func handlePromote(msg *pb.LCPROTO) *pb.LCPROTO {
+
+	if msg.Ivalue > 0 {
+		silent := time.Duration(msg.Ivalue) * time.Millisecond
+		if silent < PRIMARY_TIMEOUT {
+			silent = PRIMARY_TIMEOUT
+		}
+
+		if seen := atomic.LoadInt64(&primarySeen); seen > 0 && time.Since(time.Unix(0, seen)) < silent {
+			return rejected("primary is alive")
+		}
+	}
+
+	if len(msg.Key) > 0 {
+		var t connect.Topology
+
+		if err := json.Unmarshal(msg.Key, &t); err != nil {
+			return badArgs(err.Error())
+		}
+
+		if err := t.Check(); err != nil {
+			return badArgs(err.Error())
+		}
+
+		if !claimTopology(&t) {
+			return rejected("topology is changed")
+		}
+	}
+
+	var addrs []string
+
+	if len(msg.Value) > 0 {
+		addrs = strings.Split(string(msg.Value), ",")
+	}
+
+	mutex.Lock()
+	loadApplied()
+	if atomic.LoadInt32(&syncing) == 1 {
+		log.Warn("promoted before full copy of the primary is consistent")
+		saveApplied(nil, -1, 0)
+	}
+	mutex.Unlock()
+
+	mutex.Lock()
+	replicaAddrs = addrs
+	mutex.Unlock()
+
+	setRole(ROLE_PRIMARY)
+
+	if len(addrs) == 0 {
+		log.Info("promoted to primary without replica")
+	} else {
+		log.Info("promoted to primary, replicas " + string(msg.Value))
+	}
+
+	return &pb.LCPROTO{Ivalue: topologyEpoch()}
+}
+
+// rejected returns ERR_REJECTED with the epoch of the node, the proxy
+// gets newer topology if it is behind
+func rejected(reason string) *pb.LCPROTO {
+	log.Warn("failover is rejected: " + reason)
+
+	res := pb.ErrorResponse(pb.ERR_REJECTED, reason)
+	res.Ivalue = topologyEpoch()
+
+	return res
+}
@@ -0,0 +1,104 @@
+package engine
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/lj-team/go-generic/db/ldb"
+	"github.com/lj-team/lcluster/pb"
+)
+
+func TestReplicaSet(t *testing.T) {
+	s := &replicaSet{}
+	defer s.Close()
+
+	s.Set([]string{"127.0.0.1:1", "", "127.0.0.1:2", "127.0.0.1:1"})
+
+	list := s.List()
+	if len(list) != 2 || list[0].addr != "127.0.0.1:1" || list[1].addr != "127.0.0.1:2" {
+		t.Fatal("two replicas expected")
+	}
+
+	if list[0].Lag() != -1 {
+		t.Fatal("unknown lag expected")
+	}
+
+	s.Set([]string{"127.0.0.1:2", "127.0.0.1:3"})
+
+	if next := s.List(); len(next) != 2 || next[0] != list[1] {
+		t.Fatal("running replica must be kept")
+	}
+
+	if !list[0].stopped() {
+		t.Fatal("removed replica must be stopped")
+	}
+}
+
+func TestReplicaWait(t *testing.T) {
+	s := &replicaSet{}
+
+	a := &replica{set: s, acked: 5}
+	b := &replica{set: s, acked: -1}
+
+	s.list = []*replica{a, b}
+
+	if n := s.Wait(5, 1, time.Millisecond); n != 1 {
+		t.Fatal("one replica applied 5")
+	}
+
+	go func() {
+		time.Sleep(time.Millisecond * 10)
+		atomic.StoreInt64(&b.acked, 6)
+		s.notify()
+	}()
+
+	if n := s.Wait(6, 1, time.Second); n != 1 {
+		t.Fatal("confirmation of 6 expected")
+	}
+
+	if n := s.Wait(7, 1, time.Millisecond*10); n != 0 {
+		t.Fatal("timeout expected")
+	}
+
+	// not enough replicas to wait for
+	if n := s.Wait(5, 3, time.Hour); n != 2 {
+		t.Fatal("two replicas applied 5")
+	}
+}
+
+func TestConfirmSeq(t *testing.T) {
+	ldb.Open("test=1 default=1")
+
+	r := &replica{set: repl, acked: -1}
+
+	repl.mt.Lock()
+	repl.list = []*replica{r}
+	repl.mt.Unlock()
+
+	defer func() {
+		repl.mt.Lock()
+		repl.list = nil
+		repl.mt.Unlock()
+	}()
+
+	msg := &pb.LCPROTO{Code: pb.LCPROTO_C_SET, Key: []byte{2, 'c'}, Value: []byte("v"), Sync: true, Acks: 1}
+
+	res := handleCSet(msg)
+	if res.Seq == 0 {
+		t.Fatal("seq of the write expected")
+	}
+
+	// write of other client
+	mutex.Lock()
+	repl.Log([]byte{2, 'd'}, []byte("v"), pb.LOG_SET)
+	mutex.Unlock()
+
+	atomic.StoreInt64(&r.acked, res.Seq)
+
+	confirm(msg, res)
+
+	if res.Acks != 1 || res.Async {
+		t.Fatal("the write must be confirmed up to its seq")
+	}
+}
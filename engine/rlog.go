@@ -0,0 +1,227 @@
+package engine
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"sync"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/lj-team/lcluster/pb"
+)
+
+// DefaultLogSize is the number of changes kept for replicas
+const DefaultLogSize = 1000000
+
+// LOG_SIZE_SCAN is the number of changes read to get the size of the
+// log tail, the size of the rest is estimated by them
+const LOG_SIZE_SCAN = 10000
+
+var (
+	logPrefix   = []byte("\x00log:")
+	logIdKey    = []byte("\x00seq:id")
+	logFirstKey = []byte("\x00seq:first")
+	logLastKey  = []byte("\x00seq:last")
+)
+
+// changeLog keeps numbered changes of the node in the database, the
+// oldest ones are deleted when the log exceeds its size. Replicas
+// resume from the last applied seq or make full copy if it is deleted
+type changeLog struct {
+	id       []byte
+	first    int64 // first kept seq, greater than last if the log is empty
+	last     int64 // last published seq
+	appended int64 // last seq, published after the batch is saved
+	skipped  bool  // changes are not logged after appended
+	size     int64
+	wait     chan struct{} // closed by publish
+	mt       sync.Mutex
+}
+
+var rlog = &changeLog{size: DefaultLogSize}
+
+func seqBytes(seq int64) []byte {
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, uint64(seq))
+	return buf
+}
+
+func bytesSeq(buf []byte) int64 {
+	if len(buf) < 8 {
+		return 0
+	}
+	return int64(binary.BigEndian.Uint64(buf))
+}
+
+func logKey(seq int64) []byte {
+	return append(append([]byte{}, logPrefix...), seqBytes(seq)...)
+}
+
+// load reads the log state, the id is made for a new log. Must be
+// called with mt locked
+func (l *changeLog) load() {
+
+	if l.id != nil {
+		return
+	}
+
+	l.id = db.Get(logIdKey)
+
+	if len(l.id) == 0 {
+		buf := make([]byte, 8)
+		rand.Read(buf)
+		l.id = []byte(hex.EncodeToString(buf))
+		db.Set(logIdKey, l.id)
+	}
+
+	l.last = bytesSeq(db.Get(logLastKey))
+	l.appended = l.last
+	l.first = bytesSeq(db.Get(logFirstKey))
+
+	if l.first == 0 {
+		l.first = 1
+	}
+
+	l.wait = make(chan struct{})
+}
+
+// Append saves the change of LOG_* operation in counter and returns its
+// seq. Must be called with mutex locked, the change is published when it
+// is unlocked
+func (l *changeLog) Append(rec *pb.LCPROTO) int64 {
+
+	l.mt.Lock()
+	defer l.mt.Unlock()
+
+	l.load()
+
+	l.appended++
+	l.skipped = false
+
+	rec.Code = pb.LCPROTO_LOG
+	rec.Ivalue = l.appended
+	rec.Peer = false
+
+	data, _ := proto.Marshal(rec)
+
+	db.Set(logKey(l.appended), data)
+	db.Set(logLastKey, seqBytes(l.appended))
+
+	if l.size > 0 && l.appended-l.first >= l.size {
+		for l.appended-l.first >= l.size {
+			db.Del(logKey(l.first))
+			l.first++
+		}
+		db.Set(logFirstKey, seqBytes(l.first))
+	}
+
+	return l.appended
+}
+
+// Skip drops the log before the change that is not logged, so replicas
+// at any seq of the log make full copy. Must be called with mutex locked
+func (l *changeLog) Skip() {
+
+	l.mt.Lock()
+	defer l.mt.Unlock()
+
+	l.load()
+
+	if l.skipped {
+		return
+	}
+
+	for seq := l.first; seq <= l.appended; seq++ {
+		db.Del(logKey(seq))
+	}
+
+	l.appended++
+	l.first = l.appended + 1
+	l.skipped = true
+
+	db.Set(logLastKey, seqBytes(l.appended))
+	db.Set(logFirstKey, seqBytes(l.first))
+}
+
+// publish makes appended changes visible to readers and wakes them up
+func (l *changeLog) publish() {
+
+	l.mt.Lock()
+	defer l.mt.Unlock()
+
+	if l.id == nil || l.appended == l.last {
+		return
+	}
+
+	l.last = l.appended
+
+	close(l.wait)
+	l.wait = make(chan struct{})
+}
+
+// State returns id of the log, its first kept and last seq and channel
+// closed on the next change
+func (l *changeLog) State() (id []byte, first, last int64, wait <-chan struct{}) {
+	l.mt.Lock()
+	defer l.mt.Unlock()
+
+	l.load()
+
+	return l.id, l.first, l.last, l.wait
+}
+
+// Read returns up to limit changes starting from seq, false if the
+// changes are deleted from the log
+func (l *changeLog) Read(seq int64, limit int) ([]*pb.LCPROTO, bool) {
+
+	_, first, last, _ := l.State()
+
+	if seq < first {
+		return nil, false
+	}
+
+	var list []*pb.LCPROTO
+
+	for ; seq <= last && len(list) < limit; seq++ {
+		data := db.Get(logKey(seq))
+
+		rec := &pb.LCPROTO{}
+
+		// deleted after State
+		if len(data) == 0 || proto.Unmarshal(data, rec) != nil {
+			return list, len(list) > 0
+		}
+
+		list = append(list, rec)
+	}
+
+	return list, true
+}
+
+// Size returns the size of kept changes after seq
+func (l *changeLog) Size(seq int64) int64 {
+
+	_, first, last, _ := l.State()
+
+	if seq < first-1 {
+		seq = first - 1
+	}
+
+	n := last - seq
+	if n <= 0 {
+		return 0
+	}
+
+	scan := n
+	if scan > LOG_SIZE_SCAN {
+		scan = LOG_SIZE_SCAN
+	}
+
+	size := int64(0)
+
+	for i := seq + 1; i <= seq+scan; i++ {
+		size += int64(len(db.Get(logKey(i))))
+	}
+
+	return size * n / scan
+}
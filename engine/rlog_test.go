@@ -0,0 +1,67 @@
+package engine
+
+import (
+	"testing"
+
+	"github.com/lj-team/go-generic/db/ldb"
+	"github.com/lj-team/lcluster/pb"
+)
+
+func TestChangeLog(t *testing.T) {
+	ldb.Open("test=1 default=1")
+
+	l := &changeLog{size: 3}
+
+	for i := 0; i < 5; i++ {
+		if seq := l.Append(&pb.LCPROTO{Key: []byte{2, 'k', byte('a' + i)}, Value: []byte("v"), Counter: pb.LOG_SET}); seq != int64(i+1) {
+			t.Fatal("wrong seq", seq)
+		}
+	}
+
+	if _, _, last, _ := l.State(); last != 0 {
+		t.Fatal("changes must be published after they are saved")
+	}
+
+	l.publish()
+
+	if _, ok := l.Read(2, 10); ok {
+		t.Fatal("deleted changes must not be read")
+	}
+
+	list, ok := l.Read(3, 10)
+	if !ok || len(list) != 3 || list[0].Ivalue != 3 || list[0].Key[2] != 'c' {
+		t.Fatal("changes 3-5 expected")
+	}
+
+	// the state is saved
+	l = &changeLog{size: 3}
+
+	if _, first, last, _ := l.State(); first != 3 || last != 5 {
+		t.Fatal("wrong log state", first, last)
+	}
+	size := int64(len(ldb.Get(logKey(5))))
+
+	if l.Size(4) != size || l.Size(0) != size*3 || l.Size(5) != 0 {
+		t.Fatal("wrong size of changes")
+	}
+}
+
+func TestChangeLogSkip(t *testing.T) {
+	ldb.Open("test=1 default=1")
+
+	l := &changeLog{size: 10}
+
+	l.Append(&pb.LCPROTO{Key: []byte{2, 'k'}, Value: []byte("v"), Counter: pb.LOG_SET})
+	l.Skip()
+	l.Skip()
+	l.publish()
+
+	// the replica at seq 1 makes full copy
+	if _, first, last, _ := l.State(); first != 3 || last != 2 {
+		t.Fatal("log must be dropped", first, last)
+	}
+
+	if seq := l.Append(&pb.LCPROTO{Key: []byte{2, 'k'}, Counter: pb.LOG_DEL}); seq != 3 {
+		t.Fatal("wrong seq", seq)
+	}
+}
@@ -0,0 +1,205 @@
+package engine
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/lj-team/go-generic/log"
+	"github.com/lj-team/lcluster/pb"
+)
+
+// roles of the node, replica rejects client writes
+const (
+	ROLE_PRIMARY = "primary"
+	ROLE_REPLICA = "replica"
+)
+
+var (
+	roleKey     = []byte("\x00role")
+	primaryKey  = []byte("\x00primary")
+	promotedKey = []byte("\x00promoted")
+)
+
+// readonly is 1 if the node is replica
+var readonly int32
+
+// primaryAddr is the address of the primary of the replica, empty if it
+// is unknown. Guarded by mutex
+var primaryAddr string
+
+// promoted is unix time in nanoseconds the node is switched to primary at
+// runtime, 0 if the role is of the config. Guarded by mutex
+var promoted int64
+
+func validRole(role string) bool {
+	return role == ROLE_PRIMARY || role == ROLE_REPLICA
+}
+
+func currentRole() string {
+	if atomic.LoadInt32(&readonly) == 1 {
+		return ROLE_REPLICA
+	}
+	return ROLE_PRIMARY
+}
+
+// setRole switches the role, it is saved to survive restart. Only
+// primary replicates its changes
+func setRole(role string) {
+
+	var v int32
+	if role == ROLE_REPLICA {
+		v = 1
+	}
+
+	switched := atomic.SwapInt32(&readonly, v) != v
+
+	mutex.Lock()
+	db.Set(roleKey, []byte(role))
+	if role == ROLE_PRIMARY {
+		primaryAddr = ""
+		db.Del(primaryKey)
+
+		if switched {
+			promoted = time.Now().UnixNano()
+			db.Set(promotedKey, seqBytes(promoted))
+		}
+	}
+	mutex.Unlock()
+
+	if switched {
+		log.Info("role is switched to " + role)
+	}
+
+	startReplicas()
+	startPeers()
+}
+
+// setPrimary saves the address of the primary the replica follows
+func setPrimary(addr string) {
+	mutex.Lock()
+	if addr != primaryAddr {
+		primaryAddr = addr
+		db.Set(primaryKey, []byte(addr))
+	}
+	mutex.Unlock()
+}
+
+// loadRole restores the role switched at runtime, role of the config is
+// used if there is no one
+func loadRole(role string) {
+
+	mutex.Lock()
+	saved := string(db.Get(roleKey))
+	primaryAddr = string(db.Get(primaryKey))
+	promoted = bytesSeq(db.Get(promotedKey))
+	mutex.Unlock()
+
+	if validRole(saved) {
+		if role != "" && saved != role {
+			log.Warn("role " + saved + " switched at runtime is used instead of " + role)
+		}
+		role = saved
+	}
+
+	if role == ROLE_REPLICA {
+		atomic.StoreInt32(&readonly, 1)
+	} else {
+		atomic.StoreInt32(&readonly, 0)
+	}
+}
+
+// readOnly rejects client writes on replica, the primary address is
+// returned, so proxies follow failover. Writes without response are
+// passed to the primary
+func readOnly(msg *pb.LCPROTO) (*pb.LCPROTO, bool) {
+
+	if atomic.LoadInt32(&readonly) == 0 || !msg.Code.Mutating() {
+		return nil, false
+	}
+
+	mutex.Lock()
+	addr := primaryAddr
+	mutex.Unlock()
+
+	if noReply(msg) {
+		if addr != "" {
+			peer(addr).Post(msg)
+		} else {
+			log.Debug(msg.Code.String() + " is rejected by replica")
+		}
+		return nil, true
+	}
+
+	res := pb.ErrorResponse(pb.ERR_READONLY, "node is replica")
+	res.Value = []byte(addr)
+
+	return res, true
+}
+
+// handleRole switches the role to value if it is set, key of the replica
+// is the address of its primary. The role of the node is returned
+func handleRole(msg *pb.LCPROTO) *pb.LCPROTO {
+
+	role := string(msg.Value)
+
+	if role != "" {
+		if !validRole(role) {
+			return badArgs("unknown role " + role)
+		}
+
+		if role == ROLE_REPLICA && len(msg.Key) > 0 {
+			if res := checkPrimary(string(msg.Key), msg.Ivalue, int64(msg.Ts)); res != nil {
+				return res
+			}
+		}
+
+		setRole(role)
+
+		if role == ROLE_REPLICA && len(msg.Key) > 0 {
+			setPrimary(string(msg.Key))
+		}
+	}
+
+	return &pb.LCPROTO{Value: []byte(currentRole())}
+}
+
+// checkPrimary rejects primary addr with topology epoch, promoted at the
+// time, if it is replaced by failover: the node has newer topology, is
+// promoted later or hears other primary. The rejected primary becomes
+// replica of the address in the response, so the old primary restarted
+// after failover does not demote the new one
+func checkPrimary(addr string, epoch, since int64) *pb.LCPROTO {
+
+	mutex.Lock()
+	primary, from := primaryAddr, promoted
+	mutex.Unlock()
+
+	if currentRole() == ROLE_PRIMARY {
+		primary = selfAddr
+	}
+
+	reason := ""
+
+	switch seen := atomic.LoadInt64(&primarySeen); {
+	case topologyEpoch() > epoch:
+		reason = "topology is changed"
+
+	case currentRole() == ROLE_PRIMARY && from > since:
+		reason = "node is promoted later"
+
+	case currentRole() == ROLE_REPLICA && primary != "" && primary != addr &&
+		seen > 0 && time.Since(time.Unix(0, seen)) < PRIMARY_TIMEOUT:
+		reason = "node follows " + primary
+	}
+
+	if reason == "" {
+		return nil
+	}
+
+	log.Warn("replication of " + addr + " is rejected: " + reason)
+
+	res := pb.ErrorResponse(pb.ERR_REJECTED, reason)
+	res.Value = []byte(primary)
+
+	return res
+}
@@ -0,0 +1,106 @@
+package engine
+
+import (
+	"encoding/json"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/lj-team/go-generic/db/ldb"
+	"github.com/lj-team/lcluster/connect"
+	"github.com/lj-team/lcluster/pb"
+)
+
+func TestReplicaRole(t *testing.T) {
+	ldb.Open("test=1 default=1")
+
+	defer setRole(ROLE_PRIMARY)
+
+	key := []byte{2, 'r', 'o'}
+
+	set := func() *pb.LCPROTO {
+		return route(&pb.LCPROTO{Code: pb.LCPROTO_C_SET, Key: key, Value: []byte("1"), Sync: true}, handleCSet)
+	}
+
+	if res := handleRole(&pb.LCPROTO{Value: []byte("master")}); res.ErrCode != pb.ERR_BAD_ARGS {
+		t.Fatal("unknown role must be rejected")
+	}
+
+	if res := handleRole(&pb.LCPROTO{Key: []byte("primary:1"), Value: []byte(ROLE_REPLICA), Ts: uint64(time.Now().UnixNano())}); string(res.Value) != ROLE_REPLICA {
+		t.Fatal("replica role expected")
+	}
+
+	if res := set(); res.ErrCode != pb.ERR_READONLY || string(res.Value) != "primary:1" {
+		t.Fatal("write must be rejected by replica with the primary address")
+	}
+
+	handleLog(&pb.LCPROTO{Key: key, Value: []byte("2"), Counter: 1})
+
+	if res := route(&pb.LCPROTO{Code: pb.LCPROTO_C_GET, Key: key}, handleCGet); res.Err() != nil || string(res.Value) != "2" {
+		t.Fatal("replica must apply changes and serve reads")
+	}
+
+	// the role switched at runtime overrides the config
+	loadRole(ROLE_PRIMARY)
+
+	if currentRole() != ROLE_REPLICA {
+		t.Fatal("saved role expected")
+	}
+
+	if primaryAddr != "primary:1" {
+		t.Fatal("saved primary expected")
+	}
+
+	handleRole(&pb.LCPROTO{Value: []byte(ROLE_PRIMARY)})
+
+	if res := set(); res.Err() != nil {
+		t.Fatal("primary must accept writes")
+	}
+
+	if res := handleLog(&pb.LCPROTO{Key: key, Value: []byte("3"), Counter: 1}); res.ErrCode != pb.ERR_REJECTED {
+		t.Fatal("primary must reject changes of the log")
+	}
+
+	if primaryAddr != "" {
+		t.Fatal("primary must forget its primary")
+	}
+}
+
+func TestStalePrimary(t *testing.T) {
+	ldb.Open("test=1 default=1")
+
+	selfAddr = "self:1"
+	defer func() { selfAddr = "" }()
+	defer setRole(ROLE_PRIMARY)
+
+	follow := func(addr string, epoch int64, since time.Time) *pb.LCPROTO {
+		return handleRole(&pb.LCPROTO{Key: []byte(addr), Value: []byte(ROLE_REPLICA), Ivalue: epoch, Ts: uint64(since.UnixNano())})
+	}
+
+	setRole(ROLE_REPLICA)
+	setRole(ROLE_PRIMARY)
+
+	res := follow("old:1", 0, time.Now().Add(-time.Minute))
+	if res.ErrCode != pb.ERR_REJECTED || string(res.Value) != "self:1" || currentRole() != ROLE_PRIMARY {
+		t.Fatal("primary promoted later must reject the old one", res)
+	}
+
+	if res = follow("new:1", 0, time.Now()); res.Err() != nil || currentRole() != ROLE_REPLICA {
+		t.Fatal("newer primary must be followed", res)
+	}
+
+	atomic.StoreInt64(&primarySeen, time.Now().UnixNano())
+
+	if res = follow("old:1", 0, time.Now()); res.ErrCode != pb.ERR_REJECTED || string(res.Value) != "new:1" {
+		t.Fatal("replica hearing its primary must reject other one", res)
+	}
+
+	data, _ := json.Marshal(&connect.Topology{Epoch: 3, Nodes: []connect.NodeInfo{{Addr: "new:1"}}})
+	handleSetTopology(&pb.LCPROTO{Value: data})
+
+	if res = follow("new:1", 2, time.Now()); res.ErrCode != pb.ERR_REJECTED {
+		t.Fatal("primary of older topology must be rejected", res)
+	}
+
+	atomic.StoreInt64(&primarySeen, 0)
+}
@@ -0,0 +1,163 @@
+package engine
+
+import (
+	"bytes"
+
+	"github.com/lj-team/lcluster/pb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+const (
+	SCAN_LIMIT     = 1000
+	SCAN_MAX_LIMIT = 10000
+	SCAN_MAX_BYTES = 4 * 1024 * 1024
+)
+
+// forEachAfter calls fn for keys greater than cursor in order. If subtree
+// is false the keys starting with cursor are skipped too. Without leveldb
+// handle keys are enumerated by prefixes: first the keys starting with
+// cursor, then the keys with the next bytes at every position. Keys and
+// values passed to fn are reused
+func forEachAfter(cursor []byte, subtree bool, fn func(key, value []byte) bool) {
+
+	if s, ok := db.Store.(seeker); ok {
+		seekAfter(s, cursor, subtree, fn)
+		return
+	}
+
+	next := true
+
+	walk := func(prefix []byte, skip bool) {
+		db.ForEach(prefix, false, func(key, value []byte) bool {
+			if skip && len(key) == len(prefix) {
+				return true
+			}
+			next = fn(key, value)
+			return next
+		})
+	}
+
+	if len(cursor) == 0 {
+		if subtree {
+			walk([]byte{}, false)
+		}
+		return
+	}
+
+	if subtree {
+		walk(cursor, true)
+	}
+
+	prefix := make([]byte, len(cursor))
+	copy(prefix, cursor)
+
+	for i := len(cursor) - 1; i >= 0 && next; i-- {
+		for b := int(cursor[i]) + 1; b < 256 && next; b++ {
+			prefix[i] = byte(b)
+			walk(prefix[:i+1], false)
+		}
+	}
+}
+
+// seekAfter iterates keys greater than cursor with a single iterator. The
+// iterator reads a snapshot of the database, so the global mutex is not
+// needed
+func seekAfter(s seeker, cursor []byte, subtree bool, fn func(key, value []byte) bool) {
+
+	var start []byte
+
+	switch {
+	case subtree:
+		if len(cursor) > 0 {
+			start = append(append([]byte{}, cursor...), 0)
+		}
+
+	case len(cursor) == 0:
+		return
+
+	default:
+		// the first key after all keys starting with cursor
+		if start = util.BytesPrefix(cursor).Limit; start == nil {
+			return
+		}
+	}
+
+	s.Seek(start, fn)
+}
+
+// handleScan returns client keys after cursor, ivalue is 1 if the scan
+// is not finished. Internal keys starting with zero byte are skipped
+func handleScan(msg *pb.LCPROTO) *pb.LCPROTO {
+
+	limit := int(msg.Ivalue)
+
+	if limit < 0 {
+		return badArgs("negative limit")
+	}
+
+	if limit == 0 {
+		limit = SCAN_LIMIT
+	}
+
+	if limit > SCAN_MAX_LIMIT {
+		limit = SCAN_MAX_LIMIT
+	}
+
+	// the first scan skips internal keys
+	cursor, subtree := msg.Key, true
+	if len(cursor) == 0 {
+		cursor, subtree = []byte{0}, false
+	}
+
+	list, more := scanKeys(cursor, subtree, limit, nil, func(key []byte) bool {
+		return key[0] != 0
+	})
+
+	return &pb.LCPROTO{List: list, Ivalue: more}
+}
+
+// scanKeys returns keys before end the keep function accepts and their
+// values, more is 1 if the limits are reached. Nil end does not stop the
+// scan
+func scanKeys(cursor []byte, subtree bool, limit int, end []byte, keep func(key []byte) bool) ([][]byte, int64) {
+
+	list := make([][]byte, 0, limit*2)
+	size := 0
+	more := int64(0)
+
+	// prefix enumeration is not isolated from writes
+	if !canSeek() {
+		mutex.Lock()
+	}
+
+	forEachAfter(cursor, subtree, func(key, value []byte) bool {
+		if end != nil && bytes.Compare(key, end) >= 0 {
+			return false
+		}
+
+		if !keep(key) {
+			return true
+		}
+
+		k := make([]byte, len(key))
+		copy(k, key)
+		v := make([]byte, len(value))
+		copy(v, value)
+
+		list = append(list, k, v)
+		size += len(k) + len(v)
+
+		if len(list) >= limit*2 || size >= SCAN_MAX_BYTES {
+			more = 1
+			return false
+		}
+
+		return true
+	})
+
+	if !canSeek() {
+		mutex.Unlock()
+	}
+
+	return list, more
+}
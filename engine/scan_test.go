@@ -0,0 +1,107 @@
+package engine
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/lj-team/go-generic/db/ldb"
+	"github.com/lj-team/lcluster/pb"
+	"github.com/lj-team/lcluster/store"
+)
+
+func TestScan(t *testing.T) {
+	ldb.Open("test=1 default=1")
+
+	keys := [][]byte{
+		{2, 'a'}, {2, 'a', 1}, {2, 'a', 2, 3}, {2, 'b'}, {3, 'a', 'b'}, {3, 0xff, 0xff},
+	}
+
+	for _, k := range keys {
+		ldb.Set(k, []byte{1})
+	}
+	ldb.Set([]byte{0, 'x'}, []byte{1})
+
+	var got [][]byte
+	var cursor []byte
+
+	for {
+		res := handleScan(&pb.LCPROTO{Key: cursor, Ivalue: 2})
+
+		for i := 0; i < len(res.List); i += 2 {
+			got = append(got, res.List[i])
+		}
+
+		if res.Ivalue == 0 {
+			break
+		}
+
+		cursor = res.List[len(res.List)-2]
+	}
+
+	if len(got) != len(keys) {
+		t.Fatalf("%d keys scanned, %d expected", len(got), len(keys))
+	}
+
+	for i := range keys {
+		if !bytes.Equal(got[i], keys[i]) {
+			t.Fatalf("invalid key %v, %v expected", got[i], keys[i])
+		}
+	}
+}
+
+func TestSeek(t *testing.T) {
+	ldb.Open("test=1 default=1")
+
+	dir, err := ioutil.TempDir("", "lcluster")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	sdb, err := store.Open(&ldb.Config{Path: dir, FileSize: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sdb.Close()
+
+	keys := [][]byte{
+		{0, 'x'}, {2, 'a'}, {2, 'a', 1}, {2, 'a', 2, 3}, {2, 'a', 0xff}, {2, 'b'}, {3, 0xff, 0xff},
+	}
+
+	for _, k := range keys {
+		ldb.Set(k, []byte{1})
+		sdb.Set(k, []byte{1})
+	}
+
+	walk := func(cursor []byte, subtree bool) (res []string) {
+		forEachAfter(cursor, subtree, func(key, value []byte) bool {
+			res = append(res, string(key))
+			return true
+		})
+		return
+	}
+
+	cursors := [][]byte{nil, {0}, {2}, {2, 'a'}, {2, 'a', 0xff}, {3, 0xff}, {3, 0xff, 0xff}, {0xff}}
+
+	for _, c := range cursors {
+		for _, subtree := range []bool{true, false} {
+			want := walk(c, subtree)
+
+			db.Store = sdb
+			got := walk(c, subtree)
+			db.Store = ldbStore{}
+
+			if len(got) != len(want) {
+				t.Fatalf("cursor %v subtree %v: %d keys, %d expected", c, subtree, len(got), len(want))
+			}
+
+			for i := range want {
+				if got[i] != want[i] {
+					t.Fatalf("cursor %v subtree %v: key %v, %v expected", c, subtree, []byte(got[i]), []byte(want[i]))
+				}
+			}
+		}
+	}
+}
@@ -1,22 +1,138 @@
 package engine
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"time"
+
+	"github.com/lj-team/lcluster/auth"
 	"github.com/lj-team/lcluster/connect"
+	"github.com/lj-team/lcluster/pb"
 	"github.com/lj-team/lcluster/server"
 )
 
-var repl *connect.Conn
+type Options struct {
+	Addr        string
+	Role        string // ROLE_PRIMARY if empty
+	Replica     string
+	Replicas    []string          // in addition to Replica
+	TLS         *tls.Config       // listener
+	ReplicaTLS  *tls.Config       // connection to replica
+	Auth        *auth.Config      // accepted tokens
+	ReplicaAuth *auth.Credentials // token for replica
+
+	MaxFrameSize int           // request size limit
+	Limits       server.Limits // connections and requests limits
+
+	Topology *connect.Topology // saved if newer than the node has
+	LogSize  int64             // changes kept for replica, DefaultLogSize if 0
+
+	SyncReplicas int           // replicas to confirm C_* writes with sync flag
+	SyncTimeout  time.Duration // DefaultSyncTimeout if 0
+
+	ReadRepair float64 // fraction of reads checked on replicas, 0 - disabled
+
+	Origin         string        // datacenter of the node, required for Peers
+	Peers          []string      // primaries of other datacenters
+	StampRetention time.Duration // DefaultStampRetention if 0, negative - stamps do not expire
+
+	DB Store // store.DB to scan with seeks; nil - default database of ldb, scans by prefixes
+}
+
+var srv = &server.Server{Async: handler, Busy: pb.Busy, Restricted: pb.Restricted, Forbidden: pb.Forbidden}
+
+func Start(addr string, replica string) error {
+	return Run(&Options{Addr: addr, Replica: replica})
+}
+
+func Run(opts *Options) error {
+
+	if opts.Role != "" && !validRole(opts.Role) {
+		return errors.New("unknown role " + opts.Role)
+	}
 
-func Start(addr string, replica string) {
+	if len(opts.Peers) > 0 && opts.Origin == "" {
+		return errors.New("origin is required for peers")
+	}
 
-	if replica != "" {
-		repl = connect.NewConn(replica)
+	if opts.DB != nil {
+		db.Store = opts.DB
 	}
 
-	srv := &server.Server{
-		Addr:     addr,
-		Callback: handler,
+	selfAddr = opts.Addr
+
+	origin = opts.Origin
+	peerAddrs = opts.Peers
+
+	peerOpts = &connect.Options{
+		TLS:  opts.ReplicaTLS,
+		Auth: opts.ReplicaAuth,
+	}
+
+	loadMigration()
+	loadRole(opts.Role)
+
+	mutex.Lock()
+	loadApplied()
+	mutex.Unlock()
+
+	if opts.Topology != nil {
+		saveTopology(opts.Topology)
+	}
+
+	if opts.LogSize != 0 {
+		rlog.size = opts.LogSize
+	}
+
+	syncReplicas = opts.SyncReplicas
+
+	if opts.SyncTimeout > 0 {
+		syncTimeout = opts.SyncTimeout
+	}
+
+	replicaAddrs = append([]string{opts.Replica}, opts.Replicas...)
+
+	startReplicas()
+	startPeers()
+
+	if opts.ReadRepair > 0 {
+		readRepairRate = opts.ReadRepair
+		go repairLoop()
+	}
+
+	if opts.StampRetention != 0 {
+		stampRetention = opts.StampRetention
+	}
+
+	if origin != "" && stampRetention > 0 {
+		go gcLoop()
+	}
+
+	srv.Addr = opts.Addr
+	srv.TLS = opts.TLS
+	srv.MaxFrameSize = opts.MaxFrameSize
+	srv.Limits = opts.Limits
+
+	if opts.Auth.Enabled() {
+		srv.Auth = opts.Auth.Handler()
+	}
+
+	return srv.Start()
+}
+
+// Shutdown waits for in-flight requests and closes replica and peer connections
+func Shutdown(ctx context.Context) error {
+	err := srv.Shutdown(ctx)
+
+	repl.Close()
+	dcPeers.Close()
+
+	peersMutex.Lock()
+	for _, c := range peers {
+		c.Close()
 	}
+	peersMutex.Unlock()
 
-	srv.Start()
+	return err
 }
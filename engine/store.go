@@ -0,0 +1,245 @@
+package engine
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/lj-team/go-generic/db/ldb"
+	"github.com/lj-team/go-generic/log"
+	"github.com/lj-team/lcluster/store"
+)
+
+// Store is the database of the engine
+type Store interface {
+	Get(key []byte) []byte
+	Set(key, value []byte)
+	Has(key []byte) bool
+	Del(key []byte)
+	ForEach(prefix []byte, removePrefix bool, fn ldb.FOR_EACH_FUNC)
+	Write(b *store.Batch) error
+}
+
+// seeker is a Store iterating keys in order from any position, see
+// store.DB
+type seeker interface {
+	Seek(start []byte, fn ldb.FOR_EACH_FUNC)
+}
+
+// ldbStore is the default database of go-generic ldb, its batches are
+// not atomic
+type ldbStore struct{}
+
+func (ldbStore) Get(key []byte) []byte {
+	return ldb.Get(key)
+}
+
+func (ldbStore) Set(key, value []byte) {
+	ldb.Set(key, value)
+}
+
+func (ldbStore) Has(key []byte) bool {
+	return ldb.Has(key)
+}
+
+func (ldbStore) Del(key []byte) {
+	ldb.Del(key)
+}
+
+func (ldbStore) ForEach(prefix []byte, removePrefix bool, fn ldb.FOR_EACH_FUNC) {
+	ldb.ForEach(prefix, removePrefix, fn)
+}
+
+// Write copies the keys and values, they are reused by the batch
+func (ldbStore) Write(b *store.Batch) error {
+	b.Replay(func(key, value []byte) {
+		ldb.Set(append([]byte{}, key...), append([]byte{}, value...))
+	}, func(key []byte) {
+		ldb.Del(key)
+	})
+	return nil
+}
+
+// batchStore collects writes into a batch between begin and commit, they
+// are read back before the batch is saved. Writes of other goroutines
+// meanwhile join the batch
+type batchStore struct {
+	Store
+
+	batch   store.Batch
+	pending map[string][]byte // nil value - deleted; nil map - writes are saved at once
+	mt      sync.Mutex
+}
+
+var db = &batchStore{Store: ldbStore{}}
+
+func (s *batchStore) begin() {
+	s.mt.Lock()
+	s.pending = make(map[string][]byte)
+	s.mt.Unlock()
+}
+
+func (s *batchStore) commit() {
+	s.mt.Lock()
+	defer s.mt.Unlock()
+
+	if s.batch.Len() > 0 {
+		if err := s.Store.Write(&s.batch); err != nil {
+			log.Error("database: " + err.Error())
+		}
+		s.batch.Reset()
+	}
+
+	s.pending = nil
+}
+
+// lookup returns the pending value of the key
+func (s *batchStore) lookup(key []byte) ([]byte, bool) {
+	s.mt.Lock()
+	defer s.mt.Unlock()
+
+	value, ok := s.pending[string(key)]
+	return value, ok
+}
+
+func (s *batchStore) Get(key []byte) []byte {
+	if value, ok := s.lookup(key); ok {
+		return value
+	}
+	return s.Store.Get(key)
+}
+
+func (s *batchStore) Has(key []byte) bool {
+	if value, ok := s.lookup(key); ok {
+		return value != nil
+	}
+	return s.Store.Has(key)
+}
+
+// Set deletes the key if value is empty
+func (s *batchStore) Set(key, value []byte) {
+	s.mt.Lock()
+	defer s.mt.Unlock()
+
+	if s.pending == nil {
+		s.Store.Set(key, value)
+		return
+	}
+
+	if len(value) == 0 {
+		s.pending[string(key)] = nil
+	} else {
+		s.pending[string(key)] = append([]byte{}, value...)
+	}
+
+	s.batch.Set(key, value)
+}
+
+func (s *batchStore) Del(key []byte) {
+	s.mt.Lock()
+	defer s.mt.Unlock()
+
+	if s.pending == nil {
+		s.Store.Del(key)
+		return
+	}
+
+	s.pending[string(key)] = nil
+	s.batch.Del(key)
+}
+
+// ForEach merges the pending writes with the prefix into the saved keys
+func (s *batchStore) ForEach(prefix []byte, removePrefix bool, fn ldb.FOR_EACH_FUNC) {
+
+	s.mt.Lock()
+
+	var keys []string
+	values := make(map[string][]byte)
+
+	for k, v := range s.pending {
+		if strings.HasPrefix(k, string(prefix)) {
+			keys = append(keys, k)
+			values[k] = v
+		}
+	}
+
+	s.mt.Unlock()
+
+	if len(keys) == 0 {
+		s.Store.ForEach(prefix, removePrefix, fn)
+		return
+	}
+
+	sort.Strings(keys)
+
+	visit := func(key, value []byte) bool {
+		if removePrefix {
+			key = key[len(prefix):]
+		}
+		return fn(key, value)
+	}
+
+	// visits pending keys before key, all of them if key is nil
+	next := func(key []byte) bool {
+		for ; len(keys) > 0 && (key == nil || keys[0] < string(key)); keys = keys[1:] {
+			if v := values[keys[0]]; v != nil && !visit([]byte(keys[0]), v) {
+				return false
+			}
+		}
+		return true
+	}
+
+	done := false
+
+	s.Store.ForEach(prefix, false, func(key, value []byte) bool {
+		if !next(key) {
+			done = true
+			return false
+		}
+
+		if len(keys) > 0 && keys[0] == string(key) {
+			value = values[keys[0]]
+			keys = keys[1:]
+
+			if value == nil {
+				return true
+			}
+		}
+
+		if !visit(key, value) {
+			done = true
+			return false
+		}
+
+		return true
+	})
+
+	if !done {
+		next(nil)
+	}
+}
+
+// canSeek reports whether keys are iterated in order from any position,
+// otherwise they are enumerated by prefixes. Seeks read saved keys only
+func canSeek() bool {
+	_, ok := db.Store.(seeker)
+	return ok
+}
+
+// batchMutex is the engine mutex. Writes made while it is locked are saved
+// in one batch on Unlock, so a change and its log entry are saved together
+// and replicas get the change after it is saved
+type batchMutex struct {
+	sync.Mutex
+}
+
+func (m *batchMutex) Lock() {
+	m.Mutex.Lock()
+	db.begin()
+}
+
+func (m *batchMutex) Unlock() {
+	db.commit()
+	rlog.publish()
+	m.Mutex.Unlock()
+}
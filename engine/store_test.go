@@ -0,0 +1,52 @@
+package engine
+
+import (
+	"testing"
+
+	"github.com/lj-team/go-generic/db/ldb"
+	"github.com/lj-team/lcluster/pb"
+)
+
+func TestBatch(t *testing.T) {
+	ldb.Open("test=1 default=1")
+
+	repl.Set([]string{"127.0.0.1:1"})
+	defer repl.Close()
+
+	ldb.Set([]byte{2, 'b', 'a'}, []byte("1"))
+	ldb.Set([]byte{2, 'b', 'c'}, []byte("3"))
+
+	mutex.Lock()
+
+	db.Set([]byte{2, 'b', 'b'}, []byte("2"))
+	db.Del([]byte{2, 'b', 'c'})
+	seq := repl.Log([]byte{2, 'b', 'b'}, []byte("2"), pb.LOG_SET)
+
+	if ldb.Has([]byte{2, 'b', 'b'}) || !ldb.Has([]byte{2, 'b', 'c'}) {
+		t.Fatal("writes must be saved on unlock")
+	}
+
+	if string(db.Get([]byte{2, 'b', 'b'})) != "2" || db.Has([]byte{2, 'b', 'c'}) {
+		t.Fatal("pending writes must be read")
+	}
+
+	var keys string
+	db.ForEach([]byte{2, 'b'}, true, func(key, value []byte) bool {
+		keys += string(key) + string(value)
+		return true
+	})
+
+	if keys != "a1b2" {
+		t.Fatal("pending writes must be iterated", keys)
+	}
+
+	mutex.Unlock()
+
+	if string(ldb.Get([]byte{2, 'b', 'b'})) != "2" || ldb.Has([]byte{2, 'b', 'c'}) {
+		t.Fatal("writes must be saved")
+	}
+
+	if _, _, last, _ := rlog.State(); seq == 0 || last != seq {
+		t.Fatal("change must be published on unlock")
+	}
+}
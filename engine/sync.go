@@ -0,0 +1,299 @@
+package engine
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"sync/atomic"
+	"time"
+
+	"github.com/lj-team/go-generic/encode/pack"
+	"github.com/lj-team/go-generic/log"
+	"github.com/lj-team/lcluster/pb"
+)
+
+var appliedKey = []byte("\x00seq:applied")
+
+// position of the replica in the log of its primary. Seq is -1 while
+// full copy is not finished, the copy is consistent when seq reaches
+// until. Guarded by mutex
+var applied struct {
+	id     []byte
+	seq    int64
+	until  int64
+	loaded bool
+}
+
+// syncing is 1 while the replica data is not consistent, client
+// requests are rejected
+var syncing int32
+
+func loadApplied() {
+
+	if applied.loaded {
+		return
+	}
+
+	data := db.Get(appliedKey)
+
+	if len(data) >= 16 {
+		applied.seq = bytesSeq(data)
+		applied.until = bytesSeq(data[8:])
+		applied.id = data[16:]
+	} else {
+		applied.seq = -1
+	}
+
+	applied.loaded = true
+
+	setSyncing()
+}
+
+func saveApplied(id []byte, seq, until int64) {
+	applied.id = append([]byte{}, id...)
+	applied.seq = seq
+	applied.until = until
+	applied.loaded = true
+
+	db.Set(appliedKey, append(append(seqBytes(seq), seqBytes(until)...), id...))
+
+	setSyncing()
+}
+
+func setSyncing() {
+
+	var v int32
+
+	if len(applied.id) > 0 && (applied.seq < 0 || applied.seq < applied.until) {
+		v = 1
+	}
+
+	if atomic.SwapInt32(&syncing, v) != v && v == 0 {
+		log.Info("full copy of the primary is consistent")
+	}
+}
+
+// unsynced returns an error for client requests while the copy of the
+// primary is not consistent
+func unsynced(msg *pb.LCPROTO) (*pb.LCPROTO, bool) {
+
+	if atomic.LoadInt32(&syncing) == 0 {
+		return nil, false
+	}
+
+	if noReply(msg) {
+		return nil, true
+	}
+
+	return pb.ErrorResponse(pb.ERR_UNAVAILABLE, "replica is syncing"), true
+}
+
+// handleLog applies a change of the primary. Changes with seq must
+// follow the applied one, others are skipped and the primary resends
+// them from the position. Changes of peers are merged
+func handleLog(msg *pb.LCPROTO) *pb.LCPROTO {
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if msg.Peer {
+		handlePeerLog(msg)
+		return nil
+	}
+
+	// only replica applies changes of the primary
+	if atomic.LoadInt32(&readonly) == 0 {
+		return pb.ErrorResponse(pb.ERR_REJECTED, "node is not replica")
+	}
+
+	atomic.StoreInt64(&primarySeen, time.Now().UnixNano())
+
+	if msg.Ivalue > 0 {
+		loadApplied()
+
+		if applied.seq < 0 || msg.Ivalue != applied.seq+1 {
+			return nil
+		}
+	}
+
+	// LOG_DELALL stamps the keys before they are deleted
+	if msg.Origin != "" {
+		clock.Update(msg.Ts)
+		saveState(msg)
+	}
+
+	applyLog(msg)
+
+	if msg.Ivalue > 0 {
+		saveApplied(applied.id, msg.Ivalue, applied.until)
+	}
+
+	return nil
+}
+
+// applyLog makes the change of LOG_* operation, unknown ones are skipped
+func applyLog(msg *pb.LCPROTO) {
+
+	switch msg.Counter {
+	case pb.LOG_SET:
+		if len(msg.Value) == 0 {
+			db.Del(msg.Key)
+		} else {
+			db.Set(msg.Key, msg.Value)
+		}
+
+	case pb.LOG_DEL:
+		db.Del(msg.Key)
+
+	case pb.LOG_INCBY:
+		// the resulting value makes the change idempotent, changes made
+		// during full copy may be in the copy already
+		if len(msg.List) > 0 {
+			if len(msg.List[0]) == 0 {
+				db.Del(msg.Key)
+			} else {
+				db.Set(msg.Key, msg.List[0])
+			}
+			break
+		}
+
+		val := pack.Bytes2Int(db.Get(msg.Key)) + pack.Bytes2Int(msg.Value)
+		db.Set(msg.Key, pack.Int2Bytes(val))
+
+	case pb.LOG_DELALL:
+		var keys [][]byte
+
+		// internal keys of the replica are kept
+		db.ForEach(msg.Key, false, func(key []byte, value []byte) bool {
+			if key[0] != 0 {
+				keys = append(keys, append([]byte{}, key...))
+			}
+			return true
+		})
+
+		for _, key := range keys {
+			db.Del(key)
+		}
+
+	case pb.LOG_SKIP:
+
+	default:
+		log.Warn(fmt.Sprintf("unknown log operation %d", msg.Counter))
+	}
+}
+
+func handleReplPos(msg *pb.LCPROTO) *pb.LCPROTO {
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if msg.Peer {
+		return peerPos(msg)
+	}
+
+	atomic.StoreInt64(&primarySeen, time.Now().UnixNano())
+
+	loadApplied()
+
+	if !bytes.Equal(applied.id, msg.Key) {
+		return &pb.LCPROTO{Ivalue: -1}
+	}
+
+	return &pb.LCPROTO{Ivalue: applied.seq}
+}
+
+// handleResync deletes client keys, stamps and slots by parts before full
+// copy of the primary. Positive ivalue is the seq the copy is consistent
+// from. Only replica of the primary in value accepts it
+func handleResync(msg *pb.LCPROTO) *pb.LCPROTO {
+
+	if len(msg.Key) == 0 || msg.Ivalue < 0 {
+		return badArgs("log id and seq expected")
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if atomic.LoadInt32(&readonly) == 0 || string(msg.Value) != primaryAddr {
+		return pb.ErrorResponse(pb.ERR_REJECTED, "node is not replica of "+string(msg.Value))
+	}
+
+	loadApplied()
+
+	if msg.Ivalue > 0 {
+		if !bytes.Equal(applied.id, msg.Key) || applied.seq < 0 {
+			return badArgs("full copy is not finished")
+		}
+
+		saveApplied(msg.Key, applied.seq, msg.Ivalue-1)
+
+		return &pb.LCPROTO{}
+	}
+
+	saveApplied(msg.Key, -1, 0)
+
+	var keys [][]byte
+
+	forEachAfter([]byte{0}, false, func(key, value []byte) bool {
+		keys = append(keys, append([]byte{}, key...))
+		return len(keys) < SCAN_LIMIT
+	})
+
+	// stamps and slots are copied too
+	if len(keys) < SCAN_LIMIT {
+		forEachAfter(slotPrefix, true, func(key, value []byte) bool {
+			if bytes.Compare(key, stateLimit) >= 0 {
+				return false
+			}
+			if isStateKey(key) {
+				keys = append(keys, append([]byte{}, key...))
+			}
+			return len(keys) < SCAN_LIMIT
+		})
+	}
+
+	for _, key := range keys {
+		db.Del(key)
+	}
+
+	if len(keys) < SCAN_LIMIT {
+		return &pb.LCPROTO{}
+	}
+
+	return &pb.LCPROTO{Ivalue: 1}
+}
+
+// handleSync saves a part of full copy of the primary started by
+// RESYNC, internal keys except stamps and slots are skipped. Positive ivalue finishes the copy, the log is applied from
+// the seq
+func handleSync(msg *pb.LCPROTO) *pb.LCPROTO {
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	loadApplied()
+
+	if !bytes.Equal(applied.id, msg.Key) || applied.seq >= 0 {
+		if noReply(msg) {
+			return nil
+		}
+		return badArgs("full copy is not started")
+	}
+
+	for i := 0; i+1 < len(msg.List); i += 2 {
+		if len(msg.List[i]) > 0 && (msg.List[i][0] != 0 || isStateKey(msg.List[i])) {
+			db.Set(msg.List[i], msg.List[i+1])
+		}
+	}
+
+	// consistent seq is set by RESYNC
+	if msg.Ivalue > 0 {
+		saveApplied(msg.Key, msg.Ivalue-1, math.MaxInt64)
+	}
+
+	if noReply(msg) {
+		return nil
+	}
+
+	return &pb.LCPROTO{}
+}
@@ -0,0 +1,101 @@
+package engine
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lj-team/go-generic/db/ldb"
+	"github.com/lj-team/lcluster/pb"
+)
+
+func TestReplicaSync(t *testing.T) {
+	ldb.Open("test=1 default=1")
+
+	applied.loaded = false
+	defer saveApplied(nil, -1, 0)
+
+	id := []byte("primary")
+	key := []byte{2, 'k', 'a'}
+
+	if res := handleResync(&pb.LCPROTO{Key: id, Value: []byte("primary:1")}); res.ErrCode != pb.ERR_REJECTED {
+		t.Fatal("primary must reject full copy")
+	}
+
+	handleRole(&pb.LCPROTO{Key: []byte("primary:1"), Value: []byte(ROLE_REPLICA), Ts: uint64(time.Now().UnixNano())})
+	defer setRole(ROLE_PRIMARY)
+
+	if res := handleResync(&pb.LCPROTO{Key: id, Value: []byte("other:1")}); res.ErrCode != pb.ERR_REJECTED {
+		t.Fatal("replica must reject full copy of other primary")
+	}
+
+	pos := func() int64 {
+		return handleReplPos(&pb.LCPROTO{Key: id}).Ivalue
+	}
+
+	get := func() *pb.LCPROTO {
+		return route(&pb.LCPROTO{Code: pb.LCPROTO_C_GET, Key: key}, handleCGet)
+	}
+
+	if pos() != -1 {
+		t.Fatal("unknown log expected")
+	}
+
+	ldb.Set([]byte{2, 'o', 'l'}, []byte("old"))
+	ldb.Set(stampKey([]byte{2, 'o', 'l'}), []byte("old stamp"))
+
+	if res := handleResync(&pb.LCPROTO{Key: id, Value: []byte("primary:1")}); res.Err() != nil || res.Ivalue != 0 {
+		t.Fatal("keys must be deleted")
+	}
+
+	if ldb.Has([]byte{2, 'o', 'l'}) || ldb.Has(stampKey([]byte{2, 'o', 'l'})) {
+		t.Fatal("old key is not deleted")
+	}
+
+	handleSync(&pb.LCPROTO{Key: id, List: [][]byte{key, []byte("10"), stampKey(key), []byte("stamp"), appliedKey, nil}})
+
+	if string(ldb.Get(stampKey(key))) != "stamp" {
+		t.Fatal("stamps must be copied")
+	}
+
+	// changes are skipped until the copy is finished
+	handleLog(&pb.LCPROTO{Key: key, Value: []byte("1"), Counter: 1, Ivalue: 1})
+
+	if string(ldb.Get(key)) != "10" || pos() != -1 {
+		t.Fatal("change is applied before full copy")
+	}
+
+	if res := get(); res.ErrCode != pb.ERR_UNAVAILABLE {
+		t.Fatal("requests must be rejected while syncing")
+	}
+
+	handleSync(&pb.LCPROTO{Key: id, Ivalue: 11, Sync: true})
+	handleResync(&pb.LCPROTO{Key: id, Value: []byte("primary:1"), Ivalue: 13})
+
+	if pos() != 10 {
+		t.Fatal("position 10 expected")
+	}
+
+	handleLog(&pb.LCPROTO{Key: key, Value: []byte("12"), Counter: 1, Ivalue: 12})
+	handleLog(&pb.LCPROTO{Key: key, Value: []byte("11"), Counter: 1, Ivalue: 11})
+
+	if string(ldb.Get(key)) != "11" || pos() != 11 {
+		t.Fatal("only the next change must be applied")
+	}
+
+	if res := get(); res.ErrCode != pb.ERR_UNAVAILABLE {
+		t.Fatal("copy is not consistent until 12 is applied")
+	}
+
+	handleLog(&pb.LCPROTO{Key: key, Value: []byte("12"), Counter: 1, Ivalue: 12})
+
+	if res := get(); res.Err() != nil || string(res.Value) != "12" {
+		t.Fatal("consistent copy must be served")
+	}
+
+	// the position is saved
+	applied.loaded = false
+
+	if pos() != 12 {
+		t.Fatal("position is not saved")
+	}
+}
@@ -0,0 +1,115 @@
+package engine
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/lj-team/go-generic/log"
+	"github.com/lj-team/lcluster/connect"
+	"github.com/lj-team/lcluster/pb"
+)
+
+var topologyKey = []byte("\x00topology")
+
+// loadTopology returns saved topology, nil if there is no one
+func loadTopology() *connect.Topology {
+	data := db.Get(topologyKey)
+	if data == nil {
+		return nil
+	}
+
+	var t connect.Topology
+
+	if err := json.Unmarshal(data, &t); err != nil {
+		log.Error("topology: " + err.Error())
+		return nil
+	}
+
+	return &t
+}
+
+// saveTopology saves t if it is newer than the saved one, the epoch of
+// the node is returned
+func saveTopology(t *connect.Topology) int64 {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if old := loadTopology(); old != nil && old.Epoch >= t.Epoch {
+		return old.Epoch
+	}
+
+	data, _ := json.Marshal(t)
+	db.Set(topologyKey, data)
+
+	log.Info("topology is updated: " + string(data))
+
+	return t.Epoch
+}
+
+// claimTopology saves t of the failover if it is newer than the saved one,
+// false is returned if other topology of the same or greater epoch is
+// saved, so only one failover of the epoch is made
+func claimTopology(t *connect.Topology) bool {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	data, _ := json.Marshal(t)
+
+	if saved := db.Get(topologyKey); bytes.Equal(saved, data) {
+		return true
+	}
+
+	if old := loadTopology(); old != nil && old.Epoch >= t.Epoch {
+		return false
+	}
+
+	db.Set(topologyKey, data)
+
+	log.Info("topology is updated by failover: " + string(data))
+
+	return true
+}
+
+// topologyEpoch returns the epoch of the saved topology, 0 if there is no one
+func topologyEpoch() int64 {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if t := loadTopology(); t != nil {
+		return t.Epoch
+	}
+
+	return 0
+}
+
+// handleTopology returns topology if its epoch is greater than ivalue
+func handleTopology(msg *pb.LCPROTO) *pb.LCPROTO {
+	mutex.Lock()
+	data := db.Get(topologyKey)
+	t := loadTopology()
+	mutex.Unlock()
+
+	if t == nil {
+		return &pb.LCPROTO{}
+	}
+
+	if t.Epoch <= msg.Ivalue {
+		return &pb.LCPROTO{Ivalue: t.Epoch}
+	}
+
+	return &pb.LCPROTO{Ivalue: t.Epoch, Value: data}
+}
+
+func handleSetTopology(msg *pb.LCPROTO) *pb.LCPROTO {
+	var t connect.Topology
+
+	if err := json.Unmarshal(msg.Value, &t); err != nil {
+		return badArgs(err.Error())
+	}
+
+	if err := t.Check(); err != nil {
+		return badArgs(err.Error())
+	}
+
+	return &pb.LCPROTO{Ivalue: saveTopology(&t)}
+}
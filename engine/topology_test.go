@@ -0,0 +1,78 @@
+package engine
+
+import (
+	"encoding/json"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/lj-team/go-generic/db/ldb"
+	"github.com/lj-team/lcluster/connect"
+	"github.com/lj-team/lcluster/pb"
+)
+
+func TestTopology(t *testing.T) {
+	ldb.Open("test=1 default=1")
+
+	set := func(epoch int64, addr string) int64 {
+		data, _ := json.Marshal(&connect.Topology{Epoch: epoch, Nodes: []connect.NodeInfo{{Addr: addr}}})
+		res := handleSetTopology(&pb.LCPROTO{Value: data})
+		if res.Err() != nil {
+			t.Fatal(res.Err())
+		}
+		return res.Ivalue
+	}
+
+	if res := handleTopology(&pb.LCPROTO{}); res.Ivalue != 0 || res.Value != nil {
+		t.Fatal("no topology expected")
+	}
+
+	if set(2, "a") != 2 || set(1, "b") != 2 {
+		t.Fatal("older topology must be ignored")
+	}
+
+	res := handleTopology(&pb.LCPROTO{Ivalue: 1})
+
+	var top connect.Topology
+	if err := json.Unmarshal(res.Value, &top); err != nil || top.Epoch != 2 || top.Nodes[0].Addr != "a" {
+		t.Fatal("invalid topology", string(res.Value))
+	}
+
+	if res = handleTopology(&pb.LCPROTO{Ivalue: 2}); res.Ivalue != 2 || res.Value != nil {
+		t.Fatal("known topology must not be sent")
+	}
+
+	if res = handleSetTopology(&pb.LCPROTO{Value: []byte(`{"epoch": 3}`)}); res.ErrCode != pb.ERR_BAD_ARGS {
+		t.Fatal("empty topology must be rejected")
+	}
+}
+
+func TestFailover(t *testing.T) {
+	ldb.Open("test=1 default=1")
+	defer repl.Set(nil)
+
+	promote := func(epoch int64, addr string) *pb.LCPROTO {
+		data, _ := json.Marshal(&connect.Topology{Epoch: epoch, Nodes: []connect.NodeInfo{{Addr: addr}}})
+		return handlePromote(&pb.LCPROTO{Key: data, Ivalue: 1})
+	}
+
+	atomic.StoreInt64(&primarySeen, time.Now().UnixNano())
+
+	if res := promote(5, "a"); res.ErrCode != pb.ERR_REJECTED {
+		t.Fatal("replica hearing the primary must reject failover")
+	}
+
+	atomic.StoreInt64(&primarySeen, time.Now().Add(-PRIMARY_TIMEOUT).UnixNano())
+
+	if res := promote(5, "a"); res.Err() != nil || res.Ivalue != 5 {
+		t.Fatal("failover expected", res.Err())
+	}
+
+	if res := promote(5, "a"); res.Err() != nil {
+		t.Fatal("the same failover must be accepted again", res.Err())
+	}
+
+	if res := promote(5, "b"); res.ErrCode != pb.ERR_REJECTED || res.Ivalue != 5 {
+		t.Fatal("other failover of the epoch must be rejected")
+	}
+}
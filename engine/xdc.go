@@ -0,0 +1,800 @@
+package engine
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/lj-team/go-generic/encode/pack"
+	"github.com/lj-team/go-generic/log"
+	"github.com/lj-team/lcluster/connect"
+	"github.com/lj-team/lcluster/pb"
+)
+
+// Multi-datacenter replication. Every datacenter has its own primary and
+// the primaries exchange changes through peers. Changes carry hybrid
+// logical clock and origin datacenter, peers get only changes made in the
+// datacenter of the node, so changes do not return.
+//
+// Sets and deletes are merged by last writer wins: the stamp of the last
+// one (base) is kept for every key and changes of other datacenters are
+// applied if they are newer. Increments do not move the base, every
+// datacenter keeps the sum of its increments on the base (slot) and sends
+// the sum instead of the delta. The value is the base value plus the sums
+// of its slots. A newer base resets the slots, increments made on an
+// older base are dropped. A slot is counted once however many times it is
+// received, so full copies and repeated changes are idempotent.
+//
+// Stamps and slots expire after the retention, an expired stamp is older
+// than any kept one. Peers must deliver changes within the retention,
+// older ones are ignored. A key of full copy with expired stamps on both
+// sides keeps the greater value
+
+// DefaultStampRetention is how long stamps and slots are kept
+const DefaultStampRetention = 24 * time.Hour
+
+const (
+	STAMP_GC_INTERVAL = 10 * time.Minute
+	STAMP_GC_BATCH    = 1000
+)
+
+var (
+	origin         string   // datacenter of the node, empty - disabled
+	peerAddrs      []string // nodes of other datacenters
+	dcPeers        = &replicaSet{peer: true}
+	clock          = &hlClock{}
+	stampRetention = DefaultStampRetention
+)
+
+var (
+	stampPrefix   = []byte("\x00ts:")
+	slotPrefix    = []byte("\x00slot:")
+	peerPosPrefix = []byte("\x00peer:")
+)
+
+// hlClock is hybrid logical clock: milliseconds in the high 48 bits and
+// the counter of changes in the same millisecond. It runs ahead of the
+// clocks of received changes
+type hlClock struct {
+	last uint64
+	mt   sync.Mutex
+}
+
+// Now returns timestamp greater than the previous and received ones
+func (c *hlClock) Now() uint64 {
+	c.mt.Lock()
+	defer c.mt.Unlock()
+
+	ts := uint64(time.Now().UnixNano()/int64(time.Millisecond)) << 16
+
+	if ts <= c.last {
+		ts = c.last + 1
+	}
+
+	c.last = ts
+
+	return ts
+}
+
+// Update moves the clock after ts of the received change
+func (c *hlClock) Update(ts uint64) {
+	c.mt.Lock()
+	if ts > c.last {
+		c.last = ts
+	}
+	c.mt.Unlock()
+}
+
+// expiry returns the clock stamps older than are expired, 0 if they are
+// kept forever
+func expiry() uint64 {
+	if stampRetention <= 0 {
+		return 0
+	}
+	return uint64(time.Now().Add(-stampRetention).UnixNano()/int64(time.Millisecond)) << 16
+}
+
+// stamp of the last set or delete of the key, it is kept after deletion
+// so an older change of other datacenter does not restore the key
+type stamp struct {
+	ts     uint64
+	origin string
+}
+
+// after compares stamps, origin resolves changes made at the same time
+func (s stamp) after(o stamp) bool {
+	return s.ts > o.ts || s.ts == o.ts && s.origin > o.origin
+}
+
+// known returns zero stamp if the stamp is expired
+func (s stamp) known() stamp {
+	if s.ts < expiry() {
+		return stamp{}
+	}
+	return s
+}
+
+func (s stamp) bytes() []byte {
+	buf := make([]byte, 8, 8+len(s.origin))
+	binary.BigEndian.PutUint64(buf, s.ts)
+	return append(buf, s.origin...)
+}
+
+func parseStamp(data []byte) stamp {
+	if len(data) < 8 {
+		return stamp{}
+	}
+	return stamp{ts: binary.BigEndian.Uint64(data), origin: string(data[8:])}
+}
+
+func stampKey(key []byte) []byte {
+	return append(append([]byte{}, stampPrefix...), key...)
+}
+
+// loadStamp returns zero stamp for keys changed before origin is set
+func loadStamp(key []byte) stamp {
+	return parseStamp(db.Get(stampKey(key)))
+}
+
+// slot is the sum of increments of one datacenter on the base of the key
+type slot struct {
+	ts   uint64 // the last increment
+	sum  int64
+	base stamp
+}
+
+func (sl slot) bytes() []byte {
+	buf := make([]byte, 16, 24+len(sl.base.origin))
+	binary.BigEndian.PutUint64(buf, sl.ts)
+	binary.BigEndian.PutUint64(buf[8:], uint64(sl.sum))
+	return append(buf, sl.base.bytes()...)
+}
+
+func parseSlot(data []byte) (slot, bool) {
+	if len(data) < 24 {
+		return slot{}, false
+	}
+
+	return slot{
+		ts:   binary.BigEndian.Uint64(data),
+		sum:  int64(binary.BigEndian.Uint64(data[8:])),
+		base: parseStamp(data[16:]),
+	}, true
+}
+
+// slotKey starts with the key length, so the slots of the key are found
+// by prefix without the slots of longer keys
+func slotKey(key []byte, o string) []byte {
+	buf := make([]byte, len(slotPrefix)+4, len(slotPrefix)+4+len(key)+len(o))
+	copy(buf, slotPrefix)
+	binary.BigEndian.PutUint32(buf[len(slotPrefix):], uint32(len(key)))
+	return append(append(buf, key...), o...)
+}
+
+// splitSlotKey returns the key and the origin of the slot
+func splitSlotKey(data []byte) ([]byte, string, bool) {
+
+	if !bytes.HasPrefix(data, slotPrefix) || len(data) < len(slotPrefix)+4 {
+		return nil, "", false
+	}
+
+	data = data[len(slotPrefix):]
+	n := int(binary.BigEndian.Uint32(data))
+
+	if len(data) < 4+n {
+		return nil, "", false
+	}
+
+	return data[4 : 4+n], string(data[4+n:]), true
+}
+
+func loadSlot(key []byte, o string) (slot, bool) {
+	return parseSlot(db.Get(slotKey(key, o)))
+}
+
+// loadSlots returns the slots of the key by origin
+func loadSlots(key []byte) map[string]slot {
+
+	slots := map[string]slot{}
+
+	db.ForEach(slotKey(key, ""), false, func(k, v []byte) bool {
+		if _, o, ok := splitSlotKey(k); ok {
+			if sl, ok := parseSlot(v); ok {
+				slots[o] = sl
+			}
+		}
+		return true
+	})
+
+	return slots
+}
+
+// parseSlots returns slots of the list of origins and slots
+func parseSlots(list [][]byte) map[string]slot {
+
+	slots := map[string]slot{}
+
+	for i := 0; i+1 < len(list); i += 2 {
+		if sl, ok := parseSlot(list[i+1]); ok {
+			slots[string(list[i])] = sl
+		}
+	}
+
+	return slots
+}
+
+// slotList returns origins and slots on the base sorted by origin
+func slotList(slots map[string]slot, base stamp) [][]byte {
+
+	var origins []string
+
+	for o, sl := range slots {
+		if sl.base.known() == base {
+			origins = append(origins, o)
+		}
+	}
+
+	sort.Strings(origins)
+
+	var list [][]byte
+
+	for _, o := range origins {
+		list = append(list, []byte(o), slots[o].bytes())
+	}
+
+	return list
+}
+
+// slotSum returns the sum of the slots on the base, false if there are
+// none
+func slotSum(slots map[string]slot, base stamp) (int64, bool) {
+
+	var sum int64
+	found := false
+
+	for _, sl := range slots {
+		if sl.base.known() == base {
+			sum += sl.sum
+			found = true
+		}
+	}
+
+	return sum, found
+}
+
+// withSlots returns the value of the key, the value with slots is a
+// counter
+func withSlots(value []byte, slots map[string]slot, base stamp) []byte {
+	if sum, ok := slotSum(slots, base); ok {
+		return pack.Int2Bytes(pack.Bytes2Int(value) + sum)
+	}
+	return value
+}
+
+// withoutSlots returns the base value of the key
+func withoutSlots(value []byte, slots map[string]slot, base stamp) []byte {
+	if sum, ok := slotSum(slots, base); ok {
+		return pack.Int2Bytes(pack.Bytes2Int(value) - sum)
+	}
+	return value
+}
+
+// stampChange stamps the change of the node and saves the stamp, the
+// increment gets the slot of the node. Must be called with mutex locked
+func stampChange(rec *pb.LCPROTO) {
+
+	rec.Ts = clock.Now()
+	rec.Origin = origin
+
+	if rec.Counter == pb.LOG_INCBY {
+		base := loadStamp(rec.Key)
+		sl := slot{ts: rec.Ts, sum: pack.Bytes2Int(rec.Value), base: base}
+
+		if own, ok := loadSlot(rec.Key, origin); ok && own.base.known() == base.known() {
+			sl.sum += own.sum
+		}
+
+		rec.List = append(rec.List, sl.bytes())
+	}
+
+	saveState(rec)
+}
+
+// saveState keeps the stamp of the change if it is newer and the slots
+// it carries. LOG_DELALL changes the stamps of all keys starting with the
+// key, so it is saved before the keys are deleted. Must be called with
+// mutex locked
+func saveState(rec *pb.LCPROTO) {
+
+	s := stamp{ts: rec.Ts, origin: rec.Origin}
+
+	switch rec.Counter {
+	case pb.LOG_SKIP:
+
+	case pb.LOG_INCBY:
+		if len(rec.List) > 1 {
+			if sl, ok := parseSlot(rec.List[1]); ok {
+				db.Set(slotKey(rec.Key, rec.Origin), sl.bytes())
+			}
+		}
+
+	case pb.LOG_DELALL:
+		var keys [][]byte
+
+		db.ForEach(stampKey(rec.Key), false, func(key, value []byte) bool {
+			keys = append(keys, append([]byte{}, key[len(stampPrefix):]...))
+			return true
+		})
+
+		db.ForEach(rec.Key, false, func(key, value []byte) bool {
+			if key[0] != 0 {
+				keys = append(keys, append([]byte{}, key...))
+			}
+			return true
+		})
+
+		for _, key := range keys {
+			if s.after(loadStamp(key)) {
+				db.Set(stampKey(key), s.bytes())
+			}
+		}
+
+	default:
+		if s.after(loadStamp(rec.Key)) {
+			db.Set(stampKey(rec.Key), s.bytes())
+		}
+
+		for o, sl := range parseSlots(rec.List) {
+			db.Set(slotKey(rec.Key, o), sl.bytes())
+		}
+	}
+}
+
+// stateLimit is the key after the stamps, the slots are before them
+var stateLimit = []byte("\x00ts;")
+
+// isStateKey is true for stamps and slots, they are copied to replicas
+func isStateKey(key []byte) bool {
+	return bytes.HasPrefix(key, stampPrefix) || bytes.HasPrefix(key, slotPrefix)
+}
+
+// scanState returns stamps and slots after cursor and their values like
+// handleScan, more is 1 if the scan is not finished
+func scanState(cursor []byte) ([][]byte, int64) {
+
+	if len(cursor) == 0 {
+		cursor = slotPrefix
+	}
+
+	return scanKeys(cursor, true, SCAN_LIMIT, stateLimit, isStateKey)
+}
+
+// gcLoop deletes expired stamps and slots
+func gcLoop() {
+	for range time.Tick(STAMP_GC_INTERVAL) {
+		if n := gcStamps(); n > 0 {
+			log.Debug(fmt.Sprintf("%d expired stamps and slots deleted", n))
+		}
+	}
+}
+
+// gcStamps deletes expired stamps, slots on older bases than the key has
+// and expired slots waiting for a newer base. Returns the number of
+// deleted keys
+func gcStamps() int {
+
+	n := gcPrefix(stampPrefix, func(key, value []byte) bool {
+		return parseStamp(value).ts < expiry()
+	})
+
+	n += gcPrefix(slotPrefix, func(key, value []byte) bool {
+		k, _, ok := splitSlotKey(key)
+		sl, valid := parseSlot(value)
+
+		if !ok || !valid {
+			return true
+		}
+
+		cur, b := loadStamp(k).known(), sl.base.known()
+
+		return cur.after(b) || b.after(cur) && sl.ts < expiry()
+	})
+
+	return n
+}
+
+// gcPrefix deletes keys with the prefix by parts, the keys are checked
+// again with mutex locked before deletion
+func gcPrefix(prefix []byte, expired func(key, value []byte) bool) int {
+
+	deleted := 0
+	cursor := prefix
+
+	for {
+		var keys [][]byte
+		var last []byte
+		checked := 0
+
+		// prefix enumeration is not isolated from writes
+		if !canSeek() {
+			mutex.Lock()
+		}
+
+		forEachAfter(cursor, true, func(key, value []byte) bool {
+			if !bytes.HasPrefix(key, prefix) {
+				return false
+			}
+
+			last = append(last[:0], key...)
+
+			if expired(key, value) {
+				keys = append(keys, append([]byte{}, key...))
+			}
+
+			checked++
+			return checked < STAMP_GC_BATCH
+		})
+
+		if canSeek() {
+			mutex.Lock()
+		}
+
+		for _, key := range keys {
+			if value := db.Get(key); value != nil && expired(key, value) {
+				db.Del(key)
+				deleted++
+			}
+		}
+
+		mutex.Unlock()
+
+		if checked < STAMP_GC_BATCH {
+			return deleted
+		}
+
+		cursor = last
+	}
+}
+
+// startPeers replicates to peers while the node is primary
+func startPeers() {
+	if currentRole() == ROLE_PRIMARY {
+		dcPeers.Set(peerAddrs)
+	} else {
+		dcPeers.Set(nil)
+	}
+}
+
+func peerPosKey(o string) []byte {
+	return append(append([]byte{}, peerPosPrefix...), o...)
+}
+
+// loadPeerPos returns the log id and the applied seq of the origin, nil
+// id if the log is unknown
+func loadPeerPos(o string) ([]byte, int64) {
+
+	data := db.Get(peerPosKey(o))
+
+	if len(data) <= 8 {
+		return nil, -1
+	}
+
+	return data[8:], bytesSeq(data)
+}
+
+func savePeerPos(o string, id []byte, seq int64) {
+	db.Set(peerPosKey(o), append(seqBytes(seq), id...))
+}
+
+// peerPos returns the position of the peer stream of the origin
+func peerPos(msg *pb.LCPROTO) *pb.LCPROTO {
+
+	if origin == "" {
+		return badArgs("origin of the node is not set")
+	}
+
+	if atomic.LoadInt32(&readonly) == 1 {
+		return pb.ErrorResponse(pb.ERR_READONLY, "node is replica")
+	}
+
+	id, seq := loadPeerPos(msg.Origin)
+
+	if !bytes.Equal(id, msg.Key) {
+		return &pb.LCPROTO{Ivalue: -1}
+	}
+
+	return &pb.LCPROTO{Ivalue: seq}
+}
+
+// handlePeerLog applies a change of other datacenter. Changes with seq
+// must follow the applied one of the origin, they may have gaps as the
+// peer sends only its own changes. Changes of the node origin are not
+// applied again, except keys of full copy, so the node restored from
+// scratch gets them back. Must be called with mutex locked
+func handlePeerLog(msg *pb.LCPROTO) {
+
+	if origin == "" || msg.Origin == "" || atomic.LoadInt32(&readonly) == 1 {
+		return
+	}
+
+	if msg.Origin == origin && msg.Ivalue > 0 {
+		return
+	}
+
+	if msg.Counter == pb.LOG_SKIP && len(msg.Key) > 0 {
+		savePeerPos(msg.Origin, msg.Key, msg.Ivalue)
+		return
+	}
+
+	if msg.Ivalue > 0 {
+		id, seq := loadPeerPos(msg.Origin)
+
+		if id == nil || msg.Ivalue <= seq {
+			return
+		}
+
+		defer savePeerPos(msg.Origin, id, msg.Ivalue)
+	}
+
+	if msg.Counter != pb.LOG_SKIP {
+		mergeLog(msg)
+	}
+}
+
+// mergeLog applies the change of other datacenter by the rules above.
+// Applied changes are logged with their stamps and slots for replicas of
+// the node
+func mergeLog(msg *pb.LCPROTO) {
+
+	clock.Update(msg.Ts)
+
+	s := stamp{ts: msg.Ts, origin: msg.Origin}
+
+	switch msg.Counter {
+	case pb.LOG_INCBY:
+		if len(msg.List) < 2 {
+			return
+		}
+
+		if sl, ok := parseSlot(msg.List[1]); ok {
+			mergeSlot(msg.Key, msg.Origin, sl)
+		}
+
+	case pb.LOG_DELALL:
+		var keys [][]byte
+
+		db.ForEach(msg.Key, false, func(key []byte, value []byte) bool {
+			if key[0] != 0 {
+				keys = append(keys, append([]byte{}, key...))
+			}
+			return true
+		})
+
+		// newer keys of the node are kept
+		for _, key := range keys {
+			mergeBase(key, nil, s, nil, false)
+		}
+
+	case pb.LOG_SET:
+		mergeBase(msg.Key, msg.Value, s, msg.List, msg.Ivalue == 0)
+
+	case pb.LOG_DEL:
+		mergeBase(msg.Key, nil, s, nil, false)
+	}
+}
+
+// mergeBase applies the value set in other datacenter with the slots it
+// counts. A newer base replaces the value of the node, the slots on the
+// same base are merged. A key of full copy with expired stamp replaces
+// the value if its base value is greater. Must be called with mutex
+// locked
+func mergeBase(key, value []byte, s stamp, list [][]byte, copied bool) {
+
+	cur, sent := loadStamp(key).known(), s.known()
+
+	slots := loadSlots(key)
+	received := parseSlots(list)
+
+	old := db.Get(key)
+	base := withoutSlots(old, slots, cur)
+	changed := false
+
+	switch {
+	case sent.after(cur):
+		base, cur = withoutSlots(value, received, sent), sent
+		changed = true
+
+	case sent != cur:
+		return
+
+	case copied && cur == stamp{}:
+		if v := withoutSlots(value, received, sent); bytes.Compare(v, base) > 0 {
+			base = v
+			changed = true
+		}
+	}
+
+	for o, sl := range received {
+		if sl.base.known() != cur {
+			continue
+		}
+
+		l, ok := slots[o]
+		b := l.base.known()
+
+		if !ok || cur.after(b) || b == cur && sl.ts > l.ts {
+			slots[o] = sl
+			changed = true
+		}
+	}
+
+	if !changed {
+		return
+	}
+
+	rec := &pb.LCPROTO{
+		Key:     key,
+		Value:   withSlots(base, slots, cur),
+		List:    slotList(slots, cur),
+		Counter: pb.LOG_SET,
+		Ts:      s.ts,
+		Origin:  s.origin,
+	}
+
+	applyLog(rec)
+	saveState(rec)
+	appendLog(rec)
+}
+
+// mergeSlot applies the sum of increments of the origin. The slot on the
+// base of the key adds the increments the node has not counted yet, the
+// slot on a newer base waits for it and the slot on an older base is
+// dropped. Must be called with mutex locked
+func mergeSlot(key []byte, o string, sl slot) {
+
+	cur, b := loadStamp(key).known(), sl.base.known()
+
+	if cur.after(b) {
+		return
+	}
+
+	var counted int64
+
+	if l, ok := loadSlot(key, o); ok {
+		switch lb := l.base.known(); {
+		case lb.after(b), lb == b && l.ts >= sl.ts:
+			return
+		case lb == b:
+			counted = l.sum
+		}
+	}
+
+	old := db.Get(key)
+	value := old
+	delta := int64(0)
+
+	if b == cur {
+		delta = sl.sum - counted
+		value = pack.Int2Bytes(pack.Bytes2Int(old) + delta)
+	}
+
+	rec := &pb.LCPROTO{
+		Key:     key,
+		Value:   pack.Int2Bytes(delta),
+		List:    [][]byte{value, sl.bytes()},
+		Counter: pb.LOG_INCBY,
+		Ts:      sl.ts,
+		Origin:  o,
+	}
+
+	applyLog(rec)
+	saveState(rec)
+	appendLog(rec)
+}
+
+// peerBatch returns changes of the node origin for the peer. If the
+// last changes are skipped, the peer position is moved after them
+func peerBatch(list []*pb.LCPROTO) []*pb.LCPROTO {
+
+	var res []*pb.LCPROTO
+
+	for _, rec := range list {
+		if rec.Origin == origin {
+			rec.Peer = true
+			res = append(res, rec)
+		}
+	}
+
+	if last := list[len(list)-1]; last.Origin != origin {
+		res = append(res, &pb.LCPROTO{
+			Code:    pb.LCPROTO_LOG,
+			Counter: pb.LOG_SKIP,
+			Ivalue:  last.Ivalue,
+			Origin:  origin,
+			Peer:    true,
+		})
+	}
+
+	return res
+}
+
+// copyToPeer merges all keys of the node into the peer and returns the
+// seq the log is sent after. Keys are sent with their stamps and slots,
+// so newer keys of the peer are kept and counted increments are not
+// added again
+func (r *replica) copyToPeer(id []byte) (int64, error) {
+
+	_, _, seq, _ := rlog.State()
+
+	log.Info("full copy to peer " + r.addr + ", log " + string(id) + fmt.Sprintf(" at %d", seq))
+
+	var cursor []byte
+
+	for {
+		res := handleScan(&pb.LCPROTO{Key: cursor})
+
+		for i := 0; i+1 < len(res.List); i += 2 {
+			rec := &pb.LCPROTO{
+				Code:    pb.LCPROTO_LOG,
+				Key:     res.List[i],
+				Counter: pb.LOG_SET,
+				Peer:    true,
+			}
+
+			// the value must count the same increments as the slots
+			mutex.Lock()
+			s := loadStamp(rec.Key)
+			rec.Value = db.Get(rec.Key)
+			rec.List = slotList(loadSlots(rec.Key), s.known())
+			mutex.Unlock()
+
+			if len(rec.Value) == 0 {
+				continue
+			}
+
+			// keys set before the node had an origin are sent as the
+			// oldest change of the node
+			if rec.Ts, rec.Origin = s.ts, s.origin; rec.Origin == "" {
+				rec.Ts, rec.Origin = 0, origin
+			}
+
+			if !r.conn.Post(rec) {
+				return 0, connect.ErrNotConnected
+			}
+		}
+
+		if res.Ivalue == 0 {
+			break
+		}
+
+		cursor = res.List[len(res.List)-2]
+
+		if r.stopped() {
+			return 0, errStopped
+		}
+
+		// wait for the peer to apply the part
+		if _, err := r.position(id); err != nil {
+			return 0, err
+		}
+	}
+
+	start := &pb.LCPROTO{
+		Code:    pb.LCPROTO_LOG,
+		Counter: pb.LOG_SKIP,
+		Key:     id,
+		Ivalue:  seq,
+		Origin:  origin,
+		Peer:    true,
+	}
+
+	if !r.conn.Post(start) {
+		return 0, connect.ErrNotConnected
+	}
+
+	return seq, nil
+}
@@ -0,0 +1,248 @@
+package engine
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lj-team/go-generic/db/ldb"
+	"github.com/lj-team/go-generic/encode/pack"
+	"github.com/lj-team/lcluster/pb"
+)
+
+func TestPeerMerge(t *testing.T) {
+	ldb.Open("test=1 default=1")
+
+	origin = "dc1"
+	defer func() { origin = "" }()
+
+	key := []byte{2, 'd', 'c'}
+
+	peer := func(value []byte, op int32, ts uint64, from string) {
+		handleLog(&pb.LCPROTO{Key: key, Value: value, Counter: op, Ts: ts, Origin: from, Peer: true})
+	}
+
+	get := func() string {
+		return string(ldb.Get(key))
+	}
+
+	mutex.Lock()
+	repl.Log(key, []byte("local"), pb.LOG_SET)
+	ldb.Set(key, []byte("local"))
+	mutex.Unlock()
+
+	ts := loadStamp(key).ts
+
+	peer([]byte("old"), pb.LOG_SET, ts-1, "dc2")
+	if get() != "local" {
+		t.Fatal("older change must be ignored")
+	}
+
+	handleLog(&pb.LCPROTO{Key: key, Value: []byte("own"), Counter: pb.LOG_SET, Ts: ts + 1, Origin: "dc1", Ivalue: 1, Peer: true})
+	if get() != "local" {
+		t.Fatal("change of the node origin must be ignored")
+	}
+
+	peer([]byte("new"), pb.LOG_SET, ts+1, "dc2")
+	if get() != "new" || loadStamp(key) != (stamp{ts + 1, "dc2"}) {
+		t.Fatal("newer change must be applied")
+	}
+
+	if clock.Now() <= ts+1 {
+		t.Fatal("clock must run ahead of received changes")
+	}
+
+	peer(nil, pb.LOG_DEL, ts+2, "dc2")
+	peer([]byte("old"), pb.LOG_SET, ts+1, "dc3")
+	if ldb.Has(key) {
+		t.Fatal("deleted key must not be restored by older change")
+	}
+
+	inc := func(sum int64, from string) {
+		sl := slot{ts: clock.Now(), sum: sum, base: stamp{ts + 2, "dc2"}}
+		handleLog(&pb.LCPROTO{Key: key, List: [][]byte{nil, sl.bytes()}, Counter: pb.LOG_INCBY, Ts: sl.ts, Origin: from, Peer: true})
+	}
+
+	inc(2, "dc2")
+	inc(3, "dc3")
+	if pack.Bytes2Int(ldb.Get(key)) != 5 {
+		t.Fatal("increments of datacenters must be summed")
+	}
+
+	// sequenced changes need the position of the origin log
+	// keys set before the peer had an origin are copied with zero stamp
+	other := []byte{2, 'd', 'o'}
+	handleLog(&pb.LCPROTO{Key: other, Value: []byte("copy"), Counter: pb.LOG_SET, Origin: "dc2", Peer: true})
+	if string(ldb.Get(other)) != "copy" {
+		t.Fatal("unstamped key of the peer must be applied")
+	}
+
+	peer2 := func(seq int64, value string) {
+		handleLog(&pb.LCPROTO{Key: key, Value: []byte(value), Counter: pb.LOG_SET, Ts: clock.Now(), Origin: "dc2", Ivalue: seq, Peer: true})
+	}
+
+	peer2(1, "unknown")
+	if get() == "unknown" {
+		t.Fatal("change of unknown log must be skipped")
+	}
+
+	handleLog(&pb.LCPROTO{Key: []byte("log"), Counter: pb.LOG_SKIP, Ivalue: 5, Origin: "dc2", Peer: true})
+	peer2(5, "applied")
+	peer2(7, "gap")
+
+	if get() != "gap" {
+		t.Fatal("change after the position expected")
+	}
+
+	if res := handleReplPos(&pb.LCPROTO{Key: []byte("log"), Origin: "dc2", Peer: true}); res.Ivalue != 7 {
+		t.Fatal("peer position expected", res.Ivalue)
+	}
+}
+
+func TestCounterMerge(t *testing.T) {
+	ldb.Open("test=1 default=1")
+
+	origin = "dc1"
+	defer func() { origin = "" }()
+
+	key := []byte{2, 'c', 'm'}
+
+	get := func() int64 {
+		return pack.Bytes2Int(ldb.Get(key))
+	}
+
+	send := func(rec *pb.LCPROTO) {
+		rec.Key, rec.Peer = key, true
+		handleLog(rec)
+	}
+
+	set := func(value int64, s stamp, list [][]byte) {
+		send(&pb.LCPROTO{Value: pack.Int2Bytes(value), List: list, Counter: pb.LOG_SET, Ts: s.ts, Origin: s.origin})
+	}
+
+	inc := func(from string, sum int64, base stamp) *pb.LCPROTO {
+		sl := slot{ts: clock.Now(), sum: sum, base: base}
+		return &pb.LCPROTO{List: [][]byte{nil, sl.bytes()}, Counter: pb.LOG_INCBY, Ts: sl.ts, Origin: from}
+	}
+
+	base := stamp{clock.Now(), "dc2"}
+	set(10, base, nil)
+
+	handleCInc(&pb.LCPROTO{Key: key, Ivalue: 1})
+
+	if own, _ := loadSlot(key, "dc1"); own.sum != 1 || own.base != base || loadStamp(key) != base {
+		t.Fatal("increment must be counted in the slot of the node on the base", own)
+	}
+
+	rec := inc("dc3", 5, base)
+	send(rec)
+	send(rec)
+	if get() != 16 {
+		t.Fatal("slot must be counted once", get())
+	}
+
+	send(inc("dc3", 7, base))
+	send(inc("dc2", 100, stamp{base.ts - 1, "dc2"}))
+	if get() != 18 {
+		t.Fatal("increments after the counted ones expected, older base must be dropped", get())
+	}
+
+	next := stamp{clock.Now(), "dc3"}
+
+	send(inc("dc2", 4, next))
+	if get() != 18 {
+		t.Fatal("slot must wait for its base")
+	}
+
+	set(1, next, nil)
+	if get() != 5 {
+		t.Fatal("newer base must reset the slots", get())
+	}
+
+	// full copies count increments once
+	mutex.Lock()
+	list := slotList(loadSlots(key), next)
+	mutex.Unlock()
+
+	set(5, next, list)
+	if get() != 5 {
+		t.Fatal("counted slots must not be added again", get())
+	}
+
+	sl := slot{ts: clock.Now(), sum: 6, base: next}
+	set(7, next, [][]byte{[]byte("dc2"), sl.bytes()})
+	if get() != 7 {
+		t.Fatal("newer slot of the copy must be counted", get())
+	}
+}
+
+func TestStampExpiry(t *testing.T) {
+	ldb.Open("test=1 default=1")
+
+	origin = "dc1"
+	defer func() { origin = "" }()
+	defer func() { stampRetention = DefaultStampRetention }()
+
+	key := []byte{2, 'e', 'x'}
+
+	get := func() int64 {
+		return pack.Bytes2Int(ldb.Get(key))
+	}
+
+	send := func(rec *pb.LCPROTO) {
+		rec.Key, rec.Peer = key, true
+		handleLog(rec)
+	}
+
+	inc := func(sum int64, base stamp) {
+		sl := slot{ts: clock.Now(), sum: sum, base: base}
+		send(&pb.LCPROTO{List: [][]byte{nil, sl.bytes()}, Counter: pb.LOG_INCBY, Ts: sl.ts, Origin: "dc2"})
+	}
+
+	base := stamp{clock.Now(), "dc2"}
+	send(&pb.LCPROTO{Value: pack.Int2Bytes(1), Counter: pb.LOG_SET, Ts: base.ts, Origin: base.origin})
+	inc(3, base)
+
+	old := slot{ts: base.ts - 1, sum: 9, base: stamp{base.ts - 2, "dc3"}}
+	ldb.Set(slotKey(key, "dc3"), old.bytes())
+
+	if n := gcStamps(); n != 1 || ldb.Has(slotKey(key, "dc3")) {
+		t.Fatal("slot on older base must be deleted", n)
+	}
+
+	stampRetention = time.Millisecond
+	time.Sleep(5 * time.Millisecond)
+
+	if n := gcStamps(); n != 1 || ldb.Has(stampKey(key)) || get() != 4 {
+		t.Fatal("expired stamp must be deleted", n)
+	}
+
+	handleLog(&pb.LCPROTO{Key: []byte("log"), Counter: pb.LOG_SKIP, Ivalue: 1, Origin: "dc2", Peer: true})
+	send(&pb.LCPROTO{Value: []byte("old"), Counter: pb.LOG_SET, Ts: base.ts + 1, Origin: "dc2", Ivalue: 2})
+	if get() != 4 {
+		t.Fatal("expired change must be ignored")
+	}
+
+	inc(5, base)
+	if get() != 6 {
+		t.Fatal("slot on expired base must be counted", get())
+	}
+
+	send(&pb.LCPROTO{Value: pack.Int2Bytes(10), Counter: pb.LOG_SET, Ts: base.ts, Origin: base.origin})
+	if get() != 15 {
+		t.Fatal("full copy with expired stamp must keep the greater base value", get())
+	}
+}
+
+func TestClock(t *testing.T) {
+	c := &hlClock{}
+
+	prev := c.Now()
+
+	for i := 0; i < 1000; i++ {
+		ts := c.Now()
+		if ts <= prev {
+			t.Fatal("clock must be monotonic")
+		}
+		prev = ts
+	}
+}
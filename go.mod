@@ -5,4 +5,5 @@ go 1.13
 require (
 	github.com/golang/protobuf v1.3.2
 	github.com/lj-team/go-generic v1.3.3
+	github.com/syndtr/goleveldb v1.0.0
 )
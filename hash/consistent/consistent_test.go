@@ -17,3 +17,53 @@ func TestConsistent(t *testing.T) {
 		}
 	}
 }
+
+func TestRing(t *testing.T) {
+
+	var names []string
+	var nodes []Node
+
+	for i := 0; i < 10; i++ {
+		names = append(names, "10.0.0."+strconv.Itoa(i)+":5101")
+		nodes = append(nodes, Node{Name: names[i]})
+	}
+
+	ring := NewRing(nodes, 0)
+
+	counts := make([]int, len(nodes))
+	for i := 0; i < 100000; i++ {
+		counts[ring.Get([]byte(strconv.Itoa(i)))]++
+	}
+
+	for i, c := range counts {
+		if c < 7000 || c > 13000 {
+			t.Fatalf("bad distribution: node %d has %d keys", i, c)
+		}
+	}
+
+	grown := NewRing(append(nodes, Node{Name: "10.0.0.10:5101"}), 0)
+
+	moved := 0
+	for i := 0; i < 100000; i++ {
+		key := []byte(strconv.Itoa(i))
+		if ring.Get(key) != grown.Get(key) {
+			moved++
+		}
+	}
+
+	if moved > 15000 {
+		t.Fatalf("too many keys moved by ring: %d", moved)
+	}
+
+	heavy := []Node{{Name: "a", Weight: 3}, {Name: "b", Weight: 1}}
+	ring = NewRing(heavy, 0)
+
+	counts = make([]int, 2)
+	for i := 0; i < 100000; i++ {
+		counts[ring.Get([]byte(strconv.Itoa(i)))]++
+	}
+
+	if counts[0] < counts[1]*2 {
+		t.Fatal("weight is ignored")
+	}
+}
@@ -0,0 +1,93 @@
+package consistent
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"hash/crc32"
+	"sort"
+	"strconv"
+)
+
+// DefaultVNodes is the number of virtual nodes per weight unit
+const DefaultVNodes = 160
+
+// Node of the ring
+type Node struct {
+	Name   string // unique name, usually address
+	Weight int    // 0 - 1
+}
+
+// Ring is a consistent hash ring with virtual nodes. Adding or removing a
+// node moves only keys of its virtual nodes
+type Ring struct {
+	num    int
+	points []uint32
+	owners []int
+}
+
+func NewRing(nodes []Node, vnodes int) *Ring {
+
+	if vnodes < 1 {
+		vnodes = DefaultVNodes
+	}
+
+	r := &Ring{num: len(nodes)}
+
+	type point struct {
+		hash  uint32
+		owner int
+	}
+
+	var list []point
+
+	for i, node := range nodes {
+		weight := node.Weight
+		if weight < 1 {
+			weight = 1
+		}
+
+		for j := 0; j < vnodes*weight; j++ {
+			sum := md5.Sum([]byte(node.Name + "#" + strconv.Itoa(j)))
+			list = append(list, point{hash: binary.BigEndian.Uint32(sum[:4]), owner: i})
+		}
+	}
+
+	// equal hashes are ordered by owner to make the ring independent of
+	// the order of nodes in the list
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].hash == list[j].hash {
+			return nodes[list[i].owner].Name < nodes[list[j].owner].Name
+		}
+		return list[i].hash < list[j].hash
+	})
+
+	r.points = make([]uint32, len(list))
+	r.owners = make([]int, len(list))
+
+	for i, p := range list {
+		r.points[i] = p.hash
+		r.owners[i] = p.owner
+	}
+
+	return r
+}
+
+// Get returns index of the node owning the key
+func (r *Ring) Get(key []byte) int {
+	if len(r.points) == 0 {
+		return 0
+	}
+
+	v := crc32.ChecksumIEEE(key)
+
+	i := sort.Search(len(r.points), func(i int) bool { return r.points[i] >= v })
+	if i == len(r.points) {
+		i = 0
+	}
+
+	return r.owners[i]
+}
+
+func (r *Ring) Next(num int) int {
+	return (num + 1) % r.num
+}
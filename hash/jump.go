@@ -0,0 +1,39 @@
+package hash
+
+import (
+	"hash/fnv"
+)
+
+// Jump is jump consistent hash (Lamping, Veach). It needs no memory,
+// but nodes may be added or removed at the end of the list only
+type Jump struct {
+	num int
+}
+
+func NewJump(nodes int) *Jump {
+	return &Jump{num: nodes}
+}
+
+func (j *Jump) Get(key []byte) int {
+	h := fnv.New64a()
+	h.Write(key)
+	k := h.Sum64()
+
+	b, i := int64(-1), int64(0)
+
+	for i < int64(j.num) {
+		b = i
+		k = k*2862933555777941757 + 1
+		i = int64(float64(b+1) * (float64(int64(1)<<31) / float64((k>>33)+1)))
+	}
+
+	if b < 0 {
+		return 0
+	}
+
+	return int(b)
+}
+
+func (j *Jump) Next(num int) int {
+	return (num + 1) % j.num
+}
@@ -0,0 +1,88 @@
+package hash
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/lj-team/lcluster/hash/consistent"
+)
+
+// Placement maps keys to indexes of the nodes
+type Placement interface {
+	Get(key []byte) int
+	Next(num int) int // node used if num is not available
+}
+
+// placement types
+const (
+	RANGE      = "range"      // equal crc32 ranges, default
+	RING       = "ring"       // consistent hash ring with virtual nodes
+	RENDEZVOUS = "rendezvous" // highest random weight
+	JUMP       = "jump"       // jump consistent hash, nodes are added and removed at the end
+)
+
+// Node of the cluster
+type Node struct {
+	Name   string // unique name, usually address
+	Weight int    // 0 - 1, ignored by range and jump
+}
+
+var ErrUnknownPlacement = errors.New("unknown placement")
+
+// Valid checks placement type, empty string is RANGE
+func Valid(kind string) bool {
+	switch kind {
+	case "", RANGE, RING, RENDEZVOUS, JUMP:
+		return true
+	}
+	return false
+}
+
+// New makes placement of the kind for nodes, vnodes is used by RING only
+func New(kind string, nodes []Node, vnodes int) (Placement, error) {
+
+	switch kind {
+	case "", RANGE:
+		return consistent.New(len(nodes)), nil
+
+	case RING:
+		list := make([]consistent.Node, len(nodes))
+		for i, n := range nodes {
+			list[i] = consistent.Node{Name: n.Name, Weight: n.Weight}
+		}
+		return consistent.NewRing(list, vnodes), nil
+
+	case RENDEZVOUS:
+		return NewRendezvous(nodes), nil
+
+	case JUMP:
+		return NewJump(len(nodes)), nil
+	}
+
+	return nil, ErrUnknownPlacement
+}
+
+// DefaultSamples is the number of keys checked by Moved
+const DefaultSamples = 100000
+
+// Moved returns fraction of keys which change the node between two
+// topologies. Nodes are compared by names, so they may be reordered.
+// The fraction is estimated by samples generated keys
+func Moved(old Placement, oldNodes []string, new Placement, newNodes []string, samples int) float64 {
+
+	if samples < 1 {
+		samples = DefaultSamples
+	}
+
+	moved := 0
+
+	for i := 0; i < samples; i++ {
+		key := []byte("key:" + strconv.Itoa(i))
+
+		if oldNodes[old.Get(key)] != newNodes[new.Get(key)] {
+			moved++
+		}
+	}
+
+	return float64(moved) / float64(samples)
+}
@@ -0,0 +1,65 @@
+package hash
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestPlacement(t *testing.T) {
+
+	var names []string
+	var nodes []Node
+
+	for i := 0; i < 11; i++ {
+		names = append(names, "10.0.0."+strconv.Itoa(i)+":5101")
+		nodes = append(nodes, Node{Name: names[i]})
+	}
+
+	for _, kind := range []string{RANGE, RING, RENDEZVOUS, JUMP} {
+
+		small, err := New(kind, nodes[:10], 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		counts := make([]int, 10)
+		for i := 0; i < 100000; i++ {
+			counts[small.Get([]byte(strconv.Itoa(i)))]++
+		}
+
+		for i, c := range counts {
+			if c < 7000 || c > 13000 {
+				t.Fatalf("%s: bad distribution: node %d has %d keys", kind, i, c)
+			}
+		}
+
+		big, _ := New(kind, nodes, 0)
+
+		m := Moved(small, names[:10], big, names, 0)
+
+		if kind == RANGE {
+			if m < 0.4 {
+				t.Fatalf("range must move many keys: %f", m)
+			}
+		} else if m > 0.15 {
+			t.Fatalf("%s: too many keys moved: %f", kind, m)
+		}
+	}
+
+	if _, err := New("md5", nodes, 0); err != ErrUnknownPlacement {
+		t.Fatal("unknown placement must be rejected")
+	}
+}
+
+func TestRendezvousWeight(t *testing.T) {
+	r := NewRendezvous([]Node{{Name: "a", Weight: 3}, {Name: "b", Weight: 1}})
+
+	counts := make([]int, 2)
+	for i := 0; i < 100000; i++ {
+		counts[r.Get([]byte(strconv.Itoa(i)))]++
+	}
+
+	if counts[0] < counts[1]*2 {
+		t.Fatal("weight is ignored")
+	}
+}
@@ -0,0 +1,69 @@
+package hash
+
+import (
+	"hash/fnv"
+	"math"
+)
+
+// Rendezvous is highest random weight hashing: the key goes to the node
+// with the best score, so only keys of added or removed node move
+type Rendezvous struct {
+	seeds   []uint64
+	weights []float64
+}
+
+func NewRendezvous(nodes []Node) *Rendezvous {
+	r := &Rendezvous{
+		seeds:   make([]uint64, len(nodes)),
+		weights: make([]float64, len(nodes)),
+	}
+
+	for i, n := range nodes {
+		h := fnv.New64a()
+		h.Write([]byte(n.Name))
+		r.seeds[i] = h.Sum64()
+
+		r.weights[i] = 1
+		if n.Weight > 1 {
+			r.weights[i] = float64(n.Weight)
+		}
+	}
+
+	return r
+}
+
+// mix64 is the finalizer of murmur3
+func mix64(x uint64) uint64 {
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
+
+func (r *Rendezvous) Get(key []byte) int {
+	h := fnv.New64a()
+	h.Write(key)
+	kh := h.Sum64()
+
+	best := 0
+	bestScore := math.Inf(-1)
+
+	for i, seed := range r.seeds {
+		// uniform value in (0, 1)
+		u := (float64(mix64(seed^kh)>>11) + 0.5) / (1 << 53)
+		score := r.weights[i] / -math.Log(u)
+
+		if score > bestScore {
+			best = i
+			bestScore = score
+		}
+	}
+
+	return best
+}
+
+func (r *Rendezvous) Next(num int) int {
+	return (num + 1) % len(r.seeds)
+}
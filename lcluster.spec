@@ -30,6 +30,10 @@ cd ../lproxy
 go build -v -a -ldflags "-B 0x$(head -c20 /dev/urandom|od -An -tx1|tr -d ' \n')" -tags 'netgo'
 cd ../lsize
 go build -v -a -ldflags "-B 0x$(head -c20 /dev/urandom|od -An -tx1|tr -d ' \n')" -tags 'netgo'
+cd ../lreshard
+go build -v -a -ldflags "-B 0x$(head -c20 /dev/urandom|od -An -tx1|tr -d ' \n')" -tags 'netgo'
+cd ../lctl
+go build -v -a -ldflags "-B 0x$(head -c20 /dev/urandom|od -An -tx1|tr -d ' \n')" -tags 'netgo'
 cd ..
 
 %install
@@ -44,6 +48,8 @@ install -d  %{buildroot}/var/log/lcluster
 install -p -m 0755 ./lnode/lnode %{buildroot}%{_bindir}/lnode
 install -p -m 0755 ./lproxy/lproxy %{buildroot}%{_bindir}/lproxy
 install -p -m 0755 ./lsize/lsize %{buildroot}%{_bindir}/lsize
+install -p -m 0755 ./lreshard/lreshard %{buildroot}%{_bindir}/lreshard
+install -p -m 0755 ./lctl/lctl %{buildroot}%{_bindir}/lctl
 
 install -p -m 0755 ./lnode/config.json.example %{buildroot}%{_sysconfdir}/lcluster/node.json.example
 install -p -m 0755 ./lproxy/config.json.example %{buildroot}%{_sysconfdir}/lcluster/proxy.json.example
@@ -56,6 +62,8 @@ install -p -m 0755 ./lproxy/init.d %{buildroot}%{_sysconfdir}/init.d/lproxy.exam
 %attr(0755,root,root) %{_bindir}/lnode
 %attr(0755,root,root) %{_bindir}/lproxy
 %attr(0755,root,root) %{_bindir}/lsize
+%attr(0755,root,root) %{_bindir}/lreshard
+%attr(0755,root,root) %{_bindir}/lctl
 %attr(0755,root,root) %{_sysconfdir}/lcluster/node.json.example
 %attr(0755,root,root) %{_sysconfdir}/lcluster/proxy.json.example
 %attr(0755,root,root) %{_sysconfdir}/init.d/lnode.example
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/lj-team/lcluster/connect"
+	"github.com/lj-team/lcluster/pb"
+)
+
+const (
+	CHECK_PART   = 10000 // keys per part of the first pass
+	CHECK_LEAF   = 100   // keys of the differing part compared one by one
+	CHECK_FANOUT = 16    // parts the differing part is split into
+	REPAIR_BATCH = 1000  // keys per repair request
+)
+
+// checker compares digests of key ranges of the primary and the replica
+// and splits differing ranges until they are small enough to compare
+// keys. Changes not applied by the replica yet are reported as differences
+type checker struct {
+	primary *connect.Conn
+	replica *connect.Conn
+
+	missing   int // keys of the primary the replica has not
+	extra     int // keys of the replica the primary has not
+	different int
+
+	keys [][]byte
+}
+
+func check(args []string) error {
+
+	c := &checker{
+		primary: connect.NewConnWithOptions(args[0], opts),
+		replica: connect.NewConnWithOptions(args[1], opts),
+	}
+
+	defer c.primary.Close()
+	defer c.replica.Close()
+
+	if err := c.walk(nil, nil, CHECK_PART); err != nil {
+		return err
+	}
+
+	fmt.Printf("missing %d, extra %d, different %d\n", c.missing, c.extra, c.different)
+
+	if !*doRepair || len(c.keys) == 0 {
+		return nil
+	}
+
+	repaired := int64(0)
+
+	for i := 0; i < len(c.keys); i += REPAIR_BATCH {
+		batch := c.keys[i:]
+		if len(batch) > REPAIR_BATCH {
+			batch = batch[:REPAIR_BATCH]
+		}
+
+		err := call(func(ctx context.Context) error {
+			n, e := c.primary.RepairContext(ctx, batch)
+			repaired += n
+			return e
+		})
+
+		if err != nil {
+			return err
+		}
+	}
+
+	fmt.Printf("repaired %d\n", repaired)
+
+	return nil
+}
+
+// walk compares parts of per keys of the primary from start before end
+func (c *checker) walk(start, end []byte, per int64) error {
+
+	for {
+		var parts []connect.DigestPart
+		var next []byte
+
+		err := call(func(ctx context.Context) (e error) {
+			parts, next, e = c.primary.DigestContext(ctx, start, end, per)
+			return
+		})
+
+		if err != nil {
+			return err
+		}
+
+		last := end
+		if next != nil {
+			last = next
+		}
+
+		// the first part of the replica includes its keys before the
+		// first key of the primary
+		starts := [][]byte{start}
+		for i := 1; i < len(parts); i++ {
+			starts = append(starts, parts[i].First)
+		}
+
+		var digests []pb.Digest
+
+		err = call(func(ctx context.Context) (e error) {
+			digests, e = c.replica.DigestPartsContext(ctx, starts, last)
+			return
+		})
+
+		if err != nil {
+			return err
+		}
+
+		for i := range starts {
+			var digest pb.Digest
+			if i < len(parts) {
+				digest = parts[i].Digest
+			}
+
+			if digest == digests[i] {
+				continue
+			}
+
+			partEnd := last
+			if i+1 < len(starts) {
+				partEnd = starts[i+1]
+			}
+
+			if digest.Count <= CHECK_LEAF {
+				err = c.compare(starts[i], partEnd)
+			} else {
+				err = c.walk(starts[i], partEnd, digest.Count/CHECK_FANOUT+1)
+			}
+
+			if err != nil {
+				return err
+			}
+		}
+
+		if next == nil {
+			return nil
+		}
+
+		start = next
+	}
+}
+
+// compare compares keys from start before end one by one
+func (c *checker) compare(start, end []byte) error {
+
+	primary, err := c.list(c.primary, start, end)
+	if err != nil {
+		return err
+	}
+
+	replica, err := c.list(c.replica, start, end)
+	if err != nil {
+		return err
+	}
+
+	for key, digest := range primary {
+		if d, ok := replica[key]; !ok {
+			c.missing++
+		} else if d != digest {
+			c.different++
+		} else {
+			continue
+		}
+
+		c.keys = append(c.keys, []byte(key))
+	}
+
+	for key := range replica {
+		if _, ok := primary[key]; !ok {
+			c.extra++
+			c.keys = append(c.keys, []byte(key))
+		}
+	}
+
+	return nil
+}
+
+// list returns digests of keys of the node from start before end
+func (c *checker) list(con *connect.Conn, start, end []byte) (map[string]pb.Digest, error) {
+
+	res := map[string]pb.Digest{}
+
+	for {
+		var parts []connect.DigestPart
+		var next []byte
+
+		err := call(func(ctx context.Context) (e error) {
+			parts, next, e = con.DigestContext(ctx, start, end, 1)
+			return
+		})
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, p := range parts {
+			res[string(p.First)] = p.Digest
+		}
+
+		if next == nil {
+			return res, nil
+		}
+
+		start = next
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/lj-team/lcluster/connect"
+)
+
+func info(args []string) error {
+
+	con := connect.NewConnWithOptions(args[0], opts)
+	defer con.Close()
+
+	var i *connect.Info
+
+	err := call(func(ctx context.Context) (e error) {
+		i, e = con.InfoContext(ctx)
+		return
+	})
+
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		data, _ := json.MarshalIndent(i, "", "  ")
+		fmt.Println(string(data))
+	} else {
+		printInfo(i)
+	}
+
+	if *maxLag <= 0 {
+		return nil
+	}
+
+	if err = checkLag("replica", i.Replicas); err != nil {
+		return err
+	}
+
+	return checkLag("peer", i.Peers)
+}
+
+// checkLag fails if a node is not streaming or is behind by more than
+// max-lag changes
+func checkLag(kind string, list []connect.ReplicaInfo) error {
+
+	for _, r := range list {
+		if r.State != "streaming" {
+			return fmt.Errorf("%s %s is %s", kind, r.Addr, r.State)
+		}
+
+		if r.Pending > *maxLag {
+			return fmt.Errorf("%s %s is behind by %d changes", kind, r.Addr, r.Pending)
+		}
+	}
+
+	return nil
+}
+
+func printInfo(i *connect.Info) {
+
+	fmt.Printf("role %s, log %s, seq %d-%d\n", i.Role, i.Log, i.First, i.Last)
+
+	if i.Origin != "" {
+		fmt.Printf("origin %s\n", i.Origin)
+	}
+
+	if i.Primary != "" {
+		state := "consistent"
+		if i.Syncing {
+			state = "syncing"
+		}
+		fmt.Printf("applied %d of log %s, %s\n", i.Applied, i.Primary, state)
+	}
+
+	printNodes("replica", i.Replicas)
+	printNodes("peer", i.Peers)
+}
+
+func printNodes(kind string, list []connect.ReplicaInfo) {
+
+	for _, r := range list {
+		fmt.Printf("%s %s %s, sent %d, acked %d, pending %d (%d bytes)", kind, r.Addr, r.State, r.Sent, r.Acked, r.Pending, r.PendingBytes)
+
+		if r.LastAck > 0 {
+			fmt.Printf(", last ack %s ago", time.Since(time.Unix(r.LastAck, 0)).Truncate(time.Second))
+		}
+
+		if r.Error != "" {
+			fmt.Printf(", error: %s", r.Error)
+		}
+
+		fmt.Println()
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/lj-team/lcluster/auth"
+	"github.com/lj-team/lcluster/connect"
+)
+
+var (
+	authName = flag.String("auth-name", "", "auth token name")
+	authKey  = flag.String("auth-secret", "", "auth token secret")
+	timeout  = flag.Duration("timeout", connect.DefaultTimeout, "request timeout")
+	doRepair = flag.Bool("repair", false, "check: repair differing keys")
+	asJSON   = flag.Bool("json", false, "info: print json")
+	maxLag   = flag.Int64("max-lag", 0, "info: fail if a replica or a peer is not streaming or is behind by more changes, 0 - disabled")
+)
+
+type command struct {
+	args int // required arguments
+	run  func(args []string) error
+}
+
+var commands = map[string]command{
+	"role":  {1, role},
+	"check": {2, check},
+	"info":  {1, info},
+}
+
+var opts = &connect.Options{}
+
+func usage() {
+	fmt.Println("use: lctl [-auth-name name -auth-secret secret] [-repair] [-json] [-max-lag n] <command> [args]")
+	fmt.Println()
+	fmt.Println("commands:")
+	fmt.Println("  role host:port [primary|replica]  show or switch role of the node")
+	fmt.Println("  check primary replica             compare keys of the replica with the primary")
+	fmt.Println("  info host:port                    show replication state of the node")
+	os.Exit(1)
+}
+
+func main() {
+
+	flag.Parse()
+
+	cmd, ok := commands[flag.Arg(0)]
+	if !ok || flag.NArg()-1 < cmd.args {
+		usage()
+	}
+
+	if *authName != "" || *authKey != "" {
+		opts.Auth = &auth.Credentials{Name: *authName, Secret: *authKey}
+	}
+
+	if err := cmd.run(flag.Args()[1:]); err != nil {
+		fmt.Println(flag.Arg(0)+":", err)
+		os.Exit(1)
+	}
+}
+
+// call makes the request with timeout
+func call(f func(ctx context.Context) error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	return f(ctx)
+}
+
+func role(args []string) error {
+
+	var switchTo string
+
+	if len(args) > 1 {
+		switchTo = args[1]
+	}
+
+	con := connect.NewConnWithOptions(args[0], opts)
+	defer con.Close()
+
+	var r string
+
+	err := call(func(ctx context.Context) (e error) {
+		r, e = con.RoleContext(ctx, switchTo)
+		return
+	})
+
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(r)
+
+	return nil
+}
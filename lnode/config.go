@@ -5,18 +5,40 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"time"
 
 	"github.com/lj-team/go-generic/daemon"
 	"github.com/lj-team/go-generic/db/ldb"
 	"github.com/lj-team/go-generic/log"
+	"github.com/lj-team/lcluster/auth"
+	"github.com/lj-team/lcluster/connect"
+	"github.com/lj-team/lcluster/server"
+	"github.com/lj-team/lcluster/tlsconf"
 )
 
 type Config struct {
-	Database ldb.Config    `json:"database"`
-	Daemon   daemon.Config `json:"daemon"`
-	Log      log.Config    `json:"log"`
-	Server   string        `json:"addr"`
-	Replica  string        `json:"replica"`
+	Database    ldb.Config       `json:"database"`
+	Daemon      daemon.Config    `json:"daemon"`
+	Log         log.Config       `json:"log"`
+	Server      string           `json:"addr"`
+	Role        string           `json:"role"` // primary or replica
+	Replica     string           `json:"replica"`
+	Replicas    []string         `json:"replicas"`
+	Shutdown    int              `json:"shutdown_timeout"`
+	TLS         tlsconf.Config   `json:"tls"`
+	ReplicaTLS  tlsconf.Config   `json:"replica_tls"`
+	Auth        auth.Config      `json:"auth"`
+	ReplicaAuth auth.Credentials `json:"replica_auth"`
+	MaxFrame    int              `json:"max_frame_size"`
+	Limits      server.Limits    `json:"limits"`
+	Topology    string           `json:"topology"`         // file with initial cluster topology
+	ReplicaLog  int64            `json:"replica_log_size"` // changes kept for replica
+	SyncAcks    int              `json:"sync_replicas"`    // replicas to confirm C_* writes with sync flag
+	SyncWait    int              `json:"sync_timeout"`     // ms
+	ReadRepair  float64          `json:"read_repair"`      // fraction of reads checked on replicas
+	Origin      string           `json:"origin"`           // datacenter of the node
+	Peers       []string         `json:"peers"`            // primaries of other datacenters
+	Retention   int              `json:"stamp_retention"`  // s, changes of peers must arrive within it
 }
 
 var _config *Config
@@ -31,7 +53,7 @@ func LoadConfig(filename string) *Config {
 		os.Exit(1)
 	}
 
-	var _con Config
+	_con := Config{Shutdown: 30}
 
 	if err = json.Unmarshal(data, &_con); err != nil {
 		fmt.Println(err)
@@ -50,3 +72,40 @@ func SetConfig(conf *Config) {
 func GetConfig() *Config {
 	return _config
 }
+
+func (c *Config) ShutdownTimeout() time.Duration {
+	return time.Duration(c.Shutdown) * time.Second
+}
+
+func (c *Config) StampRetention() time.Duration {
+	return time.Duration(c.Retention) * time.Second
+}
+
+func (c *Config) SyncTimeout() time.Duration {
+	return time.Duration(c.SyncWait) * time.Millisecond
+}
+
+// LoadTopology reads the topology file, nil if it is not set
+func (c *Config) LoadTopology() (*connect.Topology, error) {
+
+	if c.Topology == "" {
+		return nil, nil
+	}
+
+	data, err := ioutil.ReadFile(c.Topology)
+	if err != nil {
+		return nil, err
+	}
+
+	var t connect.Topology
+
+	if err = json.Unmarshal(data, &t); err != nil {
+		return nil, err
+	}
+
+	if err = t.Check(); err != nil {
+		return nil, err
+	}
+
+	return &t, nil
+}
@@ -1,12 +1,17 @@
 package main
 
 import (
+	"context"
 	"flag"
+	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/lj-team/go-generic/daemon"
-	"github.com/lj-team/go-generic/db/ldb"
 	"github.com/lj-team/go-generic/log"
 	"github.com/lj-team/lcluster/engine"
+	"github.com/lj-team/lcluster/server"
+	"github.com/lj-team/lcluster/store"
 )
 
 func main() {
@@ -33,7 +38,75 @@ func main() {
 		log.Info("start application")
 	}
 
-	ldb.Init(&cfg.Database)
+	opts := &engine.Options{
+		Addr:        cfg.Server,
+		Role:        cfg.Role,
+		Replica:     cfg.Replica,
+		Replicas:    cfg.Replicas,
+		Auth:        &cfg.Auth,
+		ReplicaAuth: &cfg.ReplicaAuth,
 
-	engine.Start(cfg.Server, cfg.Replica)
+		MaxFrameSize:   cfg.MaxFrame,
+		Limits:         cfg.Limits,
+		LogSize:        cfg.ReplicaLog,
+		SyncReplicas:   cfg.SyncAcks,
+		SyncTimeout:    cfg.SyncTimeout(),
+		ReadRepair:     cfg.ReadRepair,
+		Origin:         cfg.Origin,
+		Peers:          cfg.Peers,
+		StampRetention: cfg.StampRetention(),
+	}
+
+	var err error
+
+	if opts.TLS, err = cfg.TLS.Server(); err != nil {
+		log.Fatal("tls: " + err.Error())
+	}
+
+	if opts.ReplicaTLS, err = cfg.ReplicaTLS.Client(); err != nil {
+		log.Fatal("replica tls: " + err.Error())
+	}
+
+	if opts.Topology, err = cfg.LoadTopology(); err != nil {
+		log.Fatal("topology: " + err.Error())
+	}
+
+	db, err := store.Open(&cfg.Database)
+	if err != nil {
+		log.Fatal("database: " + err.Error())
+	}
+
+	opts.DB = db
+
+	stopped := make(chan struct{})
+
+	go func() {
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+
+		log.Info("receive signal " + (<-sig).String())
+
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout())
+		defer cancel()
+
+		if err := engine.Shutdown(ctx); err != nil {
+			log.Error("shutdown: " + err.Error())
+		}
+
+		close(stopped)
+	}()
+
+	if err := engine.Run(opts); err != server.ErrServerClosed {
+		log.Error(err.Error())
+		db.Close()
+		log.Close()
+		os.Exit(1)
+	}
+
+	<-stopped
+
+	db.Close()
+
+	log.Info("application stopped")
+	log.Close()
 }
@@ -5,16 +5,56 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"time"
 
 	"github.com/lj-team/go-generic/daemon"
 	"github.com/lj-team/go-generic/log"
+	"github.com/lj-team/lcluster/auth"
+	"github.com/lj-team/lcluster/connect"
+	"github.com/lj-team/lcluster/server"
+	"github.com/lj-team/lcluster/tlsconf"
 )
 
 type Config struct {
-	Nodes  []string      `json:"nodes"`
-	Daemon daemon.Config `json:"daemon"`
-	Log    log.Config    `json:"log"`
-	Server string        `json:"server"`
+	Nodes     connect.NodeList `json:"nodes"`
+	Seeds     []string         `json:"seeds"` // nodes with topology, replace nodes
+	Refresh   int              `json:"topology_refresh"`
+	Daemon    daemon.Config    `json:"daemon"`
+	Log       log.Config       `json:"log"`
+	Server    string           `json:"server"`
+	Shutdown  int              `json:"shutdown_timeout"`
+	TLS       tlsconf.Config   `json:"tls"`
+	NodesTLS  tlsconf.Config   `json:"nodes_tls"`
+	Auth      auth.Config      `json:"auth"`
+	NodesAuth auth.Credentials `json:"nodes_auth"`
+	AdminAuth auth.Credentials `json:"admin_auth"` // internal token of failover, empty - nodes_auth
+	NodesWait int              `json:"nodes_timeout"`
+	NodesPool PoolConfig       `json:"nodes_pool"`
+	Failover  int              `json:"nodes_failover"` // seconds before replica promotion, -1 - never
+	NodesAcks int              `json:"nodes_acks"`     // replicas to confirm C_* writes, 0 - node default
+	MaxFrame  int              `json:"max_frame_size"`
+	Limits    server.Limits    `json:"limits"`
+}
+
+// PoolConfig of connections to every node, timeouts in seconds
+type PoolConfig struct {
+	Min         int `json:"min"`
+	Max         int `json:"max"`
+	Streams     int `json:"streams"`
+	IdleTimeout int `json:"idle_timeout"`
+	HealthCheck int `json:"health_check"`
+	WaitTimeout int `json:"wait_timeout"`
+}
+
+func (c *PoolConfig) Pool() connect.PoolConfig {
+	return connect.PoolConfig{
+		Min:         c.Min,
+		Max:         c.Max,
+		Streams:     c.Streams,
+		IdleTimeout: time.Duration(c.IdleTimeout) * time.Second,
+		HealthCheck: time.Duration(c.HealthCheck) * time.Second,
+		WaitTimeout: time.Duration(c.WaitTimeout) * time.Second,
+	}
 }
 
 var _config *Config
@@ -29,7 +69,7 @@ func LoadConfig(filename string) *Config {
 		os.Exit(1)
 	}
 
-	var _con Config
+	_con := Config{Shutdown: 30}
 
 	if err = json.Unmarshal(data, &_con); err != nil {
 		fmt.Println(err)
@@ -48,3 +88,22 @@ func SetConfig(conf *Config) {
 func GetConfig() *Config {
 	return _config
 }
+
+func (c *Config) ShutdownTimeout() time.Duration {
+	return time.Duration(c.Shutdown) * time.Second
+}
+
+// NodesTimeout of node responses, 0 - connect.DefaultTimeout
+func (c *Config) NodesTimeout() time.Duration {
+	return time.Duration(c.NodesWait) * time.Second
+}
+
+// TopologyRefresh is the interval of topology checks, 0 - connect.DefaultRefresh
+func (c *Config) TopologyRefresh() time.Duration {
+	return time.Duration(c.Refresh) * time.Second
+}
+
+// FailoverAfter is the time before replica promotion, 0 - connect.DefaultFailoverAfter
+func (c *Config) FailoverAfter() time.Duration {
+	return time.Duration(c.Failover) * time.Second
+}
@@ -21,6 +21,24 @@ func Handler(req []byte) ([]byte, error) {
 		return nil, err
 	}
 
+	switch msg.Code {
+	case pb.LCPROTO_C_NOP:
+		rbuf, _ := proto.Marshal(&pb.LCPROTO{Code: pb.LCPROTO_RESP, Id: msg.Id, Value: []byte{1}})
+		return rbuf, nil
+	case pb.LCPROTO_AUTH:
+		// connection is already authenticated or auth disabled
+		rbuf, _ := proto.Marshal(&pb.LCPROTO{Code: pb.LCPROTO_RESP, Id: msg.Id, Ivalue: 1})
+		return rbuf, nil
+	}
+
+	// replication and management commands are sent to the nodes directly
+	if msg.Code.Internal() {
+		res := pb.ErrorResponse(pb.ERR_FORBIDDEN, msg.Code.String()+" is not allowed")
+		res.Id = msg.Id
+		rbuf, _ := proto.Marshal(res)
+		return rbuf, nil
+	}
+
 	_, ok := send_map[msg.Code]
 	if ok {
 		PROXY.ProtoSend(&msg)
@@ -29,10 +47,6 @@ func Handler(req []byte) ([]byte, error) {
 
 	res := PROXY.ProtoDo(&msg)
 
-	if res == nil {
-		res = &pb.LCPROTO{Key: msg.Key}
-	}
-
 	rbuf, _ := proto.Marshal(res)
 
 	return rbuf, nil
@@ -1,11 +1,16 @@
 package main
 
 import (
+	"context"
 	"flag"
+	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/lj-team/go-generic/daemon"
 	"github.com/lj-team/go-generic/log"
 	"github.com/lj-team/lcluster/connect"
+	"github.com/lj-team/lcluster/pb"
 	"github.com/lj-team/lcluster/server"
 )
 
@@ -35,12 +40,87 @@ func main() {
 		log.Info("start application")
 	}
 
-	PROXY = connect.NewProxy(cfg.Nodes).(*connect.Proxy)
+	srvTLS, err := cfg.TLS.Server()
+	if err != nil {
+		log.Fatal("tls: " + err.Error())
+	}
+
+	nodesTLS, err := cfg.NodesTLS.Client()
+	if err != nil {
+		log.Fatal("nodes tls: " + err.Error())
+	}
+
+	nodesOpts := &connect.Options{
+		TLS:     nodesTLS,
+		Auth:    &cfg.NodesAuth,
+		Timeout: cfg.NodesTimeout(),
+		Pool:    cfg.NodesPool.Pool(),
+		Refresh: cfg.TopologyRefresh(),
+
+		FailoverAfter: cfg.FailoverAfter(),
+		Acks:          cfg.NodesAcks,
+	}
+
+	if cfg.AdminAuth.Enabled() {
+		nodesOpts.AdminAuth = &cfg.AdminAuth
+	}
+
+	if len(cfg.Seeds) > 0 {
+		px, err := connect.NewProxyFromSeeds(cfg.Seeds, nodesOpts)
+		if err != nil {
+			log.Fatal("topology: " + err.Error())
+		}
+		PROXY = px.(*connect.Proxy)
+	} else {
+		px, err := connect.NewProxyFromList(&cfg.Nodes, nodesOpts)
+		if err != nil {
+			log.Fatal("nodes: " + err.Error())
+		}
+		PROXY = px.(*connect.Proxy)
+	}
 
 	srv := &server.Server{
 		Addr:     cfg.Server,
 		Callback: Handler,
+		TLS:      srvTLS,
+
+		MaxFrameSize: cfg.MaxFrame,
+		Limits:       cfg.Limits,
+		Busy:         pb.Busy,
 	}
 
-	srv.Start()
+	if cfg.Auth.Enabled() {
+		srv.Auth = cfg.Auth.Handler()
+	}
+
+	stopped := make(chan struct{})
+
+	go func() {
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+
+		log.Info("receive signal " + (<-sig).String())
+
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout())
+		defer cancel()
+
+		if err := srv.Shutdown(ctx); err != nil {
+			log.Error("shutdown: " + err.Error())
+		}
+
+		PROXY.Close()
+
+		close(stopped)
+	}()
+
+	if err := srv.Start(); err != server.ErrServerClosed {
+		log.Error(err.Error())
+		log.Close()
+		os.Exit(1)
+	}
+
+	<-stopped
+
+	log.Info("application stopped")
+	log.Close()
 }
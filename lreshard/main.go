@@ -0,0 +1,470 @@
+package main
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/lj-team/go-generic/log"
+	"github.com/lj-team/lcluster/auth"
+	"github.com/lj-team/lcluster/connect"
+	"github.com/lj-team/lcluster/hash"
+	"github.com/lj-team/lcluster/pb"
+)
+
+// State is saved after every batch, so the tool may be restarted
+type State struct {
+	Config    string `json:"config"` // checksum of old and new lists
+	Node      int    `json:"node"`   // index of scanned old node
+	Cursor    []byte `json:"cursor"` // last processed key
+	Scanned   int64  `json:"scanned"`
+	Moved     int64  `json:"moved"`
+	Deleted   int64  `json:"deleted"`
+	Done      bool   `json:"done"`      // keys are moved
+	Published bool   `json:"published"` // topology is published after Done
+}
+
+var (
+	oldFile   = flag.String("old", "", "current cluster.json")
+	newFile   = flag.String("new", "", "new cluster.json")
+	ring      = flag.String("ring", "", "ring name if the files describe several rings")
+	stateFile = flag.String("state", "lreshard.state", "progress file, used to resume")
+	batch     = flag.Int("batch", 1000, "keys per scan request")
+	remove    = flag.Bool("delete", false, "delete moved keys from the old node")
+	dryRun    = flag.Bool("dry-run", false, "only count keys to move")
+	online    = flag.Bool("online", false, "nodes move keys and redirect clients, no downtime")
+	authName  = flag.String("auth-name", "", "auth token name")
+	authKey   = flag.String("auth-secret", "", "auth token secret")
+	logLevel  = flag.String("log", "info", "log level")
+)
+
+func main() {
+
+	flag.Parse()
+
+	log.Init(&log.Config{
+		Template: "lreshard-%Y%m%d.log",
+		Period:   86400,
+		Save:     10,
+		Level:    *logLevel,
+	})
+
+	if *oldFile == "" || *newFile == "" {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	oldData, oldList := loadList(*oldFile, *ring)
+	newData, newList := loadList(*newFile, *ring)
+
+	sum := md5.Sum(append(oldData, newData...))
+	state := loadState(*stateFile, hex.EncodeToString(sum[:]))
+
+	if state.Done && state.Published {
+		fmt.Println("resharding is already done, remove " + *stateFile + " to start again")
+		return
+	}
+
+	moved, err := oldList.Moved(newList)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("keys to move: ~%.1f%%\n", moved*100)
+
+	opts := &connect.Options{}
+
+	if *authName != "" || *authKey != "" {
+		opts.Auth = &auth.Credentials{Name: *authName, Secret: *authKey}
+	}
+
+	// lists are checked by Moved
+	oldPlace, _ := oldList.Placement()
+	newPlace, _ := newList.Placement()
+
+	r := &resharder{
+		oldAddrs:  oldList.Addrs(),
+		newAddrs:  newList.Addrs(),
+		newList:   newList,
+		oldPlace:  oldPlace,
+		newPlace:  newPlace,
+		conns:     map[string]*connect.Conn{},
+		opts:      opts,
+		state:     state,
+		stateFile: *stateFile,
+	}
+
+	run := r.run
+	if *online && !*dryRun {
+		run = r.runOnline
+	}
+
+	if !state.Done {
+		if err := run(context.Background()); err != nil {
+			log.Error(err.Error())
+			fmt.Println("error:", err)
+			fmt.Println("run the same command to resume")
+			os.Exit(1)
+		}
+	}
+
+	fmt.Printf("done: scanned %d, moved %d, deleted %d\n", state.Scanned, state.Moved, state.Deleted)
+
+	if *dryRun {
+		return
+	}
+
+	epoch, err := r.publish(context.Background())
+	if err != nil {
+		log.Error("publish: " + err.Error())
+		fmt.Println("topology is not published:", err)
+		fmt.Println("run the same command to retry")
+		os.Exit(1)
+	}
+
+	state.Published = true
+
+	if err = r.save(); err != nil {
+		fmt.Println("state is not saved:", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("topology epoch %d is published\n", epoch)
+}
+
+func loadList(filename, ring string) ([]byte, *connect.NodeList) {
+
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		fmt.Println("read " + filename + " error")
+		os.Exit(1)
+	}
+
+	if ring == "" {
+		var list connect.NodeList
+
+		if err = json.Unmarshal(data, &list); err != nil {
+			fmt.Println(filename+":", err)
+			os.Exit(1)
+		}
+
+		return data, &list
+	}
+
+	var rings map[string]*connect.NodeList
+
+	if err = json.Unmarshal(data, &rings); err != nil {
+		fmt.Println(filename+":", err)
+		os.Exit(1)
+	}
+
+	list, ok := rings[ring]
+	if !ok {
+		fmt.Println(filename + ": ring " + ring + " not found")
+		os.Exit(1)
+	}
+
+	return data, list
+}
+
+func loadState(filename, config string) *State {
+
+	state := &State{Config: config}
+
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return state
+	}
+
+	var saved State
+
+	if err = json.Unmarshal(data, &saved); err != nil {
+		fmt.Println(filename+":", err)
+		os.Exit(1)
+	}
+
+	if saved.Config != config {
+		fmt.Println(filename + " belongs to other cluster files, remove it to start again")
+		os.Exit(1)
+	}
+
+	fmt.Printf("resume from node %d\n", saved.Node)
+
+	return &saved
+}
+
+type resharder struct {
+	oldAddrs  []string
+	newAddrs  []string
+	newList   *connect.NodeList
+	oldPlace  hash.Placement
+	newPlace  hash.Placement
+	conns     map[string]*connect.Conn
+	opts      *connect.Options
+	state     *State
+	stateFile string
+}
+
+func (r *resharder) conn(addr string) *connect.Conn {
+	c, ok := r.conns[addr]
+	if !ok {
+		c = connect.NewConnWithOptions(addr, r.opts)
+		r.conns[addr] = c
+	}
+	return c
+}
+
+func (r *resharder) save() error {
+	if *dryRun {
+		return nil
+	}
+
+	data, _ := json.Marshal(r.state)
+
+	tmp := r.stateFile + ".tmp"
+
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, r.stateFile)
+}
+
+func (r *resharder) run(ctx context.Context) error {
+
+	for ; r.state.Node < len(r.oldAddrs); r.state.Node++ {
+
+		if err := r.node(ctx, r.state.Node); err != nil {
+			return err
+		}
+
+		r.state.Cursor = nil
+
+		if err := r.save(); err != nil {
+			return err
+		}
+	}
+
+	r.state.Done = true
+
+	return r.save()
+}
+
+// publish saves the new list as topology with the next epoch on the
+// nodes of both lists
+func (r *resharder) publish(ctx context.Context) (int64, error) {
+
+	addrs := append(append([]string{}, r.newAddrs...), r.oldAddrs...)
+	epoch := int64(0)
+
+	for _, addr := range addrs {
+		t, err := r.conn(addr).TopologyContext(ctx, epoch)
+		if err != nil {
+			return 0, fmt.Errorf("topology of %s: %s", addr, err.Error())
+		}
+
+		if t != nil {
+			epoch = t.Epoch
+		}
+	}
+
+	t := connect.NewTopology(epoch+1, r.newList)
+	done := map[string]bool{}
+
+	for _, addr := range addrs {
+		if done[addr] {
+			continue
+		}
+
+		done[addr] = true
+
+		if _, err := r.conn(addr).SetTopologyContext(ctx, t); err != nil {
+			return 0, fmt.Errorf("topology of %s: %s", addr, err.Error())
+		}
+	}
+
+	return t.Epoch, nil
+}
+
+// runOnline switches the old nodes to migration state, then every node
+// moves its keys itself, clients are redirected by ERR_ASK meanwhile.
+// At the end the nodes answer ERR_MOVED with the new list
+func (r *resharder) runOnline(ctx context.Context) error {
+
+	if err := r.migrate(ctx, pb.MIGRATE_ASK); err != nil {
+		return err
+	}
+
+	for ; r.state.Node < len(r.oldAddrs); r.state.Node++ {
+
+		if err := r.moveKeys(ctx, r.state.Node); err != nil {
+			return err
+		}
+
+		r.state.Cursor = nil
+
+		if err := r.save(); err != nil {
+			return err
+		}
+	}
+
+	if err := r.migrate(ctx, pb.MIGRATE_MOVED); err != nil {
+		return err
+	}
+
+	r.state.Done = true
+
+	return r.save()
+}
+
+func (r *resharder) migrate(ctx context.Context, state int64) error {
+	for _, addr := range r.oldAddrs {
+		if err := r.conn(addr).MigrateContext(ctx, addr, r.newList, state); err != nil {
+			return fmt.Errorf("migrate %s: %s", addr, err.Error())
+		}
+	}
+	return nil
+}
+
+// moveKeys makes the old node move keys which belong to other nodes now
+func (r *resharder) moveKeys(ctx context.Context, num int) error {
+
+	addr := r.oldAddrs[num]
+	src := r.conn(addr)
+	last := time.Now()
+
+	log.Info(fmt.Sprintf("move keys of node %d %s", num, addr))
+
+	for {
+		cursor, moved, more, err := src.MoveKeysContext(ctx, r.state.Cursor, *batch)
+
+		r.state.Moved += int64(moved)
+		r.state.Deleted += int64(moved)
+
+		if err != nil {
+			r.save()
+			return fmt.Errorf("move keys of %s: %s", addr, err.Error())
+		}
+
+		r.state.Cursor = cursor
+
+		if err = r.save(); err != nil {
+			return err
+		}
+
+		if time.Since(last) > time.Second || !more {
+			last = time.Now()
+			msg := fmt.Sprintf("node %d/%d %s: total moved %d", num+1, len(r.oldAddrs), addr, r.state.Moved)
+			fmt.Println(msg)
+			log.Info(msg)
+		}
+
+		if !more {
+			return nil
+		}
+	}
+}
+
+// node moves keys of the old node which belong to other nodes now
+func (r *resharder) node(ctx context.Context, num int) error {
+
+	addr := r.oldAddrs[num]
+	src := r.conn(addr)
+
+	total, _ := src.KeyTotalContext(ctx, num)
+	scanned := int64(0)
+	stray := int64(0)
+	last := time.Now()
+
+	log.Info(fmt.Sprintf("scan node %d %s, about %d keys", num, addr, total))
+
+	for {
+		list, more, err := src.ScanContext(ctx, r.state.Cursor, *batch)
+		if err != nil {
+			return fmt.Errorf("scan %s: %s", addr, err.Error())
+		}
+
+		for _, p := range list {
+			key := connect.RouteKey(p.Key)
+			if key == nil {
+				continue
+			}
+
+			if r.oldAddrs[r.oldPlace.Get(key)] != addr {
+				stray++
+			}
+
+			dst := r.newAddrs[r.newPlace.Get(key)]
+
+			if dst != addr {
+				if err = r.move(src, addr, dst, p); err != nil {
+					return err
+				}
+			}
+
+			r.state.Cursor = p.Key
+			r.state.Scanned++
+			scanned++
+		}
+
+		if err = r.save(); err != nil {
+			return err
+		}
+
+		if time.Since(last) > time.Second || !more {
+			last = time.Now()
+			msg := fmt.Sprintf("node %d/%d %s: scanned %d of ~%d, total moved %d, deleted %d",
+				num+1, len(r.oldAddrs), addr, scanned, total, r.state.Moved, r.state.Deleted)
+			fmt.Println(msg)
+			log.Info(msg)
+		}
+
+		if !more {
+			break
+		}
+	}
+
+	if stray > 0 {
+		log.Warn(fmt.Sprintf("node %s has %d keys of other nodes", addr, stray))
+	}
+
+	return nil
+}
+
+// move copies the key to dst node and deletes it from src if required.
+// The key is counted when the move is finished, so a retry after an error
+// does not count it twice
+func (r *resharder) move(src *connect.Conn, addr, dst string, p connect.Pair) error {
+
+	if *dryRun {
+		r.state.Moved++
+		return nil
+	}
+
+	_, err := r.conn(dst).Call(&pb.LCPROTO{Code: pb.LCPROTO_C_SET, Key: p.Key, Value: p.Value, Sync: true})
+	if err != nil {
+		return errors.New("copy to " + dst + ": " + err.Error())
+	}
+
+	if !*remove {
+		r.state.Moved++
+		return nil
+	}
+
+	if _, err = src.Call(&pb.LCPROTO{Code: pb.LCPROTO_C_DEL, Key: p.Key, Sync: true}); err != nil {
+		return errors.New("delete from " + addr + ": " + err.Error())
+	}
+
+	r.state.Moved++
+	r.state.Deleted++
+
+	return nil
+}
@@ -1,9 +1,12 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
 
 	"github.com/lj-team/go-generic/log"
 	"github.com/lj-team/lcluster/connect"
@@ -11,6 +14,11 @@ import (
 
 func main() {
 
+	file := flag.String("c", "/etc/lcluster/cluster.json", "cluster node list")
+	seeds := flag.String("seeds", "", "comma separated nodes to read topology from, replace -c")
+
+	flag.Parse()
+
 	cfg := &log.Config{
 		Template: "lsize-%Y%m%d.log",
 		Period:   86400,
@@ -20,16 +28,29 @@ func main() {
 
 	log.Init(cfg)
 
-	nodes := connect.LoadNodeList("/etc/lcluster/cluster.json")
-	proxy := connect.NewProxy(nodes)
+	if flag.NArg() != 1 {
+		fmt.Println("use: lsize [-c cluster.json | -seeds host:port,...] <num>")
+		os.Exit(1)
+	}
 
-	if len(os.Args) != 2 {
-		panic("use: lsize <num>")
+	var nodes []string
+
+	if *seeds != "" {
+		t, err := connect.Discover(context.Background(), strings.Split(*seeds, ","), nil)
+		if err != nil {
+			fmt.Println("topology:", err)
+			os.Exit(1)
+		}
+		nodes = t.List().Addrs()
+	} else {
+		nodes = connect.LoadNodeList(*file)
 	}
 
-	n, err := strconv.ParseInt(os.Args[1], 10, 64)
+	proxy := connect.NewProxy(nodes)
+
+	n, err := strconv.ParseInt(flag.Arg(0), 10, 64)
 
-	if err != nil || int(n) >= len(nodes) {
+	if err != nil || n < 0 || int(n) >= len(nodes) {
 		panic("invalid node number")
 	}
 
@@ -82,6 +82,22 @@ const (
 	LCPROTO_C_KEYTOTAL   LCPROTO_Code = 49
 	LCPROTO_C_NOP        LCPROTO_Code = 50
 	LCPROTO_C_HALL       LCPROTO_Code = 51
+	LCPROTO_AUTH         LCPROTO_Code = 52
+	LCPROTO_BUSY         LCPROTO_Code = 53
+	LCPROTO_SCAN         LCPROTO_Code = 54
+	LCPROTO_MIGRATE      LCPROTO_Code = 55
+	LCPROTO_MOVEKEYS     LCPROTO_Code = 56
+	LCPROTO_TOPOLOGY     LCPROTO_Code = 57
+	LCPROTO_SETTOPOLOGY  LCPROTO_Code = 58
+	LCPROTO_PROMOTE      LCPROTO_Code = 59
+	LCPROTO_REPLPOS      LCPROTO_Code = 60
+	LCPROTO_RESYNC       LCPROTO_Code = 61
+	LCPROTO_SYNC         LCPROTO_Code = 62
+	LCPROTO_ROLE         LCPROTO_Code = 63
+	LCPROTO_CHECK        LCPROTO_Code = 64
+	LCPROTO_DIGEST       LCPROTO_Code = 65
+	LCPROTO_REPAIR       LCPROTO_Code = 66
+	LCPROTO_INFO         LCPROTO_Code = 67
 )
 
 var LCPROTO_Code_name = map[int32]string{
@@ -137,6 +153,22 @@ var LCPROTO_Code_name = map[int32]string{
 	49: "C_KEYTOTAL",
 	50: "C_NOP",
 	51: "C_HALL",
+	52: "AUTH",
+	53: "BUSY",
+	54: "SCAN",
+	55: "MIGRATE",
+	56: "MOVEKEYS",
+	57: "TOPOLOGY",
+	58: "SETTOPOLOGY",
+	59: "PROMOTE",
+	60: "REPLPOS",
+	61: "RESYNC",
+	62: "SYNC",
+	63: "ROLE",
+	64: "CHECK",
+	65: "DIGEST",
+	66: "REPAIR",
+	67: "INFO",
 }
 var LCPROTO_Code_value = map[string]int32{
 	"NOP":          0,
@@ -191,6 +223,22 @@ var LCPROTO_Code_value = map[string]int32{
 	"C_KEYTOTAL":   49,
 	"C_NOP":        50,
 	"C_HALL":       51,
+	"AUTH":         52,
+	"BUSY":         53,
+	"SCAN":         54,
+	"MIGRATE":      55,
+	"MOVEKEYS":     56,
+	"TOPOLOGY":     57,
+	"SETTOPOLOGY":  58,
+	"PROMOTE":      59,
+	"REPLPOS":      60,
+	"RESYNC":       61,
+	"SYNC":         62,
+	"ROLE":         63,
+	"CHECK":        64,
+	"DIGEST":       65,
+	"REPAIR":       66,
+	"INFO":         67,
 }
 
 func (x LCPROTO_Code) String() string {
@@ -206,6 +254,15 @@ type LCPROTO struct {
 	Counter int32        `protobuf:"varint,5,opt,name=counter" json:"counter,omitempty"`
 	Sync    bool         `protobuf:"varint,6,opt,name=sync" json:"sync,omitempty"`
 	Ivalue  int64        `protobuf:"varint,7,opt,name=ivalue" json:"ivalue,omitempty"`
+	Id      uint64       `protobuf:"varint,8,opt,name=id" json:"id,omitempty"`
+	ErrCode int32        `protobuf:"varint,9,opt,name=err_code,json=errCode" json:"err_code,omitempty"`
+	ErrMsg  string       `protobuf:"bytes,10,opt,name=err_msg,json=errMsg" json:"err_msg,omitempty"`
+	Acks    int32        `protobuf:"varint,11,opt,name=acks" json:"acks,omitempty"`
+	Async   bool         `protobuf:"varint,12,opt,name=async" json:"async,omitempty"`
+	Ts      uint64       `protobuf:"varint,13,opt,name=ts" json:"ts,omitempty"`
+	Origin  string       `protobuf:"bytes,14,opt,name=origin" json:"origin,omitempty"`
+	Peer    bool         `protobuf:"varint,15,opt,name=peer" json:"peer,omitempty"`
+	Seq     int64        `protobuf:"varint,16,opt,name=seq" json:"seq,omitempty"`
 }
 
 func (m *LCPROTO) Reset()                    { *m = LCPROTO{} }
@@ -262,6 +319,69 @@ func (m *LCPROTO) GetIvalue() int64 {
 	return 0
 }
 
+func (m *LCPROTO) GetId() uint64 {
+	if m != nil {
+		return m.Id
+	}
+	return 0
+}
+
+func (m *LCPROTO) GetErrCode() int32 {
+	if m != nil {
+		return m.ErrCode
+	}
+	return 0
+}
+
+func (m *LCPROTO) GetErrMsg() string {
+	if m != nil {
+		return m.ErrMsg
+	}
+	return ""
+}
+
+func (m *LCPROTO) GetAcks() int32 {
+	if m != nil {
+		return m.Acks
+	}
+	return 0
+}
+
+func (m *LCPROTO) GetAsync() bool {
+	if m != nil {
+		return m.Async
+	}
+	return false
+}
+
+func (m *LCPROTO) GetTs() uint64 {
+	if m != nil {
+		return m.Ts
+	}
+	return 0
+}
+
+func (m *LCPROTO) GetOrigin() string {
+	if m != nil {
+		return m.Origin
+	}
+	return ""
+}
+
+func (m *LCPROTO) GetPeer() bool {
+	if m != nil {
+		return m.Peer
+	}
+	return false
+}
+
+func (m *LCPROTO) GetSeq() int64 {
+	if m != nil {
+		return m.Seq
+	}
+	return 0
+}
+
 func init() {
 	proto.RegisterType((*LCPROTO)(nil), "pb.LCPROTO")
 	proto.RegisterEnum("pb.LCPROTO_Code", LCPROTO_Code_name, LCPROTO_Code_value)
@@ -270,38 +390,51 @@ func init() {
 func init() { proto.RegisterFile("LCPROTO.proto", fileDescriptor0) }
 
 var fileDescriptor0 = []byte{
-	// 514 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x3c, 0x53, 0xdb, 0x72, 0xda, 0x30,
-	0x10, 0xad, 0xb1, 0xb1, 0x89, 0x20, 0x64, 0xab, 0xa6, 0xa9, 0x7b, 0x77, 0x69, 0xda, 0xba, 0x37,
-	0xda, 0x26, 0x5f, 0x60, 0x8c, 0x0a, 0x9a, 0x08, 0x99, 0x91, 0xf5, 0x00, 0xbc, 0x64, 0x0a, 0xe1,
-	0x21, 0xd3, 0x4c, 0x60, 0x12, 0xd2, 0x99, 0xfc, 0x56, 0x3f, 0xb0, 0xd3, 0x59, 0xad, 0xe1, 0xed,
-	0x5c, 0x76, 0x57, 0xab, 0x23, 0x9b, 0xed, 0xab, 0x7c, 0x6c, 0x0a, 0x5b, 0x74, 0xd7, 0x37, 0xab,
-	0xcd, 0x8a, 0xd7, 0xd6, 0xf3, 0xce, 0xdf, 0x90, 0x45, 0x95, 0xca, 0x8f, 0x59, 0xb0, 0x58, 0x5d,
-	0x2c, 0x63, 0x2f, 0xf1, 0xd2, 0xf6, 0x09, 0x74, 0xd7, 0xf3, 0xee, 0xb6, 0x21, 0x5f, 0x5d, 0x2c,
-	0x8d, 0x73, 0x39, 0x30, 0xff, 0xf7, 0xf2, 0x3e, 0xae, 0x25, 0x5e, 0xda, 0x32, 0x08, 0xf9, 0x21,
-	0xab, 0xff, 0xf9, 0x75, 0x75, 0xb7, 0x8c, 0x7d, 0xa7, 0x11, 0xe1, 0x9c, 0x05, 0x57, 0x97, 0xb7,
-	0x9b, 0x38, 0x48, 0xfc, 0xb4, 0x65, 0x1c, 0xe6, 0x31, 0x8b, 0x16, 0xab, 0xbb, 0xeb, 0xcd, 0xf2,
-	0x26, 0xae, 0x27, 0x5e, 0x5a, 0x37, 0x5b, 0x8a, 0xd5, 0xb7, 0xf7, 0xd7, 0x8b, 0x38, 0x4c, 0xbc,
-	0xb4, 0x61, 0x1c, 0xe6, 0x47, 0x2c, 0xbc, 0xa4, 0xc1, 0x51, 0xe2, 0xa5, 0xbe, 0xa9, 0x58, 0xe7,
-	0x5f, 0xc0, 0x02, 0x5c, 0x88, 0x47, 0xcc, 0xd7, 0xc5, 0x18, 0x1e, 0xf0, 0x06, 0x0b, 0x8c, 0x28,
-	0xc7, 0xe0, 0xa1, 0xa4, 0x8a, 0x01, 0xd4, 0x10, 0x94, 0xc2, 0x82, 0xcf, 0xf7, 0x58, 0xbd, 0x14,
-	0x56, 0x4f, 0x20, 0x40, 0x6d, 0x20, 0x2c, 0xd4, 0x11, 0xf4, 0x45, 0x0e, 0x21, 0x9a, 0x7d, 0x91,
-	0xf7, 0xa6, 0x10, 0xe1, 0x8c, 0xbe, 0xc8, 0x0d, 0x34, 0xc8, 0x55, 0xb0, 0x47, 0x92, 0x32, 0xc0,
-	0x50, 0x1a, 0x66, 0x25, 0x34, 0x11, 0x48, 0x9d, 0x43, 0x0b, 0x3b, 0xa5, 0xc6, 0xce, 0x7d, 0x2c,
-	0x93, 0x3a, 0x37, 0xd0, 0x46, 0x71, 0x78, 0x26, 0x95, 0x82, 0x03, 0x14, 0x87, 0x99, 0x52, 0x00,
-	0x24, 0x8a, 0x69, 0x09, 0x0f, 0x11, 0xce, 0x9c, 0xcf, 0x39, 0x63, 0xe1, 0xcc, 0x64, 0x7a, 0x20,
-	0xe0, 0x11, 0x6f, 0x33, 0x46, 0xb8, 0x94, 0x33, 0x01, 0x87, 0xc8, 0x5d, 0x87, 0x92, 0x23, 0x69,
-	0xe1, 0xf1, 0x8e, 0xdb, 0xc2, 0x66, 0x0a, 0x8e, 0x78, 0x8b, 0x35, 0xce, 0xc4, 0x94, 0xd8, 0x13,
-	0x9c, 0xd4, 0x93, 0x36, 0xd3, 0x7d, 0x88, 0xf1, 0x80, 0x9e, 0xb4, 0x85, 0x81, 0xa7, 0x95, 0x3c,
-	0x29, 0x0c, 0x3c, 0xe3, 0x07, 0xac, 0xe9, 0x06, 0x98, 0x4c, 0xf7, 0x8b, 0x11, 0x3c, 0xc7, 0xed,
-	0x4a, 0x61, 0x0d, 0xbc, 0x40, 0x2b, 0x3f, 0x2f, 0x85, 0x95, 0x3f, 0x47, 0x85, 0x11, 0xf0, 0x12,
-	0x47, 0x38, 0x01, 0x5e, 0x11, 0xc4, 0xc4, 0x5e, 0xe3, 0x91, 0x0e, 0x4a, 0x6d, 0x21, 0x21, 0x03,
-	0x33, 0x7a, 0x43, 0x10, 0x23, 0xe9, 0x6c, 0xd5, 0x1c, 0xde, 0x12, 0xc4, 0xc4, 0x8e, 0x79, 0x93,
-	0x45, 0x6e, 0x9e, 0x9e, 0xc0, 0x3b, 0x1a, 0x53, 0x6d, 0xfb, 0x9e, 0x2c, 0xda, 0xf7, 0xc3, 0xce,
-	0xc2, 0x8d, 0x53, 0x5a, 0x8b, 0x0a, 0x75, 0x61, 0xe1, 0x23, 0xd5, 0x52, 0x78, 0x9f, 0xa8, 0xb6,
-	0x8a, 0xef, 0x33, 0x07, 0xd6, 0xda, 0x32, 0x17, 0xe0, 0x17, 0x2a, 0xa6, 0x97, 0xf8, 0xba, 0x25,
-	0xf8, 0x02, 0xdd, 0x8a, 0xb8, 0xb2, 0x6f, 0x74, 0xc8, 0x2e, 0x18, 0xf8, 0x8e, 0x41, 0xe7, 0xe7,
-	0xbb, 0x68, 0x7f, 0xd0, 0x35, 0xf0, 0x13, 0x3b, 0xc1, 0x38, 0xf1, 0x46, 0x4a, 0xc1, 0xe9, 0x3c,
-	0x74, 0xff, 0xcf, 0xe9, 0xff, 0x00, 0x00, 0x00, 0xff, 0xff, 0x72, 0x67, 0x19, 0xe9, 0x50, 0x03,
-	0x00, 0x00,
+	// 731 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x4c, 0x54, 0x6b, 0x6f, 0xda, 0x48,
+	0x14, 0x5d, 0xf3, 0x66, 0x20, 0xe4, 0xee, 0x6c, 0x36, 0x71, 0xf6, 0xe9, 0xcd, 0x66, 0x77, 0xbd,
+	0x2f, 0xda, 0x26, 0x7d, 0xbf, 0x8d, 0x99, 0x80, 0x15, 0xe3, 0xb1, 0xc6, 0x93, 0x2a, 0xe4, 0x0b,
+	0x4a, 0xc0, 0x8a, 0x50, 0xd2, 0x40, 0x6d, 0x52, 0x29, 0x3f, 0xaa, 0x3f, 0xa1, 0xff, 0xad, 0xba,
+	0x73, 0x01, 0xf5, 0xdb, 0x39, 0xe7, 0xbe, 0xce, 0x1c, 0x2c, 0xd8, 0x46, 0xe8, 0xc7, 0x4a, 0x6a,
+	0xd9, 0x9e, 0x67, 0xb3, 0xc5, 0x8c, 0x17, 0xe6, 0x17, 0x7b, 0x9f, 0xea, 0xac, 0xba, 0x54, 0xf9,
+	0x3e, 0x2b, 0x8d, 0x67, 0x93, 0xd4, 0xb6, 0x1c, 0xcb, 0x6d, 0x1d, 0x40, 0x7b, 0x7e, 0xd1, 0x5e,
+	0x0d, 0xf8, 0xb3, 0x49, 0xaa, 0x4c, 0x95, 0x03, 0x2b, 0x5e, 0xa5, 0x77, 0x76, 0xc1, 0xb1, 0xdc,
+	0xa6, 0x42, 0xc8, 0xb7, 0x58, 0xf9, 0xe3, 0xf9, 0xf5, 0x6d, 0x6a, 0x17, 0x8d, 0x46, 0x84, 0x73,
+	0x56, 0xba, 0x9e, 0xe6, 0x0b, 0xbb, 0xe4, 0x14, 0xdd, 0xa6, 0x32, 0x98, 0xdb, 0xac, 0x3a, 0x9e,
+	0xdd, 0xde, 0x2c, 0xd2, 0xcc, 0x2e, 0x3b, 0x96, 0x5b, 0x56, 0x2b, 0x8a, 0xdd, 0xf9, 0xdd, 0xcd,
+	0xd8, 0xae, 0x38, 0x96, 0x5b, 0x53, 0x06, 0xf3, 0x6d, 0x56, 0x99, 0xd2, 0xe2, 0xaa, 0x63, 0xb9,
+	0x45, 0xb5, 0x64, 0xbc, 0xc5, 0x0a, 0xd3, 0x89, 0x5d, 0x73, 0x2c, 0xb7, 0xa4, 0x0a, 0xd3, 0x09,
+	0xdf, 0x65, 0xb5, 0x34, 0xcb, 0x46, 0xc6, 0x7b, 0x9d, 0xd6, 0xa6, 0x59, 0x86, 0x96, 0xf9, 0x0e,
+	0x43, 0x38, 0x7a, 0x9f, 0x5f, 0xda, 0xcc, 0xb1, 0xdc, 0xba, 0xaa, 0xa4, 0x59, 0x36, 0xc8, 0x2f,
+	0xf1, 0xde, 0xf9, 0xf8, 0x2a, 0xb7, 0x1b, 0xa6, 0xdf, 0x60, 0x7c, 0xc7, 0xb9, 0x31, 0xd1, 0x34,
+	0x26, 0x88, 0xe0, 0xb5, 0x45, 0x6e, 0x6f, 0xd0, 0xb5, 0x45, 0x8e, 0xae, 0x66, 0xd9, 0xf4, 0x72,
+	0x7a, 0x63, 0xb7, 0x68, 0x23, 0x31, 0xdc, 0x38, 0x4f, 0xd3, 0xcc, 0xde, 0xa4, 0x17, 0x20, 0xc6,
+	0xac, 0xf2, 0xf4, 0x83, 0x0d, 0xc6, 0x3e, 0xc2, 0xbd, 0xcf, 0x15, 0x56, 0x32, 0xce, 0xaa, 0xac,
+	0x18, 0xc9, 0x18, 0xbe, 0xe1, 0x35, 0x56, 0x52, 0x22, 0x89, 0xc1, 0x42, 0x29, 0x94, 0x3d, 0x28,
+	0x20, 0x48, 0x84, 0x86, 0x22, 0xaf, 0xb3, 0x72, 0x22, 0x74, 0x74, 0x0a, 0x25, 0xd4, 0x7a, 0x42,
+	0x43, 0x19, 0x41, 0x57, 0xf8, 0x50, 0xc1, 0x62, 0x57, 0xf8, 0x9d, 0x21, 0x54, 0x71, 0x47, 0x57,
+	0xf8, 0x0a, 0x6a, 0x54, 0x0d, 0xa1, 0x4e, 0x52, 0xa8, 0x80, 0xa1, 0xd4, 0xf7, 0x12, 0x68, 0x20,
+	0x08, 0x22, 0x1f, 0x9a, 0x38, 0x19, 0x44, 0x38, 0xb9, 0x81, 0x6d, 0x41, 0xe4, 0x2b, 0x68, 0xa1,
+	0xd8, 0x3f, 0x0e, 0xc2, 0x10, 0x36, 0x51, 0xec, 0x7b, 0x61, 0x08, 0x40, 0xa2, 0x18, 0x26, 0xf0,
+	0x2d, 0xc2, 0x33, 0x53, 0xe7, 0x9c, 0xb1, 0xca, 0x99, 0xf2, 0xa2, 0x9e, 0x80, 0xef, 0x78, 0x8b,
+	0x31, 0xc2, 0x49, 0x70, 0x26, 0x60, 0x0b, 0xb9, 0x99, 0x08, 0x83, 0x41, 0xa0, 0xe1, 0xfb, 0x35,
+	0xd7, 0x52, 0x7b, 0x21, 0x6c, 0xf3, 0x26, 0xab, 0x1d, 0x8b, 0x21, 0xb1, 0x1d, 0xdc, 0xd4, 0x09,
+	0xb4, 0x17, 0x75, 0xc1, 0xc6, 0x03, 0x9d, 0x40, 0x4b, 0x05, 0xbb, 0x4b, 0xf9, 0x54, 0x2a, 0xf8,
+	0x81, 0x6f, 0xb2, 0x86, 0x59, 0xa0, 0xbc, 0xa8, 0x2b, 0x07, 0xf0, 0x23, 0xba, 0x4b, 0x84, 0x56,
+	0xf0, 0x13, 0x96, 0xfc, 0x51, 0x22, 0x74, 0x70, 0x34, 0x90, 0x4a, 0xc0, 0xcf, 0xb8, 0xc2, 0x08,
+	0xf0, 0x0b, 0x41, 0x4c, 0xec, 0x57, 0x3c, 0x69, 0x60, 0x10, 0x69, 0x70, 0xa8, 0x80, 0x19, 0xfd,
+	0x46, 0x10, 0x23, 0xd9, 0x5b, 0xa9, 0x3e, 0xfc, 0x4e, 0x10, 0x13, 0xdb, 0xe7, 0x0d, 0x56, 0x35,
+	0xfb, 0xa2, 0x53, 0xf8, 0x83, 0xd6, 0x2c, 0xdd, 0xfe, 0x49, 0x25, 0xf2, 0xfb, 0xd7, 0xba, 0x84,
+	0x8e, 0x5d, 0xb2, 0x45, 0x8d, 0x91, 0xd4, 0xf0, 0x37, 0xf5, 0x52, 0x78, 0xff, 0x50, 0xef, 0x32,
+	0xbe, 0x7f, 0x39, 0xb0, 0xa6, 0x3f, 0xfa, 0x2a, 0xc0, 0xff, 0xa8, 0x99, 0x7e, 0x89, 0xff, 0x57,
+	0x04, 0x7f, 0x81, 0xf6, 0x92, 0x98, 0xb6, 0x7b, 0x74, 0x64, 0x1d, 0x0c, 0xdc, 0xc7, 0xa0, 0xfd,
+	0xd1, 0x3a, 0xda, 0x07, 0xf4, 0x0c, 0xfc, 0xc4, 0x0e, 0x30, 0x4e, 0x7c, 0x51, 0x18, 0xc2, 0x21,
+	0xa6, 0xe7, 0x9d, 0xe8, 0x3e, 0x3c, 0x44, 0xd4, 0x39, 0x49, 0x86, 0xf0, 0xc8, 0x24, 0xea, 0x7b,
+	0x11, 0x3c, 0xc6, 0x13, 0x83, 0xa0, 0xa7, 0x3c, 0x2d, 0xe0, 0x09, 0x3a, 0x1d, 0xc8, 0x77, 0xc2,
+	0x5c, 0x7f, 0x8a, 0x4c, 0xcb, 0x58, 0x86, 0xb2, 0x37, 0x84, 0x67, 0x78, 0x3e, 0x11, 0x7a, 0x2d,
+	0x3c, 0xc7, 0xc9, 0x58, 0xc9, 0x81, 0xd4, 0x02, 0x5e, 0x20, 0x51, 0x22, 0x0e, 0x63, 0x99, 0xc0,
+	0x4b, 0xbc, 0xae, 0x44, 0x32, 0x8c, 0x7c, 0x78, 0x65, 0x2e, 0x21, 0x7a, 0x8d, 0x48, 0xc9, 0x50,
+	0xc0, 0x1b, 0x63, 0xb4, 0x2f, 0xfc, 0x63, 0x78, 0x8b, 0xad, 0xdd, 0xa0, 0x27, 0x12, 0x0d, 0x1e,
+	0x8d, 0xc5, 0x5e, 0xa0, 0xa0, 0x43, 0x5f, 0xe9, 0x91, 0x04, 0xff, 0xa2, 0x62, 0xfe, 0xba, 0x0e,
+	0xbf, 0x0c, 0x00, 0x93, 0xdd, 0x2b, 0xc2, 0xcb, 0x04, 0x00, 0x00,
 }
@@ -0,0 +1,48 @@
+package pb
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+)
+
+// Digest of a range of keys is the number of keys and the sum of their
+// key and value hashes, so it does not depend on the order of keys
+type Digest struct {
+	Count int64
+	Hash  uint64
+}
+
+// Add adds the key and its value to the digest
+func (d *Digest) Add(key, value []byte) {
+
+	var size [4]byte
+	binary.BigEndian.PutUint32(size[:], uint32(len(key)))
+
+	h := fnv.New64a()
+	h.Write(size[:])
+	h.Write(key)
+	h.Write(value)
+
+	d.Count++
+	d.Hash += h.Sum64()
+}
+
+// Bytes encodes the digest for DIGEST response
+func (d Digest) Bytes() []byte {
+	buf := make([]byte, 16)
+	binary.BigEndian.PutUint64(buf, uint64(d.Count))
+	binary.BigEndian.PutUint64(buf[8:], d.Hash)
+	return buf
+}
+
+// ParseDigest decodes the digest, zero one is returned for invalid data
+func ParseDigest(buf []byte) Digest {
+	if len(buf) != 16 {
+		return Digest{}
+	}
+
+	return Digest{
+		Count: int64(binary.BigEndian.Uint64(buf)),
+		Hash:  binary.BigEndian.Uint64(buf[8:]),
+	}
+}
@@ -0,0 +1,64 @@
+package pb
+
+import (
+	"github.com/golang/protobuf/proto"
+)
+
+// internal lists commands of replication and cluster management
+var internal = map[LCPROTO_Code]bool{
+	LCPROTO_AUTH:        true,
+	LCPROTO_LOG:         true,
+	LCPROTO_MIGRATE:     true,
+	LCPROTO_MOVEKEYS:    true,
+	LCPROTO_TOPOLOGY:    true,
+	LCPROTO_SETTOPOLOGY: true,
+	LCPROTO_PROMOTE:     true,
+	LCPROTO_REPLPOS:     true,
+	LCPROTO_RESYNC:      true,
+	LCPROTO_SYNC:        true,
+	LCPROTO_ROLE:        true,
+	LCPROTO_CHECK:       true,
+	LCPROTO_DIGEST:      true,
+	LCPROTO_REPAIR:      true,
+	LCPROTO_INFO:        true,
+}
+
+// restricted lists internal commands changing data, role or topology of
+// the node
+var restricted = map[LCPROTO_Code]bool{
+	LCPROTO_LOG:         true,
+	LCPROTO_MIGRATE:     true,
+	LCPROTO_MOVEKEYS:    true,
+	LCPROTO_SETTOPOLOGY: true,
+	LCPROTO_PROMOTE:     true,
+	LCPROTO_RESYNC:      true,
+	LCPROTO_SYNC:        true,
+	LCPROTO_ROLE:        true,
+	LCPROTO_REPAIR:      true,
+}
+
+// Internal returns true for commands of replication and cluster
+// management
+func (c LCPROTO_Code) Internal() bool {
+	return internal[c]
+}
+
+// Restricted returns true for commands allowed only to connections of
+// replication and cluster management
+func (c LCPROTO_Code) Restricted() bool {
+	return restricted[c]
+}
+
+// Restricted reports if the raw request is a restricted command, only
+// its code is decoded
+func Restricted(req []byte) bool {
+
+	// code is the first field, it is not sent for NOP
+	if len(req) < 2 || req[0] != 0x08 {
+		return false
+	}
+
+	code, n := proto.DecodeVarint(req[1:])
+
+	return n > 0 && LCPROTO_Code(code).Restricted()
+}
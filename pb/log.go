@@ -0,0 +1,10 @@
+package pb
+
+// operations of LOG changes, sent in counter
+const (
+	LOG_SET    int32 = 1 // value is set, empty value deletes the key; list - origins and slots of increments counted in the value
+	LOG_DEL    int32 = 2 // key is deleted
+	LOG_INCBY  int32 = 3 // value - packed int64 added to the key, list - resulting value if known and the slot of the origin
+	LOG_DELALL int32 = 4 // keys starting with key are deleted
+	LOG_SKIP   int32 = 5 // no change, the peer position is moved to ivalue, key - log id to start from
+)
@@ -0,0 +1,13 @@
+package pb
+
+// migration states of MIGRATE request
+const (
+	MIGRATE_NONE  int64 = 0 // all keys are served
+	MIGRATE_ASK   int64 = 1 // keys of other nodes are served until moved, then ERR_ASK
+	MIGRATE_MOVED int64 = 2 // ERR_MOVED for keys of other nodes
+)
+
+// Redirect returns true for ERR_MOVED and ERR_ASK responses
+func (m *LCPROTO) Redirect() bool {
+	return m != nil && (m.ErrCode == ERR_MOVED || m.ErrCode == ERR_ASK)
+}
@@ -0,0 +1,39 @@
+package pb
+
+// mutating lists commands changing data
+var mutating = map[LCPROTO_Code]bool{
+	LCPROTO_BITAND: true,
+	LCPROTO_BITOR:  true,
+	LCPROTO_BITXOR: true,
+	LCPROTO_DEC:    true,
+	LCPROTO_DECBY:  true,
+	LCPROTO_DECR:   true,
+	LCPROTO_DEL:    true,
+	LCPROTO_DELR:   true,
+	LCPROTO_HKILL:  true,
+	LCPROTO_INC:    true,
+	LCPROTO_INCBY:  true,
+	LCPROTO_INCR:   true,
+	LCPROTO_SET:    true,
+	LCPROTO_SETNX:  true,
+	LCPROTO_SETR:   true,
+	LCPROTO_ZKILL:  true,
+
+	LCPROTO_C_BITAND:    true,
+	LCPROTO_C_BITANDNOT: true,
+	LCPROTO_C_BITOR:     true,
+	LCPROTO_C_BITXOR:    true,
+	LCPROTO_C_DEC:       true,
+	LCPROTO_C_DEL:       true,
+	LCPROTO_C_HKILL:     true,
+	LCPROTO_C_INC:       true,
+	LCPROTO_C_SET:       true,
+	LCPROTO_C_SETIFMORE: true,
+	LCPROTO_C_SETNX:     true,
+	LCPROTO_C_ZKILL:     true,
+}
+
+// Mutating returns true for client commands changing data
+func (c LCPROTO_Code) Mutating() bool {
+	return mutating[c]
+}
@@ -0,0 +1,71 @@
+package pb
+
+import (
+	"fmt"
+
+	proto "github.com/golang/protobuf/proto"
+)
+
+// error codes of responses
+const (
+	ERR_UNKNOWN_CODE int32 = 1 // command code is not supported
+	ERR_BAD_ARGS     int32 = 2 // invalid key or arguments
+	ERR_UNAVAILABLE  int32 = 3 // node is not available (proxy)
+	ERR_FORBIDDEN    int32 = 4 // command is not allowed for the connection
+	ERR_MOVED        int32 = 5 // key is served by node err_msg, value - node list
+	ERR_ASK          int32 = 6 // key is migrating to node err_msg, repeat the request there
+	ERR_REJECTED     int32 = 7 // failover is rejected: the primary is alive or topology is changed, LOG and RESYNC - node is not replica
+	ERR_READONLY     int32 = 8 // write is rejected by replica, value - address of the primary if known
+)
+
+// Error is an error reported by the server in the response
+type Error struct {
+	Code    int32
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("server error %d: %s", e.Code, e.Message)
+}
+
+// ErrorResponse makes response with the error
+func ErrorResponse(code int32, message string) *LCPROTO {
+	return &LCPROTO{Code: LCPROTO_RESP, ErrCode: code, ErrMsg: message}
+}
+
+// Err returns error reported in the response or nil
+func (m *LCPROTO) Err() error {
+	if m == nil || m.ErrCode == 0 {
+		return nil
+	}
+
+	return &Error{Code: m.ErrCode, Message: m.ErrMsg}
+}
+
+// Busy returns BUSY response for the raw request
+func Busy(req []byte) []byte {
+	var msg LCPROTO
+
+	// id is lost if request is broken, client will drop the response
+	proto.Unmarshal(req, &msg)
+
+	res, _ := proto.Marshal(&LCPROTO{Code: LCPROTO_BUSY, Id: msg.Id})
+
+	return res
+}
+
+// Forbidden returns ERR_FORBIDDEN response for the raw request
+func Forbidden(req []byte) []byte {
+	var msg LCPROTO
+
+	proto.Unmarshal(req, &msg)
+
+	res, _ := proto.Marshal(&LCPROTO{
+		Code:    LCPROTO_RESP,
+		Id:      msg.Id,
+		ErrCode: ERR_FORBIDDEN,
+		ErrMsg:  msg.Code.String() + " is not allowed",
+	})
+
+	return res
+}
@@ -0,0 +1,92 @@
+package server
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// Limits of server load, zero value means no limit
+type Limits struct {
+	MaxConns int     `json:"max_conns"` // simultaneous connections
+	Rate     float64 `json:"rate"`      // requests per second from one address
+	Burst    int     `json:"burst"`     // requests allowed above rate
+	MaxQueue int     `json:"max_queue"` // requests read but not processed yet
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// rateLimiter is a token bucket per remote address
+type rateLimiter struct {
+	rate    float64
+	burst   float64
+	buckets map[string]*bucket
+	cleaned time.Time
+	mutex   sync.Mutex
+}
+
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	if burst < 1 {
+		burst = int(rate)
+		if burst < 1 {
+			burst = 1
+		}
+	}
+
+	return &rateLimiter{
+		rate:    rate,
+		burst:   float64(burst),
+		buckets: make(map[string]*bucket),
+		cleaned: time.Now(),
+	}
+}
+
+func remoteHost(conn net.Conn) string {
+	addr := conn.RemoteAddr().String()
+
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+
+	return addr
+}
+
+// Allow takes one token from the bucket of the host
+func (rl *rateLimiter) Allow(host string) bool {
+	rl.mutex.Lock()
+	defer rl.mutex.Unlock()
+
+	now := time.Now()
+
+	if now.Sub(rl.cleaned) > time.Minute {
+		for k, b := range rl.buckets {
+			if now.Sub(b.last) > time.Minute {
+				delete(rl.buckets, k)
+			}
+		}
+		rl.cleaned = now
+	}
+
+	b, ok := rl.buckets[host]
+	if !ok {
+		b = &bucket{tokens: rl.burst, last: now}
+		rl.buckets[host] = b
+	}
+
+	b.tokens += now.Sub(b.last).Seconds() * rl.rate
+	if b.tokens > rl.burst {
+		b.tokens = rl.burst
+	}
+	b.last = now
+
+	if b.tokens < 1 {
+		return false
+	}
+
+	b.tokens--
+
+	return true
+}
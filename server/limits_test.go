@@ -0,0 +1,24 @@
+package server
+
+import (
+	"testing"
+)
+
+func TestRateLimiter(t *testing.T) {
+
+	rl := newRateLimiter(1, 3)
+
+	for i := 0; i < 3; i++ {
+		if !rl.Allow("10.0.0.1") {
+			t.Fatal("burst must be allowed")
+		}
+	}
+
+	if rl.Allow("10.0.0.1") {
+		t.Fatal("request above burst must be rejected")
+	}
+
+	if !rl.Allow("10.0.0.2") {
+		t.Fatal("hosts must have own buckets")
+	}
+}
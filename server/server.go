@@ -1,8 +1,13 @@
 package server
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"net"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/lj-team/go-generic/log"
@@ -11,28 +16,112 @@ import (
 
 type CALLBACK func([]byte) ([]byte, error)
 
+// ASYNCCALLBACK passes response to reply, it may be called later from
+// another goroutine. Clients match responses by request id, so they are
+// written in the order of reply calls. Error closes the connection
+type ASYNCCALLBACK func(req []byte, reply func([]byte)) error
+
+// BUSYCALLBACK makes response for rejected request
+type BUSYCALLBACK func([]byte) []byte
+
+// RESTRICTCALLBACK returns true for requests allowed only to connections
+// with InternalAccess
+type RESTRICTCALLBACK func([]byte) bool
+
+// AUTHCALLBACK gets requests until connection is authenticated. It returns
+// response and access of the connection, NoAccess closes it
+type AUTHCALLBACK func([]byte) ([]byte, Access)
+
+// Access of authenticated connection
+type Access int
+
+const (
+	NoAccess       Access = iota
+	ClientAccess          // requests are limited, restricted ones are rejected
+	InternalAccess        // replication and management, requests are not limited
+)
+
+// Start returns ErrServerClosed after Stop or Shutdown
+var ErrServerClosed = errors.New("server closed")
+
 type Server struct {
 	Addr     string
 	Callback CALLBACK
+	Async    ASYNCCALLBACK // used instead of Callback if set
+	TLS      *tls.Config   // nil for plain tcp
+	Auth     AUTHCALLBACK  // nil if auth disabled
+
+	MaxFrameSize int // 0 - codecs.DefaultMaxSize
+
+	Limits Limits
+	Busy   BUSYCALLBACK // nil - rejected requests are not answered
+
+	// Restricted requests are rejected with Forbidden response on
+	// connections without InternalAccess. Without Auth connections are
+	// not told apart: all requests are limited and none is restricted
+	Restricted RESTRICTCALLBACK
+	Forbidden  BUSYCALLBACK
+
+	mutex      sync.Mutex
+	listener   net.Listener
+	conns      map[net.Conn]struct{}
+	inShutdown int32
+	queued     int64
+	limiter    *rateLimiter
+	wg         sync.WaitGroup
 }
 
+var errTooManyConns = errors.New("too many connections")
+
 var nextId int64 = 0
 
-func (s *Server) Start() {
+func (s *Server) Start() error {
 
 	ln, err := net.Listen("tcp", s.Addr)
 
 	if err != nil {
-		panic("bind port error")
+		return err
 	}
 
-	log.Info("server start " + s.Addr)
+	if s.TLS != nil {
+		ln = tls.NewListener(ln, s.TLS)
+	}
+
+	s.mutex.Lock()
+	if s.shuttingDown() {
+		s.mutex.Unlock()
+		ln.Close()
+		return ErrServerClosed
+	}
+	s.listener = ln
+	if s.Limits.Rate > 0 {
+		s.limiter = newRateLimiter(s.Limits.Rate, s.Limits.Burst)
+	}
+	s.mutex.Unlock()
+
+	if s.TLS != nil {
+		log.Info("server start " + s.Addr + " with tls")
+	} else {
+		log.Info("server start " + s.Addr)
+	}
 
 	for {
 
 		conn, err := ln.Accept()
 
 		if err != nil {
+			if s.shuttingDown() {
+				return ErrServerClosed
+			}
+			<-time.After(time.Millisecond * 10)
+			continue
+		}
+
+		if err = s.track(conn); err != nil {
+			if err == errTooManyConns {
+				log.Warn("reject connection from " + conn.RemoteAddr().String() + ": " + err.Error())
+			}
+			conn.Close()
 			continue
 		}
 
@@ -42,45 +131,299 @@ func (s *Server) Start() {
 	}
 }
 
+// Stop closes listener and all connections immediately
+func (s *Server) Stop() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	atomic.StoreInt32(&s.inShutdown, 1)
+
+	if s.listener != nil {
+		s.listener.Close()
+	}
+
+	for c := range s.conns {
+		c.Close()
+	}
+}
+
+// Shutdown stops accepting new connections and waits until all requests
+// already read from the sockets are processed and responses are written.
+// If ctx expires first the rest connections are closed and ctx error returned.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mutex.Lock()
+
+	atomic.StoreInt32(&s.inShutdown, 1)
+
+	if s.listener != nil {
+		s.listener.Close()
+	}
+
+	// wake up handlers waiting for data, busy ones will notice
+	// the flag after current batch
+	for c := range s.conns {
+		c.SetReadDeadline(time.Now())
+	}
+
+	s.mutex.Unlock()
+
+	done := make(chan struct{})
+
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		log.Info("server stopped " + s.Addr)
+		return nil
+	case <-ctx.Done():
+		s.Stop()
+		log.Warn("server " + s.Addr + " stopped by timeout")
+		return ctx.Err()
+	}
+}
+
+func (s *Server) shuttingDown() bool {
+	return atomic.LoadInt32(&s.inShutdown) != 0
+}
+
+func (s *Server) track(conn net.Conn) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.shuttingDown() {
+		return ErrServerClosed
+	}
+
+	if s.Limits.MaxConns > 0 && len(s.conns) >= s.Limits.MaxConns {
+		return errTooManyConns
+	}
+
+	if s.conns == nil {
+		s.conns = make(map[net.Conn]struct{})
+	}
+
+	s.conns[conn] = struct{}{}
+	s.wg.Add(1)
+
+	return nil
+}
+
+func (s *Server) untrack(conn net.Conn) {
+	s.mutex.Lock()
+	delete(s.conns, conn)
+	s.mutex.Unlock()
+
+	conn.Close()
+	s.wg.Done()
+}
+
 func (s *Server) connet_handler(conn net.Conn, id int64) {
-	defer conn.Close()
+	defer s.untrack(conn)
 
 	log.Debug(fmt.Sprintf("new conection #%d", id))
 
 	buffer := make([]byte, 4098)
 
 	encoder := codecs.Encode{}
-	decoder := codecs.Decode{}
+	decoder := codecs.Decode{MaxSize: s.MaxFrameSize}
+
+	authorized := s.Auth == nil
+	access := ClientAccess
+	host := remoteHost(conn)
+
+	var wmutex sync.Mutex
+	var deferred sync.WaitGroup // replies of Async not written yet
+
+	// the connection is closed after deferred replies
+	defer deferred.Wait()
+
+	reply := func(res []byte) bool {
+		if res != nil && len(res) > 0 {
+			wmutex.Lock()
+			defer wmutex.Unlock()
+
+			n, err := conn.Write(encoder.Write(res))
+			if err != nil || n != len(res)+4 {
+				log.Debug(fmt.Sprintf("connection #%d broken", id))
+				return false
+			}
+		}
+		return true
+	}
+
+	// the reply is written once, a broken connection is closed to stop
+	// reading
+	async := func(rec []byte) error {
+		deferred.Add(1)
+
+		var once sync.Once
+
+		done := func(res []byte) {
+			once.Do(func() {
+				if !reply(res) {
+					conn.Close()
+				}
+				deferred.Done()
+			})
+		}
+
+		err := s.Async(rec, done)
+		if err != nil {
+			done(nil)
+		}
+
+		return err
+	}
 
 	for {
 		conn.SetReadDeadline(time.Now().Add(time.Minute))
+
+		if s.shuttingDown() {
+			break
+		}
+
 		n, err := conn.Read(buffer)
 		if err != nil || n < 1 {
 			log.Debug(fmt.Sprintf("connection #%d broken", id))
 			break
 		}
 
-		list := decoder.Write(buffer[:n])
+		list, derr := decoder.Write(buffer[:n])
+
+		exempt := access == InternalAccess
+		limited := 0
+
+		if !exempt {
+			limited = len(list)
+		}
+
+		queued := s.enqueue(limited)
+		reserved := queued // places of the queue not released yet
+		seen := 0          // limited requests
 
 		for _, rec := range list {
 
-			res, err1 := s.Callback(rec)
-			if err1 != nil {
-				log.Trace(err1.Error())
-				log.Debug(fmt.Sprintf("connection #%d broken", id))
-				return
+			if !exempt {
+				seen++
+
+				if seen <= queued {
+					reserved--
+					s.dequeue(1)
+				}
+
+				if seen > queued || !s.allow(host) {
+					log.Debug(fmt.Sprintf("connection #%d from %s: request rejected", id, host))
+					if !reply(s.busy(rec)) {
+						s.dequeue(reserved)
+						return
+					}
+					continue
+				}
 			}
 
-			if res != nil && len(res) > 0 {
-				n, err = conn.Write(encoder.Write(res))
-				if err != nil || n != len(res)+4 {
-					log.Trace(err.Error())
+			var res []byte
+
+			if authorized && access != InternalAccess && s.restricted(rec) {
+				log.Warn(fmt.Sprintf("connection #%d from %s: restricted request rejected", id, host))
+				if !reply(s.forbidden(rec)) {
+					s.dequeue(reserved)
+					return
+				}
+				continue
+			}
+
+			if authorized && s.Async != nil {
+				if err1 := async(rec); err1 != nil {
+					log.Trace(err1.Error())
 					log.Debug(fmt.Sprintf("connection #%d broken", id))
+					s.dequeue(reserved)
 					return
 				}
+				continue
 			}
+
+			if authorized {
+				var err1 error
+
+				res, err1 = s.Callback(rec)
+				if err1 != nil {
+					log.Trace(err1.Error())
+					log.Debug(fmt.Sprintf("connection #%d broken", id))
+					s.dequeue(reserved)
+					return
+				}
+			} else {
+				res, access = s.Auth(rec)
+				authorized = access != NoAccess
+			}
+
+			if !reply(res) {
+				s.dequeue(reserved)
+				return
+			}
+
+			if !authorized {
+				log.Info(fmt.Sprintf("connection #%d from %s not authorized", id, host))
+				s.dequeue(reserved)
+				return
+			}
+		}
+
+		if derr != nil {
+			log.Warn(fmt.Sprintf("connection #%d from %s closed: %s", id, host, derr.Error()))
+			return
 		}
 	}
 
 	log.Debug(fmt.Sprintf("connection #%d closed", id))
 }
+
+// enqueue reserves place for size requests and returns how many of
+// them fit into MaxQueue, the rest must be rejected. The place is
+// released when request processing starts
+func (s *Server) enqueue(size int) int {
+
+	if s.Limits.MaxQueue <= 0 {
+		return size
+	}
+
+	for i := 0; i < size; i++ {
+		if atomic.AddInt64(&s.queued, 1) > int64(s.Limits.MaxQueue) {
+			atomic.AddInt64(&s.queued, -1)
+			return i
+		}
+	}
+
+	return size
+}
+
+func (s *Server) dequeue(size int) {
+	if s.Limits.MaxQueue > 0 && size > 0 {
+		atomic.AddInt64(&s.queued, -int64(size))
+	}
+}
+
+func (s *Server) restricted(req []byte) bool {
+	return s.Auth != nil && s.Restricted != nil && s.Restricted(req)
+}
+
+func (s *Server) forbidden(req []byte) []byte {
+	if s.Forbidden == nil {
+		return nil
+	}
+	return s.Forbidden(req)
+}
+
+func (s *Server) allow(host string) bool {
+	return s.limiter == nil || s.limiter.Allow(host)
+}
+
+func (s *Server) busy(req []byte) []byte {
+	if s.Busy == nil {
+		return nil
+	}
+	return s.Busy(req)
+}
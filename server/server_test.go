@@ -0,0 +1,295 @@
+package server
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/lj-team/lcluster/codecs"
+)
+
+func TestShutdown(t *testing.T) {
+
+	srv := &Server{
+		Addr: "127.0.0.1:45101",
+		Callback: func(req []byte) ([]byte, error) {
+			<-time.After(time.Millisecond * 50)
+			return req, nil
+		},
+	}
+
+	res := make(chan error, 1)
+
+	go func() {
+		res <- srv.Start()
+	}()
+
+	var conn net.Conn
+	var err error
+
+	for i := 0; i < 50; i++ {
+		if conn, err = net.Dial("tcp", srv.Addr); err == nil {
+			break
+		}
+		<-time.After(time.Millisecond * 10)
+	}
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	encoder := codecs.Encode{}
+	decoder := codecs.Decode{}
+
+	var frames []byte
+	for _, msg := range []string{"one", "two", "three"} {
+		frames = append(frames, encoder.Write([]byte(msg))...)
+	}
+	conn.Write(frames)
+
+	<-time.After(time.Millisecond * 20)
+
+	if err = srv.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = <-res; err != ErrServerClosed {
+		t.Fatal("Start must return ErrServerClosed")
+	}
+
+	var list [][]byte
+	buffer := make([]byte, 1024)
+
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+
+	for len(list) < 3 {
+		n, err := conn.Read(buffer)
+		if err != nil {
+			break
+		}
+		res, _ := decoder.Write(buffer[:n])
+		list = append(list, res...)
+	}
+
+	if len(list) != 3 || string(list[2]) != "three" {
+		t.Fatal("in-flight requests lost")
+	}
+}
+
+func TestFrameLimit(t *testing.T) {
+
+	srv := &Server{
+		Addr:         "127.0.0.1:45102",
+		MaxFrameSize: 16,
+		Callback: func(req []byte) ([]byte, error) {
+			return req, nil
+		},
+	}
+
+	go srv.Start()
+	defer srv.Stop()
+
+	var conn net.Conn
+	var err error
+
+	for i := 0; i < 50; i++ {
+		if conn, err = net.Dial("tcp", srv.Addr); err == nil {
+			break
+		}
+		<-time.After(time.Millisecond * 10)
+	}
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	encoder := codecs.Encode{}
+
+	conn.Write(encoder.Write([]byte("ok")))
+	conn.Write(encoder.Write(make([]byte, 17)))
+
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+
+	buffer := make([]byte, 1024)
+	total := 0
+
+	for {
+		n, err := conn.Read(buffer)
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				t.Fatal("connection must be closed")
+			}
+			break
+		}
+		total += n
+	}
+
+	if total != 6 {
+		t.Fatal("only first frame must be answered")
+	}
+}
+
+func TestAccess(t *testing.T) {
+
+	srv := &Server{
+		Addr:   "127.0.0.1:45103",
+		Limits: Limits{MaxQueue: 1},
+		Callback: func(req []byte) ([]byte, error) {
+			return req, nil
+		},
+		Busy: func(req []byte) []byte {
+			return []byte("busy")
+		},
+		Auth: func(req []byte) ([]byte, Access) {
+			switch string(req) {
+			case "client":
+				return req, ClientAccess
+			case "internal":
+				return req, InternalAccess
+			}
+			return nil, NoAccess
+		},
+		Restricted: func(req []byte) bool {
+			return req[0] == '!'
+		},
+		Forbidden: func(req []byte) []byte {
+			return []byte("forbidden")
+		},
+	}
+
+	go srv.Start()
+	defer srv.Stop()
+
+	// exchange sends token, then the requests at once
+	exchange := func(token string, msgs ...string) []string {
+		var conn net.Conn
+		var err error
+
+		for i := 0; i < 50; i++ {
+			if conn, err = net.Dial("tcp", srv.Addr); err == nil {
+				break
+			}
+			<-time.After(time.Millisecond * 10)
+		}
+
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+
+		encoder := codecs.Encode{}
+		decoder := codecs.Decode{}
+
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+
+		var list [][]byte
+		buffer := make([]byte, 1024)
+
+		read := func(size int) {
+			for len(list) < size {
+				n, err := conn.Read(buffer)
+				if err != nil {
+					break
+				}
+				res, _ := decoder.Write(buffer[:n])
+				list = append(list, res...)
+			}
+		}
+
+		conn.Write(encoder.Write([]byte(token)))
+		read(1)
+
+		var frames []byte
+		for _, msg := range msgs {
+			frames = append(frames, encoder.Write([]byte(msg))...)
+		}
+		conn.Write(frames)
+		read(len(msgs) + 1)
+
+		var got []string
+		for _, r := range list {
+			got = append(got, string(r))
+		}
+		return got
+	}
+
+	got := exchange("client", "!a", "b", "c")
+	if len(got) != 4 || got[1] != "forbidden" || got[2] != "busy" || got[3] != "busy" {
+		t.Fatal("client requests must be limited and restricted", got)
+	}
+
+	got = exchange("internal", "!a", "b", "c")
+	if len(got) != 4 || got[1] != "!a" || got[2] != "b" || got[3] != "c" {
+		t.Fatal("internal requests must not be limited", got)
+	}
+
+	if srv.queued != 0 {
+		t.Fatal("queue must be released", srv.queued)
+	}
+}
+
+func TestAsync(t *testing.T) {
+
+	srv := &Server{
+		Addr: "127.0.0.1:45104",
+		Async: func(req []byte, reply func([]byte)) error {
+			if req[0] == '~' {
+				go func() {
+					<-time.After(time.Millisecond * 50)
+					reply(req)
+				}()
+				return nil
+			}
+			reply(req)
+			return nil
+		},
+	}
+
+	go srv.Start()
+	defer srv.Stop()
+
+	var conn net.Conn
+	var err error
+
+	for i := 0; i < 50; i++ {
+		if conn, err = net.Dial("tcp", srv.Addr); err == nil {
+			break
+		}
+		<-time.After(time.Millisecond * 10)
+	}
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	encoder := codecs.Encode{}
+	decoder := codecs.Decode{}
+
+	var frames []byte
+	for _, msg := range []string{"~slow", "fast"} {
+		frames = append(frames, encoder.Write([]byte(msg))...)
+	}
+	conn.Write(frames)
+
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+
+	var list [][]byte
+	buffer := make([]byte, 1024)
+
+	for len(list) < 2 {
+		n, err := conn.Read(buffer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res, _ := decoder.Write(buffer[:n])
+		list = append(list, res...)
+	}
+
+	if string(list[0]) != "fast" || string(list[1]) != "~slow" {
+		t.Fatal("deferred reply must not block next requests")
+	}
+}
@@ -0,0 +1,156 @@
+package store
+
+import (
+	"github.com/lj-team/go-generic/db/ldb"
+	"github.com/lj-team/go-generic/log"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// DB is leveldb opened with the options of go-generic ldb. Unlike ldb.DB
+// it iterates keys from any position
+type DB struct {
+	ldb *leveldb.DB
+}
+
+// Open opens the database described by ldb config
+func Open(cfg *ldb.Config) (*DB, error) {
+
+	comp := opt.NoCompression
+	mul := 1
+	if cfg.Compression {
+		comp = opt.SnappyCompression
+		mul = 2
+	}
+
+	size := cfg.FileSize * 1024 * 1024
+
+	log.Info("open database: " + cfg.Path)
+
+	db, err := leveldb.OpenFile(cfg.Path, &opt.Options{
+		CompactionTableSize: size,
+		WriteBuffer:         size * mul,
+		Compression:         comp,
+		ReadOnly:            cfg.ReadOnly,
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &DB{ldb: db}, nil
+}
+
+func (db *DB) Close() {
+	db.ldb.Close()
+}
+
+// Set deletes the key if value is empty
+func (db *DB) Set(key []byte, value []byte) {
+	if len(value) == 0 {
+		db.ldb.Delete(key, nil)
+	} else {
+		db.ldb.Put(key, value, nil)
+	}
+}
+
+func (db *DB) Get(key []byte) []byte {
+	val, err := db.ldb.Get(key, nil)
+	if err != nil {
+		return nil
+	}
+	return val
+}
+
+func (db *DB) Has(key []byte) bool {
+	val, err := db.ldb.Has(key, nil)
+	return err == nil && val
+}
+
+func (db *DB) Del(key []byte) {
+	db.ldb.Delete(key, nil)
+}
+
+// ForEach calls fn for keys with the prefix. Keys and values passed to fn
+// are reused
+func (db *DB) ForEach(prefix []byte, removePrefix bool, fn ldb.FOR_EACH_FUNC) {
+
+	iter := db.ldb.NewIterator(util.BytesPrefix(prefix), nil)
+	defer iter.Release()
+
+	for iter.Next() {
+		key := iter.Key()
+
+		if removePrefix {
+			key = key[len(prefix):]
+		}
+
+		if !fn(key, iter.Value()) {
+			return
+		}
+	}
+}
+
+// Seek calls fn for keys from start in order. The iterator reads
+// a snapshot of the database. Keys and values passed to fn are reused
+func (db *DB) Seek(start []byte, fn ldb.FOR_EACH_FUNC) {
+
+	iter := db.ldb.NewIterator(&util.Range{Start: start}, nil)
+	defer iter.Release()
+
+	for iter.Next() {
+		if !fn(iter.Key(), iter.Value()) {
+			return
+		}
+	}
+}
+
+// Write saves the batch atomically
+func (db *DB) Write(b *Batch) error {
+	return db.ldb.Write(&b.b, nil)
+}
+
+// Batch of writes saved together by Write
+type Batch struct {
+	b leveldb.Batch
+}
+
+// Set deletes the key if value is empty
+func (b *Batch) Set(key, value []byte) {
+	if len(value) == 0 {
+		b.b.Delete(key)
+	} else {
+		b.b.Put(key, value)
+	}
+}
+
+func (b *Batch) Del(key []byte) {
+	b.b.Delete(key)
+}
+
+func (b *Batch) Len() int {
+	return b.b.Len()
+}
+
+func (b *Batch) Reset() {
+	b.b.Reset()
+}
+
+// Replay calls set and del for the writes in order
+func (b *Batch) Replay(set func(key, value []byte), del func(key []byte)) {
+	b.b.Replay(replay{set, del})
+}
+
+type replay struct {
+	set func(key, value []byte)
+	del func(key []byte)
+}
+
+func (r replay) Put(key, value []byte) {
+	r.set(key, value)
+}
+
+func (r replay) Delete(key []byte) {
+	r.del(key)
+}
@@ -7,12 +7,14 @@ import (
 	"os"
 
 	"github.com/lj-team/go-generic/log"
+	"github.com/lj-team/lcluster/auth"
 )
 
 type Config struct {
-	Log    log.Config `json:"log"`
-	Server string     `json:"server"`
-	Nodes  []string   `json:"nodes"`
+	Log    log.Config       `json:"log"`
+	Server string           `json:"server"`
+	Nodes  []string         `json:"nodes"`
+	Auth   auth.Credentials `json:"auth"`
 }
 
 var _config *Config
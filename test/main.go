@@ -23,7 +23,7 @@ func main() {
 
 	log.Init(&cfg.Log)
 
-	con = connect.NewProxy(cfg.Nodes)
+	con = connect.NewProxyWithOptions(cfg.Nodes, &connect.Options{Auth: &cfg.Auth})
 
 	testNop()
 	testBasic()
@@ -0,0 +1,106 @@
+package tlsconf
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+)
+
+// Config describes TLS settings in json configs. Empty Cert and CA
+// means TLS is disabled
+type Config struct {
+	Cert       string `json:"cert"`
+	Key        string `json:"key"`
+	CA         string `json:"ca"`
+	ClientAuth bool   `json:"client_auth"`
+	ServerName string `json:"server_name"`
+	Insecure   bool   `json:"insecure"`
+}
+
+func (c *Config) Enabled() bool {
+	return c != nil && (c.Cert != "" || c.CA != "")
+}
+
+func loadPool(filename string) (*x509.CertPool, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, errors.New("no certificates in " + filename)
+	}
+
+	return pool, nil
+}
+
+// Server returns config for listener or nil if TLS disabled. With
+// ClientAuth clients must present certificate signed by CA
+func (c *Config) Server() (*tls.Config, error) {
+
+	if !c.Enabled() {
+		return nil, nil
+	}
+
+	if c.Cert == "" || c.Key == "" {
+		return nil, errors.New("tls: cert and key required")
+	}
+
+	cert, err := tls.LoadX509KeyPair(c.Cert, c.Key)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if c.ClientAuth {
+		if c.CA == "" {
+			return nil, errors.New("tls: ca required for client_auth")
+		}
+
+		if res.ClientCAs, err = loadPool(c.CA); err != nil {
+			return nil, err
+		}
+
+		res.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return res, nil
+}
+
+// Client returns config for outgoing connections or nil if TLS disabled
+func (c *Config) Client() (*tls.Config, error) {
+
+	if !c.Enabled() {
+		return nil, nil
+	}
+
+	res := &tls.Config{
+		ServerName:         c.ServerName,
+		InsecureSkipVerify: c.Insecure,
+		MinVersion:         tls.VersionTLS12,
+	}
+
+	var err error
+
+	if c.CA != "" {
+		if res.RootCAs, err = loadPool(c.CA); err != nil {
+			return nil, err
+		}
+	}
+
+	if c.Cert != "" {
+		cert, err := tls.LoadX509KeyPair(c.Cert, c.Key)
+		if err != nil {
+			return nil, err
+		}
+		res.Certificates = []tls.Certificate{cert}
+	}
+
+	return res, nil
+}
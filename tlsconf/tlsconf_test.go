@@ -0,0 +1,142 @@
+package tlsconf
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeCert(t *testing.T, dir, name string, tmpl, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if parent == nil {
+		parent = tmpl
+		parentKey = key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	kder, _ := x509.MarshalECPrivateKey(key)
+
+	ioutil.WriteFile(filepath.Join(dir, name+".crt"), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	ioutil.WriteFile(filepath.Join(dir, name+".key"), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: kder}), 0600)
+
+	cert, _ := x509.ParseCertificate(der)
+
+	return cert, key
+}
+
+func TestTLS(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "tlsconf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ca, caKey := writeCert(t, dir, "ca", &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "lcluster ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, nil, nil)
+
+	writeCert(t, dir, "node", &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "node"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, ca, caKey)
+
+	writeCert(t, dir, "client", &x509.Certificate{
+		SerialNumber: big.NewInt(3),
+		Subject:      pkix.Name{CommonName: "client"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, ca, caKey)
+
+	disabled := &Config{}
+	if cfg, err := disabled.Server(); cfg != nil || err != nil {
+		t.Fatal("empty config must disable tls")
+	}
+
+	srvConf := &Config{
+		Cert:       filepath.Join(dir, "node.crt"),
+		Key:        filepath.Join(dir, "node.key"),
+		CA:         filepath.Join(dir, "ca.crt"),
+		ClientAuth: true,
+	}
+
+	srvTLS, err := srvConf.Server()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", srvTLS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.(*tls.Conn).Handshake()
+			conn.Write([]byte{1})
+			conn.Close()
+		}
+	}()
+
+	tDial := func(conf *Config, ok bool) {
+		cliTLS, err := conf.Client()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		conn, err := tls.Dial("tcp", ln.Addr().String(), cliTLS)
+		if err == nil {
+			buf := make([]byte, 1)
+			_, err = conn.Read(buf)
+			conn.Close()
+		}
+
+		if ok != (err == nil) {
+			t.Fatalf("unexpected handshake result: %v", err)
+		}
+	}
+
+	tDial(&Config{
+		CA:   filepath.Join(dir, "ca.crt"),
+		Cert: filepath.Join(dir, "client.crt"),
+		Key:  filepath.Join(dir, "client.key"),
+	}, true)
+
+	tDial(&Config{CA: filepath.Join(dir, "ca.crt")}, false)
+}